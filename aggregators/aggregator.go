@@ -0,0 +1,72 @@
+package aggregators
+
+import (
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Order of a delivery platform translated into our terms
+type ExternalOrder struct {
+	External_id			string
+	Order_type			string
+	Customer_name		*string
+	Customer_phone		*string
+	Delivery_address	*string
+	Promised_at			*time.Time
+	Items				[]ExternalItem
+}
+
+// Line of a platform order; External_item_id is the platform's id of the menu item
+type ExternalItem struct {
+	External_item_id	string
+	Name				string
+	Count				int
+}
+
+// Adapter speaks the webhook format of one delivery platform: it checks and parses the
+// orders the platform posts and reports status changes (ACCEPTED, REJECTED, READY, ...) back to it
+type Adapter interface {
+	Name() string
+	Verify(r *http.Request, body []byte) error
+	ParseOrder(body []byte) (ExternalOrder, error)
+	PushStatus(externalId string, status string, reason string) error
+}
+
+var (
+	mu			sync.RWMutex
+	adapters	= map[string]Adapter{}
+)
+
+// Plugs in the adapter of a platform; its orders are posted to /aggregators/<name>/orders
+func Register(adapter Adapter) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	adapters[adapter.Name()] = adapter
+}
+
+func Get(name string) (Adapter, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	adapter, found := adapters[name]
+
+	return adapter, found
+}
+
+func Names() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	names := []string{}
+
+	for name := range adapters {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
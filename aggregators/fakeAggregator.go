@@ -0,0 +1,149 @@
+package aggregators
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+const FAKE_SIGNATURE_HEADER = "X-Fake-Signature"
+
+// Order format of the local fake aggregator (see cmd/fakeaggregator)
+type FakeOrder struct {
+	Id					string				`json:"id"`
+	Type				string				`json:"type"`
+	Customer			FakeCustomer		`json:"customer"`
+	Ready_by			*time.Time			`json:"ready_by"`
+	Items				[]FakeOrderItem		`json:"items"`
+}
+
+type FakeCustomer struct {
+	Name				string				`json:"name"`
+	Phone				string				`json:"phone"`
+	Address				string				`json:"address"`
+}
+
+type FakeOrderItem struct {
+	Sku					string				`json:"sku"`
+	Name				string				`json:"name"`
+	Count				int					`json:"count"`
+}
+
+type FakeStatus struct {
+	Id					string				`json:"id"`
+	Status				string				`json:"status"`
+	Reason				string				`json:"reason,omitempty"`
+}
+
+// Adapter of the fake aggregator: orders are signed w/ an HMAC-SHA256 of the body (hex) in the
+// X-Fake-Signature header, status changes are posted to CallbackURL/orders/<id>/status
+type FakeAggregator struct {
+	Secret				string
+	CallbackURL			string
+	client				*http.Client
+}
+
+// Only registered when FAKE_AGGREGATOR_SECRET is set, so default deployments take no unsigned orders
+func init() {
+	if os.Getenv("FAKE_AGGREGATOR_SECRET") == "" {
+		return
+	}
+
+	Register(&FakeAggregator{
+		Secret: os.Getenv("FAKE_AGGREGATOR_SECRET"),
+		CallbackURL: os.Getenv("FAKE_AGGREGATOR_URL"),
+		client: &http.Client{Timeout: 10 * time.Second},
+	})
+}
+
+func FakeSignature(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (a *FakeAggregator) Name() string {
+	return "fake"
+}
+
+func (a *FakeAggregator) Verify(r *http.Request, body []byte) error {
+	if a.Secret == "" {
+		return fmt.Errorf("fake aggregator has no secret configured")
+	}
+
+	if !hmac.Equal([]byte(r.Header.Get(FAKE_SIGNATURE_HEADER)), []byte(FakeSignature(a.Secret, body))) {
+		return fmt.Errorf("invalid %s header", FAKE_SIGNATURE_HEADER)
+	}
+
+	return nil
+}
+
+func (a *FakeAggregator) ParseOrder(body []byte) (order ExternalOrder, err error) {
+	var fake FakeOrder
+
+	if err = json.Unmarshal(body, &fake); err != nil {
+		return
+	}
+
+	if fake.Id == "" {
+		return order, fmt.Errorf("order id is missing")
+	}
+
+	order = ExternalOrder{External_id: fake.Id, Order_type: "DELIVERY", Promised_at: fake.Ready_by}
+
+	if fake.Type == "PICKUP" {
+		order.Order_type = "TAKEAWAY"
+	}
+
+	if fake.Customer.Name != "" {
+		order.Customer_name = &fake.Customer.Name
+	}
+
+	if fake.Customer.Phone != "" {
+		order.Customer_phone = &fake.Customer.Phone
+	}
+
+	if fake.Customer.Address != "" && order.Order_type == "DELIVERY" {
+		order.Delivery_address = &fake.Customer.Address
+	}
+
+	for _, item := range fake.Items {
+		order.Items = append(order.Items, ExternalItem{External_item_id: item.Sku, Name: item.Name, Count: item.Count})
+	}
+
+	return order, nil
+}
+
+func (a *FakeAggregator) PushStatus(externalId string, status string, reason string) error {
+	if a.CallbackURL == "" {
+		return nil
+	}
+
+	body, err := json.Marshal(FakeStatus{Id: externalId, Status: status, Reason: reason})
+
+	if err != nil {
+		return err
+	}
+
+	res, err := a.client.Post(fmt.Sprintf("%s/orders/%s/status", a.CallbackURL, url.PathEscape(externalId)), "application/json", bytes.NewReader(body))
+
+	if err != nil {
+		return err
+	}
+
+	defer res.Body.Close()
+
+	if res.StatusCode >= 300 {
+		return fmt.Errorf("fake aggregator responded with %s", res.Status)
+	}
+
+	return nil
+}
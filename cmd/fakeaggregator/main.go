@@ -0,0 +1,99 @@
+// Local stand-in for a delivery platform: posts a sample order to the backend's webhook
+// and prints the status updates the backend pushes back to it
+//
+//	FAKE_AGGREGATOR_SECRET=dev FAKE_AGGREGATOR_URL=http://localhost:9000 go run main.go
+//	FAKE_AGGREGATOR_SECRET=dev go run ./cmd/fakeaggregator -items burger:2,fries:1
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lackingworth/Go-Restaurant-Management/aggregators"
+)
+
+func main() {
+	webhook := flag.String("webhook", "http://localhost:8000/aggregators/fake/orders", "webhook of the backend the order is posted to")
+	listen := flag.String("listen", ":9000", "address status updates are received on (FAKE_AGGREGATOR_URL of the backend)")
+	items := flag.String("items", "burger:1", "ordered items as sku:count, comma separated")
+	pickup := flag.Bool("pickup", false, "order for pickup instead of delivery")
+	flag.Parse()
+
+	// The backend only takes orders of the fake aggregator signed w/ the shared secret
+	secret := os.Getenv("FAKE_AGGREGATOR_SECRET")
+
+	if secret == "" {
+		log.Fatal("FAKE_AGGREGATOR_SECRET is not set")
+	}
+
+	http.HandleFunc("/orders/", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		log.Printf("status update %s: %s", r.URL.Path, body)
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	go func() {
+		log.Fatal(http.ListenAndServe(*listen, nil))
+	}()
+
+	readyBy := time.Now().Add(45 * time.Minute).UTC()
+	order := aggregators.FakeOrder{
+		Id: fmt.Sprintf("F-%d", time.Now().Unix()),
+		Type: "DELIVERY",
+		Customer: aggregators.FakeCustomer{Name: "Test Customer", Phone: "+10000000000", Address: "1 Test Street"},
+		Ready_by: &readyBy,
+	}
+
+	if *pickup {
+		order.Type = "PICKUP"
+	}
+
+	for _, item := range strings.Split(*items, ",") {
+		sku, count, _ := strings.Cut(item, ":")
+		n, err := strconv.Atoi(count)
+
+		if err != nil {
+			n = 1
+		}
+
+		order.Items = append(order.Items, aggregators.FakeOrderItem{Sku: sku, Name: sku, Count: n})
+	}
+
+	body, err := json.Marshal(order)
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, *webhook, bytes.NewReader(body))
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	req.Header.Set(aggregators.FAKE_SIGNATURE_HEADER, aggregators.FakeSignature(secret, body))
+
+	res, err := http.DefaultClient.Do(req)
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	response, _ := io.ReadAll(res.Body)
+	res.Body.Close()
+	log.Printf("posted order %s: %s %s", order.Id, res.Status, response)
+	log.Printf("waiting for status updates on %s (Ctrl+C to stop)", *listen)
+
+	select {}
+}
@@ -0,0 +1,487 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lackingworth/Go-Restaurant-Management/aggregators"
+	"github.com/lackingworth/Go-Restaurant-Management/database"
+	helper "github.com/lackingworth/Go-Restaurant-Management/helpers"
+	"github.com/lackingworth/Go-Restaurant-Management/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type AggregatorStatusChange struct {
+	Status				string		`json:"status" validate:"eq=PREPARING|eq=READY|eq=PICKED_UP|eq=DELIVERED|eq=CANCELLED"`
+	Reason				*string		`json:"reason" validate:"omitempty,max=500"`
+}
+
+// Most portions of one item a platform order may ask for, anything above is rejected as malformed
+const MAX_AGGREGATOR_ITEM_COUNT = 50
+
+// How long a received order may be in placement before a retry of the platform places it again
+const AGGREGATOR_PLACEMENT_LEASE = 5 * time.Minute
+
+var aggregatorMappingCollection *mongo.Collection = database.OpenCollection(database.Client, "aggregatorMapping")
+var aggregatorOrderCollection *mongo.Collection = database.OpenCollection(database.Client, "aggregatorOrder")
+
+var aggregatorMappingListSpec = helper.ListSpec{
+	Filters: map[string]helper.FieldKind{"platform": helper.STRING_FIELD, "external_item_id": helper.STRING_FIELD, "food_id": helper.STRING_FIELD, "bundle_id": helper.STRING_FIELD},
+	Sorts: []string{"platform", "external_item_id", "created_at", "updated_at"},
+	Date_field: "created_at",
+}
+
+var aggregatorOrderListSpec = helper.ListSpec{
+	Filters: map[string]helper.FieldKind{"platform": helper.STRING_FIELD, "external_id": helper.STRING_FIELD, "status": helper.STRING_FIELD, "order_id": helper.STRING_FIELD, "pushed_status": helper.STRING_FIELD},
+	Sorts: []string{"-created_at", "updated_at"},
+	Date_field: "created_at",
+}
+
+// One received order per platform order, so concurrent retries of the webhook cannot place it twice
+func EnsureAggregatorIndexes() error {
+	var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	_, err := aggregatorOrderCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "platform", Value: 1}, {Key: "external_id", Value: 1}},
+		Options: options.Index().SetName("aggregator_order_external_id").SetUnique(true),
+	})
+
+	return err
+}
+
+// Reports the status to the platform through its adapter and keeps the outcome w/ the received order
+func pushAggregatorOrderStatus(ctx context.Context, record models.AggregatorOrder, status string, reason string) error {
+	adapter, found := aggregators.Get(record.Platform)
+
+	if !found {
+		return fmt.Errorf("No adapter for platform %s", record.Platform)
+	}
+
+	pushErr := adapter.PushStatus(record.External_id, status, reason)
+	updateObj := bson.D{{Key: "pushed_status", Value: status}, {Key: "push_error", Value: nil}}
+
+	if pushErr != nil {
+		updateObj = bson.D{{Key: "push_error", Value: pushErr.Error()}}
+	}
+
+	updatedAt, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	updateObj = append(updateObj, bson.E{Key: "updated_at", Value: updatedAt})
+
+	_, err := aggregatorOrderCollection.UpdateOne(ctx, bson.M{"aggregator_order_id": record.Aggregator_order_id}, bson.D{{Key: "$set", Value: updateObj}})
+
+	if err != nil {
+		return err
+	}
+
+	return pushErr
+}
+
+// Pushes the status of our order back to the platform it came from; orders of our own are left alone
+func pushAggregatorStatus(ctx context.Context, orderId string, status string) {
+	var record models.AggregatorOrder
+
+	if aggregatorOrderCollection.FindOne(ctx, bson.M{"order_id": orderId}).Decode(&record) != nil {
+		return
+	}
+
+	if err := pushAggregatorOrderStatus(ctx, record, status, ""); err != nil {
+		log.Println(err)
+	}
+}
+
+// Turns the items of the platform order into order items through the platform's menu mappings;
+// returns the names of the items that are not mapped yet
+func mapExternalItems(ctx context.Context, platform string, items []aggregators.ExternalItem) (orderItems []models.OrderItem, unmapped []string, err error) {
+	for _, item := range items {
+		var mapping models.AggregatorMapping
+
+		err = aggregatorMappingCollection.FindOne(ctx, bson.M{"platform": platform, "external_item_id": item.External_item_id}).Decode(&mapping)
+
+		if err == mongo.ErrNoDocuments {
+			unmapped = append(unmapped, fmt.Sprintf("%s (%s)", item.Name, item.External_item_id))
+			err = nil
+			continue
+		}
+
+		if err != nil {
+			return
+		}
+
+		quantity := "M"
+
+		if mapping.Quantity != nil {
+			quantity = *mapping.Quantity
+		}
+
+		// Every portion is an order item of its own
+		for i := 0; i < max(item.Count, 1); i++ {
+			orderItems = append(orderItems, models.OrderItem{Food_id: mapping.Food_id, Bundle_id: mapping.Bundle_id, Components: mapping.Components, Quantity: &quantity})
+		}
+	}
+
+	return
+}
+
+// Inbound webhook of the delivery platforms: the platform's adapter checks and parses the order, its items are
+// mapped to our menu and the order is placed like a staff order; the platform is told whether it was accepted
+func ReceiveAggregatorOrder() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		var existing models.AggregatorOrder
+		platform := c.Param("platform")
+		defer cancel()
+
+		adapter, found := aggregators.Get(platform)
+
+		if !found {
+			c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("Unknown platform %s", platform)})
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := adapter.Verify(c.Request, body); err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+
+		external, err := adapter.ParseOrder(body)
+
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if len(external.Items) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Order has no items"})
+			return
+		}
+
+		for _, item := range external.Items {
+			if item.Count > MAX_AGGREGATOR_ITEM_COUNT {
+				msg := fmt.Sprintf("Count of %s (%s) is above %d", item.Name, item.External_item_id, MAX_AGGREGATOR_ITEM_COUNT)
+				c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+				return
+			}
+		}
+
+		now, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		record := models.AggregatorOrder{Platform: platform, External_id: external.External_id, Status: "RECEIVED", Payload: string(body)}
+		record.Created_at = now
+		record.Updated_at = now
+		record.ID = primitive.NewObjectID()
+		record.Aggregator_order_id = record.ID.Hex()
+
+		// The order is claimed before it is placed: platforms retry webhooks, an accepted order is
+		// answered w/ its record again, a rejected one (or one stuck being placed) is placed again
+		if _, err := aggregatorOrderCollection.InsertOne(ctx, record); err != nil {
+			if !mongo.IsDuplicateKeyError(err) || aggregatorOrderCollection.FindOne(ctx, bson.M{"platform": platform, "external_id": external.External_id}).Decode(&existing) != nil {
+				msg := fmt.Sprintf("Platform order was not recorded")
+				c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+				return
+			}
+
+			if existing.Status == "ACCEPTED" {
+				if existing.Status_code == 0 {
+					existing.Status_code = http.StatusOK
+				}
+
+				c.JSON(existing.Status_code, existing)
+				return
+			}
+
+			leased := existing.Status == "RECEIVED" && now.Sub(existing.Updated_at) < AGGREGATOR_PLACEMENT_LEASE
+			claimed := false
+
+			if !leased {
+				res, err := aggregatorOrderCollection.UpdateOne(
+					ctx,
+					bson.M{"aggregator_order_id": existing.Aggregator_order_id, "status": existing.Status, "updated_at": existing.Updated_at},
+					bson.D{{Key: "$set", Value: bson.D{{Key: "status", Value: "RECEIVED"}, {Key: "payload", Value: record.Payload}, {Key: "updated_at", Value: now}}}},
+				)
+
+				if err != nil {
+					msg := fmt.Sprintf("Platform order was not recorded")
+					c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+					return
+				}
+
+				claimed = res.ModifiedCount == 1
+			}
+
+			if !claimed {
+				c.JSON(http.StatusConflict, gin.H{"error": "Platform order is still being placed", "aggregator_order_id": existing.Aggregator_order_id})
+				return
+			}
+
+			record.ID = existing.ID
+			record.Aggregator_order_id = existing.Aggregator_order_id
+			record.Created_at = existing.Created_at
+			record.Pushed_status = existing.Pushed_status
+			record.Push_error = existing.Push_error
+		}
+
+		// A placement that got stuck may have created the order before it stopped
+		var placedOrder models.Order
+		err = orderCollection.FindOne(ctx, bson.M{"source": platform, "external_id": external.External_id}).Decode(&placedOrder)
+
+		if err != nil && err != mongo.ErrNoDocuments {
+			msg := fmt.Sprintf("Platform order was not recorded")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+			return
+		}
+
+		var orderItems []models.OrderItem
+		var unmapped []string
+		status := http.StatusOK
+
+		if err == nil {
+			record.Order_id = &placedOrder.Order_id
+		} else {
+			orderItems, unmapped, err = mapExternalItems(ctx, platform, external.Items)
+		}
+
+		if err == nil && len(unmapped) > 0 {
+			status, err = http.StatusUnprocessableEntity, fmt.Errorf("Items are not mapped to the menu: %s", strings.Join(unmapped, ", "))
+		} else if err != nil {
+			status, err = http.StatusInternalServerError, fmt.Errorf("Menu mappings could not be loaded")
+		}
+
+		if err == nil && record.Order_id == nil {
+			order := models.Order{
+				Order_Date: now,
+				Order_type: external.Order_type,
+				Customer_name: external.Customer_name,
+				Customer_phone: external.Customer_phone,
+				Delivery_address: external.Delivery_address,
+				Promised_at: external.Promised_at,
+				Source: &platform,
+				External_id: &external.External_id,
+			}
+
+			var placed PlacedOrder
+			placed, _, status, err = placeOrder(ctx, order, orderItems)
+
+			if err == nil {
+				record.Order_id = &placed.Order_id
+			}
+		}
+
+		record.Status = "ACCEPTED"
+		record.Error = nil
+		record.Status_code = status
+
+		if err != nil {
+			msg := err.Error()
+			record.Status = "REJECTED"
+			record.Error = &msg
+		}
+
+		record.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		updateObj := bson.D{
+			{Key: "status", Value: record.Status},
+			{Key: "order_id", Value: record.Order_id},
+			{Key: "error", Value: record.Error},
+			{Key: "status_code", Value: record.Status_code},
+			{Key: "updated_at", Value: record.Updated_at},
+		}
+
+		if _, updateErr := aggregatorOrderCollection.UpdateOne(ctx, bson.M{"aggregator_order_id": record.Aggregator_order_id}, bson.D{{Key: "$set", Value: updateObj}}); updateErr != nil {
+			msg := fmt.Sprintf("Platform order was not recorded")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+			return
+		}
+
+		reason := ""
+
+		if record.Error != nil {
+			reason = *record.Error
+		}
+
+		if pushErr := pushAggregatorOrderStatus(ctx, record, record.Status, reason); pushErr != nil {
+			log.Println(pushErr)
+		}
+
+		if err != nil {
+			c.JSON(status, gin.H{"error": err.Error(), "aggregator_order_id": record.Aggregator_order_id})
+			return
+		}
+
+		c.JSON(http.StatusOK, record)
+	}
+}
+
+func GetAggregatorOrders() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		helper.RespondWithList(c, ctx, aggregatorOrderCollection, aggregatorOrderListSpec, bson.D{}, "Error occured while listing platform orders", nil)
+	}
+}
+
+// Reports a status to the platform by hand (e.g. CANCELLED, or a push that failed before)
+func UpdateAggregatorOrderStatus() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		var change AggregatorStatusChange
+		var record models.AggregatorOrder
+		aggregatorOrderId := c.Param("aggregator_order_id")
+		defer cancel()
+
+		if err := c.BindJSON(&change); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error":err.Error()})
+			return
+		}
+
+		validationErr := validate.Struct(change)
+
+		if validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error":validationErr.Error()})
+			return
+		}
+
+		if err := aggregatorOrderCollection.FindOne(ctx, bson.M{"aggregator_order_id": aggregatorOrderId}).Decode(&record); err != nil {
+			msg := fmt.Sprintf("Platform order was not found")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+			return
+		}
+
+		if record.Status != "ACCEPTED" {
+			c.JSON(http.StatusConflict, gin.H{"error": "Platform order was rejected"})
+			return
+		}
+
+		reason := ""
+
+		if change.Reason != nil {
+			reason = *change.Reason
+		}
+
+		if err := pushAggregatorOrderStatus(ctx, record, change.Status, reason); err != nil {
+			c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"aggregator_order_id": aggregatorOrderId, "pushed_status": change.Status})
+	}
+}
+
+func GetAggregatorMappings() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		helper.RespondWithList(c, ctx, aggregatorMappingCollection, aggregatorMappingListSpec, bson.D{}, "Error occured while listing menu mappings", nil)
+	}
+}
+
+// Maps a platform menu item to our food or bundle; mapping the same item again replaces the mapping
+func CreateAggregatorMapping() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		var mapping models.AggregatorMapping
+		var current models.AggregatorMapping
+		defer cancel()
+
+		if err := c.BindJSON(&mapping); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error":err.Error()})
+			return
+		}
+
+		validationErr := validate.Struct(mapping)
+
+		if validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error":validationErr.Error()})
+			return
+		}
+
+		if _, found := aggregators.Get(*mapping.Platform); !found {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Unknown platform, available: %s", strings.Join(aggregators.Names(), ", "))})
+			return
+		}
+
+		if mapping.Bundle_id != nil {
+			var bundle models.Bundle
+
+			if err := bundleCollection.FindOne(ctx, bson.M{"bundle_id": mapping.Bundle_id}).Decode(&bundle); err != nil {
+				msg := fmt.Sprintf("Bundle was not found")
+				c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+				return
+			}
+
+			if err := checkBundleComponents(ctx, bundle, mapping.Components); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		} else {
+			count, err := foodCollection.CountDocuments(ctx, bson.M{"food_id": mapping.Food_id})
+
+			if err != nil || count == 0 {
+				msg := fmt.Sprintf("Food item was not found")
+				c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+				return
+			}
+		}
+
+		filter := bson.M{"platform": mapping.Platform, "external_item_id": mapping.External_item_id}
+		mapping.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		mapping.Created_at = mapping.Updated_at
+		mapping.ID = primitive.NewObjectID()
+
+		if aggregatorMappingCollection.FindOne(ctx, filter).Decode(&current) == nil {
+			mapping.Created_at = current.Created_at
+			mapping.ID = current.ID
+		}
+
+		mapping.Mapping_id = mapping.ID.Hex()
+
+		_, err := aggregatorMappingCollection.ReplaceOne(ctx, filter, mapping, options.Replace().SetUpsert(true))
+
+		if err != nil {
+			msg := fmt.Sprintf("Menu mapping was not saved")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+			return
+		}
+
+		c.JSON(http.StatusOK, mapping)
+	}
+}
+
+func DeleteAggregatorMapping() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		mappingId := c.Param("mapping_id")
+		defer cancel()
+
+		res, err := aggregatorMappingCollection.DeleteOne(ctx, bson.M{"mapping_id": mappingId})
+
+		if err != nil {
+			msg := fmt.Sprintf("Menu mapping was not deleted")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+			return
+		}
+
+		if res.DeletedCount == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Menu mapping was not found"})
+			return
+		}
+
+		c.JSON(http.StatusOK, res)
+	}
+}
@@ -0,0 +1,233 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lackingworth/Go-Restaurant-Management/database"
+	helper "github.com/lackingworth/Go-Restaurant-Management/helpers"
+	"github.com/lackingworth/Go-Restaurant-Management/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type BundleSlotView struct {
+	Name			string			`json:"name"`
+	Category		string			`json:"category"`
+	Options			[]bson.M		`json:"options"`
+}
+
+type BundleView struct {
+	Bundle_id		string				`json:"bundle_id"`
+	Name			*string				`json:"name"`
+	Price			*float64			`json:"price"`
+	Slots			[]BundleSlotView	`json:"slots"`
+}
+
+var bundleCollection *mongo.Collection = database.OpenCollection(database.Client, "bundle")
+
+// Returns the foods of all menus of the given category
+func categoryFoods(ctx context.Context, category string) (foods []bson.M, err error) {
+	lookupStage := bson.D{{Key: "$lookup", Value: bson.D{{Key: "from", Value: "menu"}, {Key: "localField", Value: "menu_id"}, {Key: "foreignField", Value: "menu_id"}, {Key: "as", Value: "menu"}} /*end*/}}
+	matchStage := bson.D{{Key: "$match", Value: bson.D{{Key: "menu.category", Value: category}} /*end*/}}
+	projectStage := bson.D{{Key: "$project", Value: bson.D{{Key: "_id", Value: 0}, {Key: "food_id", Value: 1}, {Key: "name", Value: 1}, {Key: "food_image", Value: 1}, {Key: "contains", Value: 1}} /*end*/}}
+
+	res, err := foodCollection.Aggregate(ctx, mongo.Pipeline{lookupStage, matchStage, projectStage})
+
+	if err != nil {
+		return
+	}
+
+	foods = []bson.M{}
+	err = res.All(ctx, &foods)
+
+	return
+}
+
+// Checks that the components fill every slot of the bundle exactly once with a food
+// of the slot's menu category and fills in the food names
+func checkBundleComponents(ctx context.Context, bundle models.Bundle, components []models.BundleComponent) error {
+	if len(components) != len(bundle.Slots) {
+		return fmt.Errorf("Bundle %s needs exactly one food for each of its %d slots", *bundle.Name, len(bundle.Slots))
+	}
+
+	for _, slot := range bundle.Slots {
+		found := false
+
+		for i, component := range components {
+			if component.Slot != slot.Name {
+				continue
+			}
+
+			if found {
+				return fmt.Errorf("Slot %s was chosen more than once", slot.Name)
+			}
+
+			var food models.Food
+			var menu models.Menu
+
+			err := foodCollection.FindOne(ctx, bson.M{"food_id": component.Food_id}).Decode(&food)
+
+			if err != nil {
+				return fmt.Errorf("Food item %s was not found", component.Food_id)
+			}
+
+			err = menuCollection.FindOne(ctx, bson.M{"menu_id": food.Menu_id}).Decode(&menu)
+
+			if err != nil || menu.Category != slot.Category {
+				return fmt.Errorf("Food item %s is not a choice for slot %s", component.Food_id, slot.Name)
+			}
+
+			components[i].Food_name = *food.Name
+			found = true
+		}
+
+		if !found {
+			return fmt.Errorf("Slot %s was not chosen", slot.Name)
+		}
+	}
+
+	return nil
+}
+
+var bundleListSpec = helper.ListSpec{
+	Filters: map[string]helper.FieldKind{"name": helper.STRING_FIELD},
+	Sorts: []string{"name", "price", "created_at", "updated_at"},
+	Date_field: "created_at",
+}
+
+func GetBundles() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		helper.RespondWithList(c, ctx, bundleCollection, bundleListSpec, bson.D{}, "Error occured while listing bundles", nil)
+	}
+}
+
+// Returns the bundle with the foods that can be chosen for each slot
+func GetBundle() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		var bundle models.Bundle
+		bundleId := c.Param("bundle_id")
+		defer cancel()
+
+		err := bundleCollection.FindOne(ctx, bson.M{"bundle_id": bundleId}).Decode(&bundle)
+
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error":"Error occured while fetching the bundle"})
+			return
+		}
+
+		bundleView := BundleView{
+			Bundle_id: bundle.Bundle_id,
+			Name: bundle.Name,
+			Price: bundle.Price,
+		}
+
+		for _, slot := range bundle.Slots {
+			options, err := categoryFoods(ctx, slot.Category)
+
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error":"Error occured while listing the bundle choices"})
+				return
+			}
+
+			bundleView.Slots = append(bundleView.Slots, BundleSlotView{Name: slot.Name, Category: slot.Category, Options: options})
+		}
+
+		c.JSON(http.StatusOK, bundleView)
+	}
+}
+
+func CreateBundle() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		var bundle models.Bundle
+		defer cancel()
+
+		if err := c.BindJSON(&bundle); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error":err.Error()})
+			return
+		}
+
+		validationErr := validate.Struct(bundle)
+
+		if validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error":validationErr.Error()})
+			return
+		}
+
+		var price = toFixed(*bundle.Price, 2)
+		bundle.Price = &price
+		bundle.Created_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		bundle.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		bundle.ID = primitive.NewObjectID()
+		bundle.Bundle_id = bundle.ID.Hex()
+
+		res, insertErr := bundleCollection.InsertOne(ctx, bundle)
+
+		if insertErr != nil {
+			msg := fmt.Sprintf("Bundle was not created")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+			return
+		}
+
+		c.JSON(http.StatusOK, res)
+	}
+}
+
+func UpdateBundle() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		var bundle models.Bundle
+		var updateObj primitive.D
+		bundleId := c.Param("bundle_id")
+		defer cancel()
+
+		if err := c.BindJSON(&bundle); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error":err.Error()})
+			return
+		}
+
+		if bundle.Name != nil {
+			updateObj = append(updateObj, bson.E{Key: "name", Value: bundle.Name})
+		}
+
+		if bundle.Price != nil {
+			var price = toFixed(*bundle.Price, 2)
+			updateObj = append(updateObj, bson.E{Key: "price", Value: price})
+		}
+
+		if bundle.Slots != nil {
+			if err := validate.Var(bundle.Slots, "min=1,dive"); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error":err.Error()})
+				return
+			}
+
+			updateObj = append(updateObj, bson.E{Key: "slots", Value: bundle.Slots})
+		}
+
+		bundle.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		updateObj = append(updateObj, bson.E{Key: "updated_at", Value: bundle.Updated_at})
+
+		res, err := bundleCollection.UpdateOne(
+			ctx,
+			bson.M{"bundle_id": bundleId},
+			bson.D{{Key: "$set", Value: updateObj}},
+		)
+
+		if err != nil {
+			msg := fmt.Sprintf("Bundle update failed")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+			return
+		}
+
+		c.JSON(http.StatusOK, res)
+	}
+}
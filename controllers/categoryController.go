@@ -0,0 +1,419 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lackingworth/Go-Restaurant-Management/database"
+	helper "github.com/lackingworth/Go-Restaurant-Management/helpers"
+	"github.com/lackingworth/Go-Restaurant-Management/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type CategoryNode struct {
+	Category_id		string				`json:"category_id"`
+	Name			string				`json:"name"`
+	Position		int					`json:"position"`
+	Foods			[]models.Food		`json:"foods"`
+	Subcategories	[]*CategoryNode		`json:"subcategories"`
+}
+
+type MenuDocument struct {
+	models.Menu
+	Sections		[]*CategoryNode		`json:"sections"`
+	Foods			[]models.Food		`json:"foods"`
+}
+
+type MenuOrder struct {
+	Categories		[]struct {
+		Category_id		string		`json:"category_id" validate:"required"`
+		Position		int			`json:"position"`
+	}								`json:"categories" validate:"dive"`
+	Foods			[]struct {
+		Food_id			string		`json:"food_id" validate:"required"`
+		Position		int			`json:"position"`
+	}								`json:"foods" validate:"dive"`
+}
+
+var categoryCollection *mongo.Collection = database.OpenCollection(database.Client, "category")
+
+func position(p *int) int {
+	if p == nil {
+		return 0
+	}
+
+	return *p
+}
+
+// Checks that the parent belongs to the same menu and that the category
+// would not become its own ancestor
+func checkCategoryParent(ctx context.Context, categoryId string, menuId string, parentId string) error {
+	for depth, id := 0, parentId; id != ""; depth++ {
+		var parent models.Category
+
+		if id == categoryId || depth > 32 {
+			return fmt.Errorf("Category cannot be nested below itself")
+		}
+
+		err := categoryCollection.FindOne(ctx, bson.M{"category_id": id}).Decode(&parent)
+
+		if err != nil {
+			return fmt.Errorf("Parent category %s was not found", id)
+		}
+
+		if parent.Menu_id == nil || *parent.Menu_id != menuId {
+			return fmt.Errorf("Parent category %s belongs to another menu", id)
+		}
+
+		id = ""
+
+		if parent.Parent_id != nil {
+			id = *parent.Parent_id
+		}
+	}
+
+	return nil
+}
+
+func checkFoodCategory(ctx context.Context, categoryId string, menuId string) error {
+	count, err := categoryCollection.CountDocuments(ctx, bson.M{"category_id": categoryId, "menu_id": menuId})
+
+	if err != nil {
+		return err
+	}
+
+	if count == 0 {
+		return fmt.Errorf("Category %s was not found in menu %s", categoryId, menuId)
+	}
+
+	return nil
+}
+
+// Builds the menu with its categories nested into sections and subsections, categories and
+// foods sorted by position (then name); foods without a category are listed separately
+func BuildMenuDocument(ctx context.Context, menu models.Menu, locale string, served *helper.ServedLocales) (MenuDocument, error) {
+	document := MenuDocument{Menu: menu, Sections: []*CategoryNode{}, Foods: []models.Food{}}
+
+	res, err := categoryCollection.Find(ctx, bson.M{"menu_id": menu.Menu_id})
+
+	if err != nil {
+		return document, err
+	}
+
+	var categories []models.Category
+
+	if err = res.All(ctx, &categories); err != nil {
+		return document, err
+	}
+
+	res, err = foodCollection.Find(ctx, bson.M{"menu_id": menu.Menu_id})
+
+	if err != nil {
+		return document, err
+	}
+
+	var foods []models.Food
+
+	if err = res.All(ctx, &foods); err != nil {
+		return document, err
+	}
+
+	nodes := map[string]*CategoryNode{}
+
+	for _, category := range categories {
+		name := *category.Name
+
+		if translation, found := helper.Translate(category.Name_translations, locale, served); found {
+			name = translation
+		}
+
+		nodes[category.Category_id] = &CategoryNode{
+			Category_id: category.Category_id,
+			Name: name,
+			Position: position(category.Position),
+			Foods: []models.Food{},
+			Subcategories: []*CategoryNode{},
+		}
+	}
+
+	for _, category := range categories {
+		node := nodes[category.Category_id]
+
+		if category.Parent_id != nil && nodes[*category.Parent_id] != nil {
+			parent := nodes[*category.Parent_id]
+			parent.Subcategories = append(parent.Subcategories, node)
+		} else {
+			document.Sections = append(document.Sections, node)
+		}
+	}
+
+	for _, food := range foods {
+		if name, found := helper.Translate(food.Name_translations, locale, served); found {
+			food.Name = &name
+		}
+
+		if food.Category_id != nil && nodes[*food.Category_id] != nil {
+			node := nodes[*food.Category_id]
+			node.Foods = append(node.Foods, food)
+		} else {
+			document.Foods = append(document.Foods, food)
+		}
+	}
+
+	sortFoods := func(foods []models.Food) {
+		sort.SliceStable(foods, func(i, j int) bool {
+			if position(foods[i].Position) != position(foods[j].Position) {
+				return position(foods[i].Position) < position(foods[j].Position)
+			}
+
+			return *foods[i].Name < *foods[j].Name
+		})
+	}
+
+	var sortNodes func(nodes []*CategoryNode)
+
+	sortNodes = func(nodes []*CategoryNode) {
+		sort.SliceStable(nodes, func(i, j int) bool {
+			if nodes[i].Position != nodes[j].Position {
+				return nodes[i].Position < nodes[j].Position
+			}
+
+			return nodes[i].Name < nodes[j].Name
+		})
+
+		for _, node := range nodes {
+			sortFoods(node.Foods)
+			sortNodes(node.Subcategories)
+		}
+	}
+
+	sortNodes(document.Sections)
+	sortFoods(document.Foods)
+
+	return document, nil
+}
+
+var categoryListSpec = helper.ListSpec{
+	Filters: map[string]helper.FieldKind{"menu_id": helper.STRING_FIELD, "parent_id": helper.STRING_FIELD},
+	Sorts: []string{"position", "name", "created_at", "updated_at"},
+	Date_field: "created_at",
+}
+
+func GetCategories() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		helper.RespondWithList(c, ctx, categoryCollection, categoryListSpec, bson.D{}, "Error occured while listing categories", nil)
+	}
+}
+
+func GetCategory() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		var category models.Category
+		categoryId := c.Param("category_id")
+		defer cancel()
+
+		err := categoryCollection.FindOne(ctx, bson.M{"category_id": categoryId}).Decode(&category)
+
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error":"Error occured while fetching the category"})
+			return
+		}
+
+		c.JSON(http.StatusOK, category)
+	}
+}
+
+func CreateCategory() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		var category models.Category
+		var menu models.Menu
+		defer cancel()
+
+		if err := c.BindJSON(&category); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error":err.Error()})
+			return
+		}
+
+		validationErr := validate.Struct(category)
+
+		if validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error":validationErr.Error()})
+			return
+		}
+
+		err := menuCollection.FindOne(ctx, bson.M{"menu_id": category.Menu_id}).Decode(&menu)
+
+		if err != nil {
+			msg := fmt.Sprintf("Menu was not found")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+			return
+		}
+
+		category.ID = primitive.NewObjectID()
+		category.Category_id = category.ID.Hex()
+
+		if category.Parent_id != nil {
+			if err := checkCategoryParent(ctx, category.Category_id, *category.Menu_id, *category.Parent_id); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
+
+		category.Created_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		category.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+
+		res, insertErr := categoryCollection.InsertOne(ctx, category)
+
+		if insertErr != nil {
+			msg := fmt.Sprintf("Category was not created")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+			return
+		}
+
+		c.JSON(http.StatusOK, res)
+	}
+}
+
+func UpdateCategory() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		var category models.Category
+		var current models.Category
+		var updateObj primitive.D
+		categoryId := c.Param("category_id")
+		defer cancel()
+
+		if err := c.BindJSON(&category); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error":err.Error()})
+			return
+		}
+
+		err := categoryCollection.FindOne(ctx, bson.M{"category_id": categoryId}).Decode(&current)
+
+		if err != nil {
+			msg := fmt.Sprintf("Category was not found")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+			return
+		}
+
+		if category.Name != nil {
+			updateObj = append(updateObj, bson.E{Key: "name", Value: category.Name})
+		}
+
+		if category.Name_translations != nil {
+			updateObj = append(updateObj, bson.E{Key: "name_translations", Value: category.Name_translations})
+		}
+
+		// An empty parent_id turns a subsection into a section
+		if category.Parent_id != nil {
+			if *category.Parent_id == "" {
+				updateObj = append(updateObj, bson.E{Key: "parent_id", Value: nil})
+			} else {
+				if err := checkCategoryParent(ctx, categoryId, *current.Menu_id, *category.Parent_id); err != nil {
+					c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+					return
+				}
+
+				updateObj = append(updateObj, bson.E{Key: "parent_id", Value: category.Parent_id})
+			}
+		}
+
+		if category.Position != nil {
+			updateObj = append(updateObj, bson.E{Key: "position", Value: category.Position})
+		}
+
+		category.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		updateObj = append(updateObj, bson.E{Key: "updated_at", Value: category.Updated_at})
+
+		res, err := categoryCollection.UpdateOne(
+			ctx,
+			bson.M{"category_id": categoryId},
+			bson.D{{Key: "$set", Value: updateObj}},
+		)
+
+		if err != nil {
+			msg := fmt.Sprintf("Category update failed")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+			return
+		}
+
+		c.JSON(http.StatusOK, res)
+	}
+}
+
+// Sets the display positions of several categories and foods of a menu at once
+func UpdateMenuOrder() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		var order MenuOrder
+		menuId := c.Param("menu_id")
+		defer cancel()
+
+		if err := c.BindJSON(&order); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error":err.Error()})
+			return
+		}
+
+		validationErr := validate.Struct(order)
+
+		if validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error":validationErr.Error()})
+			return
+		}
+
+		updatedAt, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+
+		err := database.WithTransaction(ctx, func(sessCtx mongo.SessionContext) error {
+			for _, category := range order.Categories {
+				res, err := categoryCollection.UpdateOne(
+					sessCtx,
+					bson.M{"category_id": category.Category_id, "menu_id": menuId},
+					bson.D{{Key: "$set", Value: bson.D{{Key: "position", Value: category.Position}, {Key: "updated_at", Value: updatedAt}}}},
+				)
+
+				if err != nil {
+					return err
+				}
+
+				if res.MatchedCount == 0 {
+					return fmt.Errorf("Category %s was not found in menu %s", category.Category_id, menuId)
+				}
+			}
+
+			for _, food := range order.Foods {
+				res, err := foodCollection.UpdateOne(
+					sessCtx,
+					bson.M{"food_id": food.Food_id, "menu_id": menuId},
+					bson.D{{Key: "$set", Value: bson.D{{Key: "position", Value: food.Position}, {Key: "updated_at", Value: updatedAt}}}},
+				)
+
+				if err != nil {
+					return err
+				}
+
+				if res.MatchedCount == 0 {
+					return fmt.Errorf("Food item %s was not found in menu %s", food.Food_id, menuId)
+				}
+			}
+
+			return nil
+		})
+
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"categories": len(order.Categories), "foods": len(order.Foods)})
+	}
+}
@@ -0,0 +1,208 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lackingworth/Go-Restaurant-Management/events"
+	"github.com/lackingworth/Go-Restaurant-Management/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const KITCHEN_TOPIC = "kitchen"
+
+type CourseSummary struct {
+	Course				int				`json:"course"`
+	Status				string			`json:"status"`
+	Item_count			int				`json:"item_count"`
+	Fired_at			*time.Time		`json:"fired_at"`
+}
+
+// Course number from the route, 1 (starters) to 9
+func courseParam(c *gin.Context) (int, bool) {
+	course, err := strconv.Atoi(c.Param("course"))
+
+	if err != nil || course < 1 || course > 9 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "course must be a number from 1 to 9"})
+		return 0, false
+	}
+
+	return course, true
+}
+
+// Moves the items of the course from one state to the other; reports whether there were any to move
+func setCourseStatus(ctx context.Context, orderId string, course int, from string, to string) (bool, error) {
+	now, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	updateObj := bson.D{{Key: "course_status", Value: to}, {Key: "updated_at", Value: now}}
+
+	if to == "FIRED" {
+		updateObj = append(updateObj, bson.E{Key: "fired_at", Value: now})
+	} else {
+		updateObj = append(updateObj, bson.E{Key: "fired_at", Value: nil})
+	}
+
+	filter := bson.M{"order_id": orderId, "course": courseFilter(course), "course_status": from}
+
+	// Items from before courses were introduced count as fired starters
+	if from == "FIRED" {
+		filter["course_status"] = bson.M{"$in": bson.A{"FIRED", nil}}
+	}
+
+	res, err := orderItemCollection.UpdateMany(ctx, filter, bson.D{{Key: "$set", Value: updateObj}})
+
+	if err != nil {
+		return false, err
+	}
+
+	return res.ModifiedCount > 0, nil
+}
+
+// Lists the courses of the order w/ their (not voided) items and whether they are held or fired
+func GetOrderCourses() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		orderId := c.Param("order_id")
+		defer cancel()
+
+		res, err := orderItemCollection.Find(ctx, bson.M{"order_id": orderId, "adjustment": bson.M{"$ne": "VOID"}}, options.Find().SetSort(bson.D{{Key: "course", Value: 1}}))
+
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error":"Error occured while listing the courses"})
+			return
+		}
+
+		var orderItems []models.OrderItem
+
+		if err = res.All(ctx, &orderItems); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error":"Error occured while listing the courses"})
+			return
+		}
+
+		courses := []CourseSummary{}
+		index := map[int]int{}
+
+		for _, orderItem := range orderItems {
+			course := 1
+			status := "FIRED"
+
+			if orderItem.Course != nil {
+				course = *orderItem.Course
+			}
+
+			if orderItem.Course_status != "" {
+				status = orderItem.Course_status
+			}
+
+			i, ok := index[course]
+
+			if !ok {
+				i = len(courses)
+				index[course] = i
+				courses = append(courses, CourseSummary{Course: course, Status: status})
+			}
+
+			courses[i].Item_count++
+
+			// A course is only shown fired once all of its items are
+			if status == "HELD" {
+				courses[i].Status = "HELD"
+			}
+
+			if orderItem.Fired_at != nil && (courses[i].Fired_at == nil || orderItem.Fired_at.After(*courses[i].Fired_at)) {
+				courses[i].Fired_at = orderItem.Fired_at
+			}
+		}
+
+		c.JSON(http.StatusOK, courses)
+	}
+}
+
+// Releases the held items of the course to the kitchen and responds w/ their ticket (?format=text for printers)
+func FireCourse() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		orderId := c.Param("order_id")
+		defer cancel()
+
+		course, ok := courseParam(c)
+
+		if !ok {
+			return
+		}
+
+		fired, err := setCourseStatus(ctx, orderId, course, "HELD", "FIRED")
+
+		if err != nil {
+			msg := fmt.Sprintf("Course could not be fired")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+			return
+		}
+
+		if !fired {
+			c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("Course %d has no held items", course)})
+			return
+		}
+
+		// The order is back on the kitchen feed until the course is prepared
+		updatedAt, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		_, err = orderCollection.UpdateOne(ctx, bson.M{"order_id": orderId}, bson.D{{Key: "$set", Value: bson.D{{Key: "ready_at", Value: nil}, {Key: "updated_at", Value: updatedAt}}}})
+
+		if err != nil {
+			msg := fmt.Sprintf("Order update failed")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+			return
+		}
+
+		ticket, err := BuildKitchenTicket(ctx, orderId, &course)
+
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error":"Error occured while building the kitchen ticket"})
+			return
+		}
+
+		events.Default.Publish(KITCHEN_TOPIC, "course_fired", ticket)
+
+		if c.Query("format") == "text" {
+			c.String(http.StatusOK, ticket.Text())
+			return
+		}
+
+		c.JSON(http.StatusOK, ticket)
+	}
+}
+
+// Holds the course again (e.g. the table is not ready for mains yet), taking it off the kitchen feed
+func HoldCourse() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		orderId := c.Param("order_id")
+		defer cancel()
+
+		course, ok := courseParam(c)
+
+		if !ok {
+			return
+		}
+
+		held, err := setCourseStatus(ctx, orderId, course, "FIRED", "HELD")
+
+		if err != nil {
+			msg := fmt.Sprintf("Course could not be held")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+			return
+		}
+
+		if !held {
+			c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("Course %d has no fired items", course)})
+			return
+		}
+
+		events.Default.Publish(KITCHEN_TOPIC, "course_held", gin.H{"order_id": orderId, "course": course})
+		c.JSON(http.StatusOK, gin.H{"order_id": orderId, "course": course, "status": "HELD"})
+	}
+}
@@ -0,0 +1,728 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lackingworth/Go-Restaurant-Management/database"
+	"github.com/lackingworth/Go-Restaurant-Management/events"
+	helper "github.com/lackingworth/Go-Restaurant-Management/helpers"
+	"github.com/lackingworth/Go-Restaurant-Management/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const DELIVERY_TOPIC = "deliveries"
+
+const EARTH_RADIUS_KM = 6371.0
+
+type DeliveryAssignment struct {
+	Driver_id			*string		`json:"driver_id" validate:"required"`
+}
+
+type DeliveryStatusChange struct {
+	Status				string		`json:"status" validate:"eq=PICKED_UP|eq=DELIVERED|eq=CANCELLED"`
+	Reason				*string		`json:"reason" validate:"omitempty,max=500"`
+}
+
+type DeliveryQuote struct {
+	Zone				*models.DeliveryZone	`json:"zone"`
+	Fee					*float64				`json:"fee"`
+	Minimum_order		*float64				`json:"minimum_order"`
+	Deliverable			bool					`json:"deliverable"`
+}
+
+var deliveryZoneCollection *mongo.Collection = database.OpenCollection(database.Client, "deliveryZone")
+var driverCollection *mongo.Collection = database.OpenCollection(database.Client, "driver")
+var deliveryCollection *mongo.Collection = database.OpenCollection(database.Client, "delivery")
+
+var deliveryZoneListSpec = helper.ListSpec{
+	Filters: map[string]helper.FieldKind{"shape": helper.STRING_FIELD, "active": helper.BOOL_FIELD, "name": helper.STRING_FIELD},
+	Sorts: []string{"fee", "name", "created_at", "updated_at"},
+	Date_field: "created_at",
+}
+
+var driverListSpec = helper.ListSpec{
+	Filters: map[string]helper.FieldKind{"status": helper.STRING_FIELD, "vehicle": helper.STRING_FIELD, "phone": helper.STRING_FIELD},
+	Sorts: []string{"last_name", "first_name", "created_at", "updated_at"},
+	Date_field: "created_at",
+}
+
+var deliveryListSpec = helper.ListSpec{
+	Filters: map[string]helper.FieldKind{"status": helper.STRING_FIELD, "driver_id": helper.STRING_FIELD, "order_id": helper.STRING_FIELD, "zone_id": helper.STRING_FIELD},
+	Sorts: []string{"-assigned_at", "picked_up_at", "delivered_at"},
+	Date_field: "assigned_at",
+}
+
+var ACTIVE_DELIVERY_STATUSES = []string{"ASSIGNED", "PICKED_UP"}
+
+var errOutsideDeliveryZones = errors.New("Delivery location is outside of all delivery zones")
+
+// Location of the restaurant from the RESTAURANT_LAT / RESTAURANT_LNG env variables, the default center of radius zones
+func restaurantLocation() *models.GeoPoint {
+	lat, latErr := strconv.ParseFloat(os.Getenv("RESTAURANT_LAT"), 64)
+	lng, lngErr := strconv.ParseFloat(os.Getenv("RESTAURANT_LNG"), 64)
+
+	if latErr != nil || lngErr != nil {
+		return nil
+	}
+
+	return &models.GeoPoint{Lat: lat, Lng: lng}
+}
+
+// Great-circle distance between the points
+func distanceKm(a models.GeoPoint, b models.GeoPoint) float64 {
+	toRad := func(deg float64) float64 { return deg * math.Pi / 180 }
+
+	dLat := toRad(b.Lat - a.Lat)
+	dLng := toRad(b.Lng - a.Lng)
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(toRad(a.Lat))*math.Cos(toRad(b.Lat))*math.Sin(dLng/2)*math.Sin(dLng/2)
+
+	return 2 * EARTH_RADIUS_KM * math.Asin(math.Sqrt(h))
+}
+
+// Ray casting; zones are small enough to treat lat / lng as plane coordinates
+func insidePolygon(point models.GeoPoint, polygon []models.GeoPoint) bool {
+	inside := false
+
+	for i, j := 0, len(polygon)-1; i < len(polygon); j, i = i, i+1 {
+		a, b := polygon[i], polygon[j]
+
+		if (a.Lat > point.Lat) != (b.Lat > point.Lat) && point.Lng < (b.Lng-a.Lng)*(point.Lat-a.Lat)/(b.Lat-a.Lat)+a.Lng {
+			inside = !inside
+		}
+	}
+
+	return inside
+}
+
+func zoneContains(zone models.DeliveryZone, point models.GeoPoint) bool {
+	if zone.Shape == "POLYGON" {
+		return insidePolygon(point, zone.Polygon)
+	}
+
+	center := zone.Center
+
+	if center == nil {
+		center = restaurantLocation()
+	}
+
+	return center != nil && zone.Radius_km != nil && distanceKm(*center, point) <= *zone.Radius_km
+}
+
+// Cheapest active zone the point lies in; nil if it is not delivered to
+func resolveDeliveryZone(ctx context.Context, point models.GeoPoint) (*models.DeliveryZone, error) {
+	res, err := deliveryZoneCollection.Find(ctx, bson.M{"active": bson.M{"$ne": false}}, options.Find().SetSort(bson.D{{Key: "fee", Value: 1}}))
+
+	if err != nil {
+		return nil, err
+	}
+
+	var zones []models.DeliveryZone
+
+	if err = res.All(ctx, &zones); err != nil {
+		return nil, err
+	}
+
+	for _, zone := range zones {
+		if zoneContains(zone, point) {
+			return &zone, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// Sets the zone and fee of a delivery order from its location; other order types are left as they are
+func applyDeliveryZone(ctx context.Context, order *models.Order) (int, error) {
+	if order.Order_type != "DELIVERY" {
+		return http.StatusOK, nil
+	}
+
+	if order.Delivery_location == nil {
+		return http.StatusBadRequest, fmt.Errorf("delivery_location is required for delivery orders")
+	}
+
+	zone, err := resolveDeliveryZone(ctx, *order.Delivery_location)
+
+	if err != nil {
+		return http.StatusInternalServerError, fmt.Errorf("Delivery zones could not be loaded")
+	}
+
+	if zone == nil {
+		return http.StatusUnprocessableEntity, errOutsideDeliveryZones
+	}
+
+	order.Delivery_zone_id = &zone.Zone_id
+	order.Delivery_fee = zone.Fee
+
+	return http.StatusOK, nil
+}
+
+// Checks the value of the items against the minimum order of the order's delivery zone
+func checkMinimumOrder(ctx context.Context, order models.Order, itemsTotal float64) error {
+	var zone models.DeliveryZone
+
+	if order.Delivery_zone_id == nil {
+		return nil
+	}
+
+	if err := deliveryZoneCollection.FindOne(ctx, bson.M{"zone_id": order.Delivery_zone_id}).Decode(&zone); err != nil {
+		return nil
+	}
+
+	if zone.Minimum_order != nil && itemsTotal < *zone.Minimum_order {
+		return fmt.Errorf("Minimum order for delivery to %s is %.2f, the order is %.2f", *zone.Name, *zone.Minimum_order, itemsTotal)
+	}
+
+	return nil
+}
+
+// Sum of the unit prices of the order's items (voided and comped ones are not billed)
+func orderItemsTotal(ctx context.Context, orderId string) (float64, error) {
+	groupStage := bson.D{{Key: "$group", Value: bson.D{{Key: "_id", Value: nil}, {Key: "total", Value: bson.D{{Key: "$sum", Value: "$unit_price"}}}} /*end*/}}
+	res, err := orderItemCollection.Aggregate(ctx, mongo.Pipeline{bson.D{{Key: "$match", Value: bson.D{{Key: "order_id", Value: orderId}, {Key: "adjustment", Value: nil}}}}, groupStage})
+
+	if err != nil {
+		return 0, err
+	}
+
+	var totals []struct {
+		Total	float64		`bson:"total"`
+	}
+
+	if err = res.All(ctx, &totals); err != nil || len(totals) == 0 {
+		return 0, err
+	}
+
+	return totals[0].Total, nil
+}
+
+// Drivers w/ deliveries in progress are ON_DELIVERY, the others AVAILABLE; OFF_DUTY drivers stay off duty
+func syncDriverStatus(ctx context.Context, driverId string) {
+	active, err := deliveryCollection.CountDocuments(ctx, bson.M{"driver_id": driverId, "status": bson.M{"$in": ACTIVE_DELIVERY_STATUSES}})
+
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	status := "AVAILABLE"
+
+	if active > 0 {
+		status = "ON_DELIVERY"
+	}
+
+	updatedAt, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	_, err = driverCollection.UpdateOne(
+		ctx,
+		bson.M{"driver_id": driverId, "status": bson.M{"$ne": "OFF_DUTY"}},
+		bson.D{{Key: "$set", Value: bson.D{{Key: "status", Value: status}, {Key: "updated_at", Value: updatedAt}}}},
+	)
+
+	if err != nil {
+		log.Println(err)
+	}
+}
+
+func checkDeliveryZone(zone models.DeliveryZone) error {
+	if zone.Shape == "RADIUS" && zone.Center == nil && restaurantLocation() == nil {
+		return fmt.Errorf("center is required when RESTAURANT_LAT / RESTAURANT_LNG are not set")
+	}
+
+	return nil
+}
+
+func GetDeliveryZones() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		helper.RespondWithList(c, ctx, deliveryZoneCollection, deliveryZoneListSpec, bson.D{}, "Error occured while listing delivery zones", nil)
+	}
+}
+
+func CreateDeliveryZone() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		var zone models.DeliveryZone
+		defer cancel()
+
+		if err := c.BindJSON(&zone); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error":err.Error()})
+			return
+		}
+
+		validationErr := validate.Struct(zone)
+
+		if validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error":validationErr.Error()})
+			return
+		}
+
+		if err := checkDeliveryZone(zone); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if zone.Active == nil {
+			active := true
+			zone.Active = &active
+		}
+
+		zone.Created_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		zone.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		zone.ID = primitive.NewObjectID()
+		zone.Zone_id = zone.ID.Hex()
+
+		_, insertErr := deliveryZoneCollection.InsertOne(ctx, zone)
+
+		if insertErr != nil {
+			msg := fmt.Sprintf("Delivery zone was not created")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+			return
+		}
+
+		c.JSON(http.StatusOK, zone)
+	}
+}
+
+// Updates the zone; orders already placed keep the fee they were quoted
+func UpdateDeliveryZone() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		var zone models.DeliveryZone
+		var current models.DeliveryZone
+		zoneId := c.Param("zone_id")
+		defer cancel()
+
+		if err := deliveryZoneCollection.FindOne(ctx, bson.M{"zone_id": zoneId}).Decode(&current); err != nil {
+			msg := fmt.Sprintf("Delivery zone was not found")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+			return
+		}
+
+		if err := c.BindJSON(&zone); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error":err.Error()})
+			return
+		}
+
+		if zone.Name != nil {
+			current.Name = zone.Name
+		}
+
+		if zone.Shape != "" {
+			current.Shape = zone.Shape
+		}
+
+		if zone.Center != nil {
+			current.Center = zone.Center
+		}
+
+		if zone.Radius_km != nil {
+			current.Radius_km = zone.Radius_km
+		}
+
+		if zone.Polygon != nil {
+			current.Polygon = zone.Polygon
+		}
+
+		if zone.Fee != nil {
+			current.Fee = zone.Fee
+		}
+
+		if zone.Minimum_order != nil {
+			current.Minimum_order = zone.Minimum_order
+		}
+
+		if zone.Active != nil {
+			current.Active = zone.Active
+		}
+
+		validationErr := validate.Struct(current)
+
+		if validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error":validationErr.Error()})
+			return
+		}
+
+		if err := checkDeliveryZone(current); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		current.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+
+		_, err := deliveryZoneCollection.ReplaceOne(ctx, bson.M{"zone_id": zoneId}, current)
+
+		if err != nil {
+			msg := fmt.Sprintf("Delivery zone update failed")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+			return
+		}
+
+		c.JSON(http.StatusOK, current)
+	}
+}
+
+// Quotes the zone, fee and minimum order for ?lat=&lng= (e.g. while taking an order on the phone)
+func GetDeliveryQuote() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		lat, latErr := strconv.ParseFloat(c.Query("lat"), 64)
+		lng, lngErr := strconv.ParseFloat(c.Query("lng"), 64)
+		point := models.GeoPoint{Lat: lat, Lng: lng}
+
+		if latErr != nil || lngErr != nil || validate.Struct(point) != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "lat and lng must be valid coordinates"})
+			return
+		}
+
+		zone, err := resolveDeliveryZone(ctx, point)
+
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error":"Delivery zones could not be loaded"})
+			return
+		}
+
+		quote := DeliveryQuote{Zone: zone, Deliverable: zone != nil}
+
+		if zone != nil {
+			quote.Fee = zone.Fee
+			quote.Minimum_order = zone.Minimum_order
+		}
+
+		c.JSON(http.StatusOK, quote)
+	}
+}
+
+func GetDrivers() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		helper.RespondWithList(c, ctx, driverCollection, driverListSpec, bson.D{}, "Error occured while listing drivers", nil)
+	}
+}
+
+func CreateDriver() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		var driver models.Driver
+		defer cancel()
+
+		if err := c.BindJSON(&driver); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error":err.Error()})
+			return
+		}
+
+		if driver.Status == "" || driver.Status == "ON_DELIVERY" {
+			driver.Status = "AVAILABLE"
+		}
+
+		validationErr := validate.Struct(driver)
+
+		if validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error":validationErr.Error()})
+			return
+		}
+
+		if driver.User_id != nil {
+			count, err := userCollection.CountDocuments(ctx, bson.M{"user_id": driver.User_id})
+
+			if err != nil || count == 0 {
+				msg := fmt.Sprintf("User was not found")
+				c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+				return
+			}
+		}
+
+		driver.Created_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		driver.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		driver.ID = primitive.NewObjectID()
+		driver.Driver_id = driver.ID.Hex()
+
+		_, insertErr := driverCollection.InsertOne(ctx, driver)
+
+		if insertErr != nil {
+			msg := fmt.Sprintf("Driver was not created")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+			return
+		}
+
+		c.JSON(http.StatusOK, driver)
+	}
+}
+
+// Updates driver details or takes the driver on / off duty (status AVAILABLE / OFF_DUTY)
+func UpdateDriver() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		var driver models.Driver
+		var updateObj primitive.D
+		driverId := c.Param("driver_id")
+		defer cancel()
+
+		if err := c.BindJSON(&driver); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error":err.Error()})
+			return
+		}
+
+		if driver.First_name != nil {
+			updateObj = append(updateObj, bson.E{Key: "first_name", Value: driver.First_name})
+		}
+
+		if driver.Last_name != nil {
+			updateObj = append(updateObj, bson.E{Key: "last_name", Value: driver.Last_name})
+		}
+
+		if driver.Phone != nil {
+			updateObj = append(updateObj, bson.E{Key: "phone", Value: driver.Phone})
+		}
+
+		if driver.Vehicle != nil {
+			if err := validate.Var(*driver.Vehicle, "eq=BIKE|eq=SCOOTER|eq=CAR"); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "vehicle must be BIKE, SCOOTER or CAR"})
+				return
+			}
+
+			updateObj = append(updateObj, bson.E{Key: "vehicle", Value: driver.Vehicle})
+		}
+
+		if driver.User_id != nil {
+			updateObj = append(updateObj, bson.E{Key: "user_id", Value: driver.User_id})
+		}
+
+		if driver.Status != "" {
+			if err := validate.Var(driver.Status, "eq=AVAILABLE|eq=OFF_DUTY"); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "status can only be set to AVAILABLE or OFF_DUTY"})
+				return
+			}
+
+			updateObj = append(updateObj, bson.E{Key: "status", Value: driver.Status})
+		}
+
+		driver.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		updateObj = append(updateObj, bson.E{Key: "updated_at", Value: driver.Updated_at})
+
+		res, err := driverCollection.UpdateOne(ctx, bson.M{"driver_id": driverId}, bson.D{{Key: "$set", Value: updateObj}})
+
+		if err != nil {
+			msg := fmt.Sprintf("Driver update failed")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+			return
+		}
+
+		// Drivers back on duty w/ deliveries in progress are still on delivery
+		if driver.Status == "AVAILABLE" {
+			syncDriverStatus(ctx, driverId)
+		}
+
+		c.JSON(http.StatusOK, res)
+	}
+}
+
+func GetDeliveries() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		helper.RespondWithList(c, ctx, deliveryCollection, deliveryListSpec, bson.D{}, "Error occured while listing deliveries", nil)
+	}
+}
+
+// Hands the delivery order to a driver; a delivery not picked up yet is reassigned
+func AssignDelivery() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		var assignment DeliveryAssignment
+		var order models.Order
+		var driver models.Driver
+		var current models.Delivery
+		orderId := c.Param("order_id")
+		defer cancel()
+
+		if err := c.BindJSON(&assignment); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error":err.Error()})
+			return
+		}
+
+		validationErr := validate.Struct(assignment)
+
+		if validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error":validationErr.Error()})
+			return
+		}
+
+		if err := orderCollection.FindOne(ctx, bson.M{"order_id": orderId}).Decode(&order); err != nil {
+			msg := fmt.Sprintf("Order was not found")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+			return
+		}
+
+		if order.Order_type != "DELIVERY" || order.Merged_into != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Only open delivery orders can be assigned to a driver"})
+			return
+		}
+
+		if err := driverCollection.FindOne(ctx, bson.M{"driver_id": assignment.Driver_id}).Decode(&driver); err != nil {
+			msg := fmt.Sprintf("Driver was not found")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+			return
+		}
+
+		if driver.Status == "OFF_DUTY" {
+			c.JSON(http.StatusConflict, gin.H{"error": "Driver is off duty"})
+			return
+		}
+
+		itemsTotal, err := orderItemsTotal(ctx, orderId)
+
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error":"Error occured while totalling the order"})
+			return
+		}
+
+		if err := checkMinimumOrder(ctx, order, itemsTotal); err != nil {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+			return
+		}
+
+		reassigned := deliveryCollection.FindOne(ctx, bson.M{"order_id": orderId, "status": bson.M{"$in": ACTIVE_DELIVERY_STATUSES}}).Decode(&current) == nil
+
+		if reassigned && current.Status != "ASSIGNED" {
+			c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("Delivery is already %s", current.Status)})
+			return
+		}
+
+		now, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		delivery := models.Delivery{Order_id: orderId, Driver_id: &driver.Driver_id, Zone_id: order.Delivery_zone_id, Fee: order.Delivery_fee, Status: "ASSIGNED", Assigned_at: now}
+		delivery.Created_at = now
+		delivery.Updated_at = now
+		delivery.ID = primitive.NewObjectID()
+		delivery.Delivery_id = delivery.ID.Hex()
+
+		err = database.WithTransaction(ctx, func(sessCtx mongo.SessionContext) error {
+			if reassigned {
+				reason := fmt.Sprintf("Reassigned to driver %s", driver.Driver_id)
+				_, err := deliveryCollection.UpdateOne(
+					sessCtx,
+					bson.M{"delivery_id": current.Delivery_id, "status": "ASSIGNED"},
+					bson.D{{Key: "$set", Value: bson.D{{Key: "status", Value: "CANCELLED"}, {Key: "cancelled_at", Value: now}, {Key: "reason", Value: reason}, {Key: "updated_at", Value: now}}}},
+				)
+
+				if err != nil {
+					return err
+				}
+			}
+
+			_, err := deliveryCollection.InsertOne(sessCtx, delivery)
+
+			return err
+		})
+
+		if err != nil {
+			msg := fmt.Sprintf("Delivery was not assigned")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+			return
+		}
+
+		if reassigned {
+			syncDriverStatus(ctx, *current.Driver_id)
+		}
+
+		syncDriverStatus(ctx, driver.Driver_id)
+		events.Default.Publish(DELIVERY_TOPIC, "delivery_assigned", delivery)
+		c.JSON(http.StatusOK, delivery)
+	}
+}
+
+// Moves the delivery on: ASSIGNED -> PICKED_UP -> DELIVERED, or CANCELLED before it is delivered
+func UpdateDeliveryStatus() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		var change DeliveryStatusChange
+		var delivery models.Delivery
+		deliveryId := c.Param("delivery_id")
+		defer cancel()
+
+		if err := c.BindJSON(&change); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error":err.Error()})
+			return
+		}
+
+		validationErr := validate.Struct(change)
+
+		if validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error":validationErr.Error()})
+			return
+		}
+
+		if err := deliveryCollection.FindOne(ctx, bson.M{"delivery_id": deliveryId}).Decode(&delivery); err != nil {
+			msg := fmt.Sprintf("Delivery was not found")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+			return
+		}
+
+		from := map[string]string{"PICKED_UP": "ASSIGNED", "DELIVERED": "PICKED_UP"}[change.Status]
+
+		if (from != "" && delivery.Status != from) || (change.Status == "CANCELLED" && !contains(ACTIVE_DELIVERY_STATUSES, delivery.Status)) {
+			c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("Delivery is %s and cannot become %s", delivery.Status, change.Status)})
+			return
+		}
+
+		now, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		updateObj := bson.D{{Key: "status", Value: change.Status}, {Key: "updated_at", Value: now}}
+
+		switch change.Status {
+		case "PICKED_UP":
+			updateObj = append(updateObj, bson.E{Key: "picked_up_at", Value: now})
+		case "DELIVERED":
+			updateObj = append(updateObj, bson.E{Key: "delivered_at", Value: now})
+		case "CANCELLED":
+			updateObj = append(updateObj, bson.E{Key: "cancelled_at", Value: now}, bson.E{Key: "reason", Value: change.Reason})
+		}
+
+		res, err := deliveryCollection.UpdateOne(ctx, bson.M{"delivery_id": deliveryId, "status": delivery.Status}, bson.D{{Key: "$set", Value: updateObj}})
+
+		if err != nil {
+			msg := fmt.Sprintf("Delivery update failed")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+			return
+		}
+
+		if res.MatchedCount == 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "Delivery was changed in the meantime"})
+			return
+		}
+
+		// A picked up order has left the kitchen
+		if change.Status == "PICKED_UP" {
+			_, err := orderCollection.UpdateOne(ctx, bson.M{"order_id": delivery.Order_id, "ready_at": nil}, bson.D{{Key: "$set", Value: bson.D{{Key: "ready_at", Value: now}, {Key: "updated_at", Value: now}}}})
+
+			if err != nil {
+				log.Println(err)
+			}
+		}
+
+		if change.Status != "CANCELLED" {
+			pushAggregatorStatus(ctx, delivery.Order_id, change.Status)
+		}
+
+		syncDriverStatus(ctx, *delivery.Driver_id)
+		events.Default.Publish(DELIVERY_TOPIC, "delivery_status", gin.H{"delivery_id": deliveryId, "order_id": delivery.Order_id, "status": change.Status})
+		c.JSON(http.StatusOK, gin.H{"delivery_id": deliveryId, "status": change.Status, "updated_at": now})
+	}
+}
@@ -0,0 +1,569 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lackingworth/Go-Restaurant-Management/database"
+	helper "github.com/lackingworth/Go-Restaurant-Management/helpers"
+	"github.com/lackingworth/Go-Restaurant-Management/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type SectionPlan struct {
+	models.Section
+	Server_id		*string				`json:"server_id"`
+	Shift_end		*time.Time			`json:"shift_end"`
+}
+
+type FloorPlan struct {
+	models.Area
+	Sections		[]SectionPlan		`json:"sections"`
+	Tables			[]models.Table		`json:"tables"`
+}
+
+type TablePlacement struct {
+	Table_id		string					`json:"table_id" validate:"required"`
+	Section_id		*string					`json:"section_id"`
+	Seats			*int					`json:"seats" validate:"omitempty,gt=0"`
+	Layout			*models.TableLayout		`json:"layout"`
+}
+
+type AreaLayout struct {
+	Tables			[]TablePlacement		`json:"tables" validate:"required,dive"`
+}
+
+var areaCollection *mongo.Collection = database.OpenCollection(database.Client, "area")
+var sectionCollection *mongo.Collection = database.OpenCollection(database.Client, "section")
+var assignmentCollection *mongo.Collection = database.OpenCollection(database.Client, "sectionAssignment")
+
+var areaListSpec = helper.ListSpec{
+	Filters: map[string]helper.FieldKind{"name": helper.STRING_FIELD},
+	Sorts: []string{"position", "name", "created_at", "updated_at"},
+	Date_field: "created_at",
+}
+
+var sectionListSpec = helper.ListSpec{
+	Filters: map[string]helper.FieldKind{"area_id": helper.STRING_FIELD, "name": helper.STRING_FIELD},
+	Sorts: []string{"name", "created_at", "updated_at"},
+	Date_field: "created_at",
+}
+
+var assignmentListSpec = helper.ListSpec{
+	Filters: map[string]helper.FieldKind{"section_id": helper.STRING_FIELD, "server_id": helper.STRING_FIELD},
+	Sorts: []string{"-shift_start", "shift_end", "created_at"},
+	Date_field: "shift_start",
+}
+
+func checkTableArea(ctx context.Context, areaId string) error {
+	count, err := areaCollection.CountDocuments(ctx, bson.M{"area_id": areaId})
+
+	if err != nil || count == 0 {
+		return fmt.Errorf("Area %s was not found", areaId)
+	}
+
+	return nil
+}
+
+// Matches the table if its section is not one of the area's, i.e. the table was moved to the area
+// w/o a new section and has to leave the old one
+func foreignSectionFilter(ctx context.Context, tableId string, areaId string) (bson.M, error) {
+	sectionIds := bson.A{nil}
+	res, err := sectionCollection.Find(ctx, bson.M{"area_id": areaId})
+
+	if err != nil {
+		return nil, err
+	}
+
+	var sections []models.Section
+
+	if err = res.All(ctx, &sections); err != nil {
+		return nil, err
+	}
+
+	for _, section := range sections {
+		sectionIds = append(sectionIds, section.Section_id)
+	}
+
+	return bson.M{"table_id": tableId, "section_id": bson.M{"$nin": sectionIds}}, nil
+}
+
+// Checks that the section exists and belongs to the area the table is placed in
+func checkTableSection(ctx context.Context, areaId *string, sectionId string) error {
+	var section models.Section
+
+	if err := sectionCollection.FindOne(ctx, bson.M{"section_id": sectionId}).Decode(&section); err != nil {
+		return fmt.Errorf("Section %s was not found", sectionId)
+	}
+
+	if areaId == nil || *section.Area_id != *areaId {
+		return fmt.Errorf("Section %s belongs to another area", sectionId)
+	}
+
+	return nil
+}
+
+// Returns the server whose shift in the table's section covers the given time, if any
+func sectionServer(ctx context.Context, table models.Table, at time.Time) *string {
+	var assignment models.SectionAssignment
+
+	if table.Section_id == nil {
+		return nil
+	}
+
+	filter := bson.M{"section_id": table.Section_id, "shift_start": bson.M{"$lte": at}, "shift_end": bson.M{"$gt": at}}
+	err := assignmentCollection.FindOne(ctx, filter, options.FindOne().SetSort(bson.D{{Key: "shift_start", Value: -1}})).Decode(&assignment)
+
+	if err != nil {
+		return nil
+	}
+
+	return assignment.Server_id
+}
+
+func GetAreas() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		helper.RespondWithList(c, ctx, areaCollection, areaListSpec, bson.D{}, "Error occured while listing areas", nil)
+	}
+}
+
+// Returns the floor plan of the area: its sections w/ the server currently on shift and its tables w/ their layout
+func GetArea() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		var plan FloorPlan
+		areaId := c.Param("area_id")
+		defer cancel()
+
+		err := areaCollection.FindOne(ctx, bson.M{"area_id": areaId}).Decode(&plan.Area)
+
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error":"Error occured while fetching the area"})
+			return
+		}
+
+		res, err := sectionCollection.Find(ctx, bson.M{"area_id": areaId}, options.Find().SetSort(bson.D{{Key: "name", Value: 1}}))
+
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error":"Error occured while fetching the area"})
+			return
+		}
+
+		var sections []models.Section
+
+		if err = res.All(ctx, &sections); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error":"Error occured while fetching the area"})
+			return
+		}
+
+		now := time.Now()
+		plan.Sections = []SectionPlan{}
+
+		for _, section := range sections {
+			var assignment models.SectionAssignment
+			entry := SectionPlan{Section: section}
+			filter := bson.M{"section_id": section.Section_id, "shift_start": bson.M{"$lte": now}, "shift_end": bson.M{"$gt": now}}
+
+			if assignmentCollection.FindOne(ctx, filter).Decode(&assignment) == nil {
+				entry.Server_id = assignment.Server_id
+				entry.Shift_end = assignment.Shift_end
+			}
+
+			plan.Sections = append(plan.Sections, entry)
+		}
+
+		res, err = tableCollection.Find(ctx, bson.M{"area_id": areaId}, options.Find().SetSort(bson.D{{Key: "table_number", Value: 1}}))
+
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error":"Error occured while fetching the area"})
+			return
+		}
+
+		plan.Tables = []models.Table{}
+
+		if err = res.All(ctx, &plan.Tables); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error":"Error occured while fetching the area"})
+			return
+		}
+
+		c.JSON(http.StatusOK, plan)
+	}
+}
+
+func CreateArea() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		var area models.Area
+		defer cancel()
+
+		if err := c.BindJSON(&area); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error":err.Error()})
+			return
+		}
+
+		validationErr := validate.Struct(area)
+
+		if validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error":validationErr.Error()})
+			return
+		}
+
+		area.Created_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		area.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		area.ID = primitive.NewObjectID()
+		area.Area_id = area.ID.Hex()
+
+		res, insertErr := areaCollection.InsertOne(ctx, area)
+
+		if insertErr != nil {
+			msg := fmt.Sprintf("Area was not created")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+			return
+		}
+
+		c.JSON(http.StatusOK, res)
+	}
+}
+
+func UpdateArea() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		var area models.Area
+		var updateObj primitive.D
+		areaId := c.Param("area_id")
+		defer cancel()
+
+		if err := c.BindJSON(&area); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error":err.Error()})
+			return
+		}
+
+		if area.Name != nil {
+			updateObj = append(updateObj, bson.E{Key: "name", Value: area.Name})
+		}
+
+		if area.Width != nil {
+			updateObj = append(updateObj, bson.E{Key: "width", Value: area.Width})
+		}
+
+		if area.Height != nil {
+			updateObj = append(updateObj, bson.E{Key: "height", Value: area.Height})
+		}
+
+		if area.Position != nil {
+			updateObj = append(updateObj, bson.E{Key: "position", Value: area.Position})
+		}
+
+		area.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		updateObj = append(updateObj, bson.E{Key: "updated_at", Value: area.Updated_at})
+
+		res, err := areaCollection.UpdateOne(ctx, bson.M{"area_id": areaId}, bson.D{{Key: "$set", Value: updateObj}})
+
+		if err != nil {
+			msg := fmt.Sprintf("Area update failed")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+			return
+		}
+
+		c.JSON(http.StatusOK, res)
+	}
+}
+
+// Places several tables of the area at once, as saved by the floor plan editor
+func UpdateAreaLayout() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		var layout AreaLayout
+		areaId := c.Param("area_id")
+		defer cancel()
+
+		if err := c.BindJSON(&layout); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error":err.Error()})
+			return
+		}
+
+		validationErr := validate.Struct(layout)
+
+		if validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error":validationErr.Error()})
+			return
+		}
+
+		count, err := areaCollection.CountDocuments(ctx, bson.M{"area_id": areaId})
+
+		if err != nil || count == 0 {
+			msg := fmt.Sprintf("Area was not found")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+			return
+		}
+
+		for _, placement := range layout.Tables {
+			if placement.Section_id != nil && *placement.Section_id != "" {
+				if err := checkTableSection(ctx, &areaId, *placement.Section_id); err != nil {
+					c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+					return
+				}
+			}
+		}
+
+		updatedAt, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+
+		err = database.WithTransaction(ctx, func(sessCtx mongo.SessionContext) error {
+			for _, placement := range layout.Tables {
+				updateObj := bson.D{{Key: "area_id", Value: areaId}, {Key: "updated_at", Value: updatedAt}}
+
+				// An empty section_id takes the table out of its section
+				if placement.Section_id != nil {
+					if *placement.Section_id == "" {
+						updateObj = append(updateObj, bson.E{Key: "section_id", Value: nil})
+					} else {
+						updateObj = append(updateObj, bson.E{Key: "section_id", Value: placement.Section_id})
+					}
+				}
+
+				if placement.Seats != nil {
+					updateObj = append(updateObj, bson.E{Key: "seats", Value: placement.Seats})
+				}
+
+				if placement.Layout != nil {
+					updateObj = append(updateObj, bson.E{Key: "layout", Value: placement.Layout})
+				}
+
+				res, err := tableCollection.UpdateOne(sessCtx, bson.M{"table_id": placement.Table_id}, bson.D{{Key: "$set", Value: updateObj}})
+
+				if err != nil {
+					return err
+				}
+
+				if res.MatchedCount == 0 {
+					return fmt.Errorf("Table %s was not found", placement.Table_id)
+				}
+
+				if placement.Section_id == nil {
+					filter, err := foreignSectionFilter(sessCtx, placement.Table_id, areaId)
+
+					if err != nil {
+						return err
+					}
+
+					if _, err := tableCollection.UpdateOne(sessCtx, filter, bson.D{{Key: "$set", Value: bson.D{{Key: "section_id", Value: nil}}}}); err != nil {
+						return err
+					}
+				}
+			}
+
+			return nil
+		})
+
+		if err != nil {
+			msg := fmt.Sprintf("Area layout update failed: %s", err.Error())
+			c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"area_id": areaId, "updated": len(layout.Tables)})
+	}
+}
+
+func GetSections() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		helper.RespondWithList(c, ctx, sectionCollection, sectionListSpec, bson.D{}, "Error occured while listing sections", nil)
+	}
+}
+
+func CreateSection() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		var section models.Section
+		defer cancel()
+
+		if err := c.BindJSON(&section); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error":err.Error()})
+			return
+		}
+
+		validationErr := validate.Struct(section)
+
+		if validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error":validationErr.Error()})
+			return
+		}
+
+		count, err := areaCollection.CountDocuments(ctx, bson.M{"area_id": section.Area_id})
+
+		if err != nil || count == 0 {
+			msg := fmt.Sprintf("Area was not found")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+			return
+		}
+
+		section.Created_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		section.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		section.ID = primitive.NewObjectID()
+		section.Section_id = section.ID.Hex()
+
+		res, insertErr := sectionCollection.InsertOne(ctx, section)
+
+		if insertErr != nil {
+			msg := fmt.Sprintf("Section was not created")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+			return
+		}
+
+		c.JSON(http.StatusOK, res)
+	}
+}
+
+func UpdateSection() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		var section models.Section
+		var updateObj primitive.D
+		sectionId := c.Param("section_id")
+		defer cancel()
+
+		if err := c.BindJSON(&section); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error":err.Error()})
+			return
+		}
+
+		if section.Name != nil {
+			updateObj = append(updateObj, bson.E{Key: "name", Value: section.Name})
+		}
+
+		if section.Color != nil {
+			if err := validate.Var(*section.Color, "hexcolor"); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+
+			updateObj = append(updateObj, bson.E{Key: "color", Value: section.Color})
+		}
+
+		section.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		updateObj = append(updateObj, bson.E{Key: "updated_at", Value: section.Updated_at})
+
+		res, err := sectionCollection.UpdateOne(ctx, bson.M{"section_id": sectionId}, bson.D{{Key: "$set", Value: updateObj}})
+
+		if err != nil {
+			msg := fmt.Sprintf("Section update failed")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+			return
+		}
+
+		c.JSON(http.StatusOK, res)
+	}
+}
+
+func GetSectionAssignments() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		helper.RespondWithList(c, ctx, assignmentCollection, assignmentListSpec, bson.D{}, "Error occured while listing section assignments", nil)
+	}
+}
+
+// Assigns a server to a section for a shift; a section has one server at a time
+func CreateSectionAssignment() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		var assignment models.SectionAssignment
+		defer cancel()
+
+		if err := c.BindJSON(&assignment); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error":err.Error()})
+			return
+		}
+
+		validationErr := validate.Struct(assignment)
+
+		if validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error":validationErr.Error()})
+			return
+		}
+
+		count, err := sectionCollection.CountDocuments(ctx, bson.M{"section_id": assignment.Section_id})
+
+		if err != nil || count == 0 {
+			msg := fmt.Sprintf("Section was not found")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+			return
+		}
+
+		count, err = userCollection.CountDocuments(ctx, bson.M{"user_id": assignment.Server_id})
+
+		if err != nil || count == 0 {
+			msg := fmt.Sprintf("Server was not found")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+			return
+		}
+
+		overlapping, err := assignmentCollection.CountDocuments(ctx, bson.M{
+			"section_id": assignment.Section_id,
+			"shift_start": bson.M{"$lt": assignment.Shift_end},
+			"shift_end": bson.M{"$gt": assignment.Shift_start},
+		})
+
+		if err != nil {
+			msg := fmt.Sprintf("Section assignment was not created")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+			return
+		}
+
+		if overlapping > 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "Section is already assigned for part of this shift"})
+			return
+		}
+
+		assignment.Created_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		assignment.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		assignment.ID = primitive.NewObjectID()
+		assignment.Assignment_id = assignment.ID.Hex()
+
+		res, insertErr := assignmentCollection.InsertOne(ctx, assignment)
+
+		if insertErr != nil {
+			msg := fmt.Sprintf("Section assignment was not created")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+			return
+		}
+
+		c.JSON(http.StatusOK, res)
+	}
+}
+
+func DeleteSectionAssignment() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		assignmentId := c.Param("assignment_id")
+		defer cancel()
+
+		res, err := assignmentCollection.DeleteOne(ctx, bson.M{"assignment_id": assignmentId})
+
+		if err != nil {
+			msg := fmt.Sprintf("Section assignment was not deleted")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+			return
+		}
+
+		if res.DeletedCount == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Section assignment was not found"})
+			return
+		}
+
+		c.JSON(http.StatusOK, res)
+	}
+}
@@ -2,17 +2,24 @@ package controllers
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"io"
 	"log"
 	"math"
 	"net/http"
+	"sort"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/go-playground/validator/v10"
 	"github.com/lackingworth/Go-Restaurant-Management/database"
+	helper "github.com/lackingworth/Go-Restaurant-Management/helpers"
 	"github.com/lackingworth/Go-Restaurant-Management/models"
+	"github.com/lackingworth/Go-Restaurant-Management/storage"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
@@ -31,45 +38,213 @@ func toFixed(n float64, p int) float64 {
 	return float64(round(n * output)) / output
 }
 
-func GetFoods() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
 
-		recordPerPage, err := strconv.Atoi(c.Query("recordPerPage"))
+	return false
+}
+
+func recipeIngredients(ctx context.Context, recipe []models.RecipeItem) (ingredients []models.Ingredient, err error) {
+	for _, item := range recipe {
+		var ingredient models.Ingredient
 
-		if err != nil || recordPerPage < 1 {
-			recordPerPage = 10
+		err = ingredientCollection.FindOne(ctx, bson.M{"ingredient_id": item.Ingredient_id}).Decode(&ingredient)
+
+		if err != nil {
+			return
 		}
 
-		page, err := strconv.Atoi(c.Query("page"))
+		ingredients = append(ingredients, ingredient)
+	}
+
+	return
+}
+
+// Derives the allergens a food contains and the diets it is suitable for. Allergens are the
+// declared ones plus those of every recipe ingredient; dietary tags come from the recipe
+// (a tag every ingredient carries) or, for foods without a recipe, from the declaration
+func foodTags(food models.Food, ingredients []models.Ingredient) (containsAllergens []string, suitableFor []string) {
+	containsAllergens = []string{}
+	suitableFor = []string{}
 
-		if err != nil || page < 1 {
-			page = 1
+	for _, allergen := range food.Allergens {
+		if !contains(containsAllergens, allergen) {
+			containsAllergens = append(containsAllergens, allergen)
 		}
+	}
 
-		startIndex := (page - 1) * recordPerPage
-		startIndex, err = strconv.Atoi(c.Query("startIndex"))
+	if len(ingredients) == 0 {
+		suitableFor = append(suitableFor, food.Dietary_tags...)
+	}
 
-		// MongoDB Aggregation stages for food items
-		matchStage := bson.D{{Key: "$match", Value: bson.D{{}} }}
-		groupStage := bson.D{{Key: "$group", Value: bson.D{{Key: "_id", Value: bson.D{{Key: "_id", Value: "null"}}}, {Key: "total_count", Value: bson.D{{Key: "$sum", Value: 1}}}, {Key: "data", Value: bson.D{{Key: "$push", Value: "$$ROOT"}}} }}}
-		projectStage := bson.D{{Key: "$project", Value: bson.D{{Key: "_id", Value: 0}, {Key: "total_count", Value: 1}, {Key: "food_items", Value: bson.D{{Key: "$slice", Value: []interface{}{"$data", startIndex, recordPerPage} }} }} }}		 
-			
-		res, err := foodCollection.Aggregate(ctx, mongo.Pipeline{matchStage, groupStage, projectStage})
+	for i, ingredient := range ingredients {
+		for _, allergen := range ingredient.Allergens {
+			if !contains(containsAllergens, allergen) {
+				containsAllergens = append(containsAllergens, allergen)
+			}
+		}
 
-		defer cancel()
+		if i == 0 {
+			suitableFor = append(suitableFor, ingredient.Dietary_tags...)
+			continue
+		}
+
+		var shared []string
+
+		for _, tag := range suitableFor {
+			if contains(ingredient.Dietary_tags, tag) {
+				shared = append(shared, tag)
+			}
+		}
+
+		suitableFor = append([]string{}, shared...)
+	}
+
+	if contains(containsAllergens, "GLUTEN") {
+		var glutenSafe []string
+
+		for _, tag := range suitableFor {
+			if tag != "GLUTEN_FREE" {
+				glutenSafe = append(glutenSafe, tag)
+			}
+		}
+
+		suitableFor = append([]string{}, glutenSafe...)
+	}
+
+	sort.Strings(containsAllergens)
+	sort.Strings(suitableFor)
+
+	return
+}
+
+// Computes the nutrition of one portion from the recipe; a manual override always wins.
+// Foods without a recipe or with an ingredient lacking nutrition data have no nutrition
+func foodNutrition(food models.Food, ingredients []models.Ingredient) *models.Nutrition {
+	if food.Nutrition_override != nil {
+		return food.Nutrition_override
+	}
+
+	if len(ingredients) == 0 {
+		return nil
+	}
+
+	var nutrition models.Nutrition
+
+	for i, ingredient := range ingredients {
+		if ingredient.Nutrition == nil || ingredient.Unit == nil {
+			return nil
+		}
+
+		factor := food.Recipe[i].Quantity / 100
+
+		switch *ingredient.Unit {
+		case "KG", "L":
+			factor = food.Recipe[i].Quantity * 10
+		case "PCS":
+			factor = food.Recipe[i].Quantity
+		}
+
+		nutrition.Calories += ingredient.Nutrition.Calories * factor
+		nutrition.Protein += ingredient.Nutrition.Protein * factor
+		nutrition.Carbohydrates += ingredient.Nutrition.Carbohydrates * factor
+		nutrition.Sugar += ingredient.Nutrition.Sugar * factor
+		nutrition.Fat += ingredient.Nutrition.Fat * factor
+		nutrition.Salt += ingredient.Nutrition.Salt * factor
+	}
+
+	nutrition.Calories = toFixed(nutrition.Calories, 0)
+	nutrition.Protein = toFixed(nutrition.Protein, 1)
+	nutrition.Carbohydrates = toFixed(nutrition.Carbohydrates, 1)
+	nutrition.Sugar = toFixed(nutrition.Sugar, 1)
+	nutrition.Fat = toFixed(nutrition.Fat, 1)
+	nutrition.Salt = toFixed(nutrition.Salt, 2)
+
+	return &nutrition
+}
+
+// Sets the fields derived from the recipe (allergens, diets, nutrition) on the food
+func deriveFood(ctx context.Context, food *models.Food) error {
+	ingredients, err := recipeIngredients(ctx, food.Recipe)
+
+	if err != nil {
+		return err
+	}
+
+	food.Contains, food.Suitable_for = foodTags(*food, ingredients)
+	food.Nutrition = foodNutrition(*food, ingredients)
+
+	return nil
+}
+
+// Recomputes the derived fields of the foods matching the filter
+func refreshDerivedFoods(ctx context.Context, filter bson.M) error {
+	res, err := foodCollection.Find(ctx, filter)
+
+	if err != nil {
+		return err
+	}
+
+	var foods []models.Food
+
+	if err = res.All(ctx, &foods); err != nil {
+		return err
+	}
+
+	for _, food := range foods {
+		if err := deriveFood(ctx, &food); err != nil {
+			return err
+		}
+
+		_, err = foodCollection.UpdateOne(
+			ctx,
+			bson.M{"food_id": food.Food_id},
+			bson.D{{Key: "$set", Value: bson.D{{Key: "contains", Value: food.Contains}, {Key: "suitable_for", Value: food.Suitable_for}, {Key: "nutrition", Value: food.Nutrition}}}},
+		)
 
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error":"Error occured while listing food items"})
+			return err
 		}
+	}
+
+	return nil
+}
+
+var foodListSpec = helper.ListSpec{
+	Filters: map[string]helper.FieldKind{"menu_id": helper.STRING_FIELD, "category_id": helper.STRING_FIELD},
+	Sorts: []string{"name", "price", "position", "created_at", "updated_at"},
+	Date_field: "created_at",
+}
 
-		var allFoods []bson.M
+func GetFoods() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
 
-		if err = res.All(ctx, &allFoods); err != nil {
-			log.Fatal(err)
+		filter := bson.D{}
+
+		if allergenFree := c.Query("allergen_free"); allergenFree != "" {
+			filter = append(filter, bson.E{Key: "contains", Value: bson.D{{Key: "$nin", Value: strings.Split(strings.ToUpper(allergenFree), ",")}}})
+		}
+
+		if dietary := c.Query("dietary"); dietary != "" {
+			filter = append(filter, bson.E{Key: "suitable_for", Value: bson.D{{Key: "$all", Value: strings.Split(strings.ToUpper(dietary), ",")}}})
 		}
 
-		c.JSON(http.StatusOK, allFoods[0])
+		locale := helper.RequestedLocale(c)
+		var served helper.ServedLocales
+
+		helper.RespondWithList(c, ctx, foodCollection, foodListSpec, filter, "Error occured while listing food items", func(foodItems []bson.M) {
+			for _, foodItem := range foodItems {
+				helper.LocalizeDocument(foodItem, locale, &served, "name")
+			}
+
+			c.Header("Content-Language", served.String())
+		})
 	}
 }
 
@@ -85,6 +260,14 @@ func GetFood() gin.HandlerFunc {
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error":"Error occured while fetching the food item"})
 		}
+		locale := helper.RequestedLocale(c)
+		var served helper.ServedLocales
+
+		if name, found := helper.Translate(food.Name_translations, locale, &served); found {
+			food.Name = &name
+		}
+
+		c.Header("Content-Language", served.String())
 		c.JSON(http.StatusOK, food)
 	}
 }
@@ -118,6 +301,24 @@ func CreateFood() gin.HandlerFunc {
 			return
 		}
 
+		if err := checkRecipe(ctx, food.Recipe); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if food.Category_id != nil {
+			if err := checkFoodCategory(ctx, *food.Category_id, *food.Menu_id); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
+
+		if err := deriveFood(ctx, &food); err != nil {
+			msg := fmt.Sprintf("Allergens and nutrition of the food item could not be derived")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+			return
+		}
+
 		food.Created_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
 		food.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
 		food.ID = primitive.NewObjectID()
@@ -133,6 +334,12 @@ func CreateFood() gin.HandlerFunc {
 			return
 		}
 
+		if _, err := recordPrice(ctx, food.Food_id, *food.Price, food.Created_at, true, c.GetString("uid")); err != nil {
+			msg := fmt.Sprintf("Food item was created but its price was not recorded")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+			return
+		}
+
 		defer cancel()
 		c.JSON(http.StatusOK, res)
 	}
@@ -158,7 +365,13 @@ func UpdateFood() gin.HandlerFunc {
 			updateObj = append(updateObj, bson.E{Key: "name", Value: food.Name})
 		}
 
+		if food.Description != nil {
+			updateObj = append(updateObj, bson.E{Key: "description", Value: food.Description})
+		}
+
 		if food.Price != nil {
+			var num = toFixed(*food.Price, 2)
+			food.Price = &num
 			updateObj = append(updateObj, bson.E{Key: "price", Value: food.Price})
 		}
 
@@ -176,7 +389,57 @@ func UpdateFood() gin.HandlerFunc {
 				return 
 			}
 			
-			updateObj = append(updateObj, bson.E{Key: "menu", Value: food.Menu_id})
+			updateObj = append(updateObj, bson.E{Key: "menu_id", Value: food.Menu_id})
+		}
+
+		if food.Category_id != nil {
+			var current models.Food
+			menuId := food.Menu_id
+
+			if menuId == nil && foodCollection.FindOne(ctx, bson.M{"food_id": foodId}).Decode(&current) == nil {
+				menuId = current.Menu_id
+			}
+
+			if menuId == nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Food item has no menu to categorize it in"})
+				return
+			}
+
+			if err := checkFoodCategory(ctx, *food.Category_id, *menuId); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+
+			updateObj = append(updateObj, bson.E{Key: "category_id", Value: food.Category_id})
+		}
+
+		if food.Position != nil {
+			updateObj = append(updateObj, bson.E{Key: "position", Value: food.Position})
+		}
+
+		if food.Recipe != nil {
+			if err := checkRecipe(ctx, food.Recipe); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+
+			updateObj = append(updateObj, bson.E{Key: "recipe", Value: food.Recipe})
+		}
+
+		if food.Allergens != nil {
+			updateObj = append(updateObj, bson.E{Key: "allergens", Value: food.Allergens})
+		}
+
+		if food.Name_translations != nil {
+			updateObj = append(updateObj, bson.E{Key: "name_translations", Value: food.Name_translations})
+		}
+
+		if food.Dietary_tags != nil {
+			updateObj = append(updateObj, bson.E{Key: "dietary_tags", Value: food.Dietary_tags})
+		}
+
+		if food.Nutrition_override != nil {
+			updateObj = append(updateObj, bson.E{Key: "nutrition_override", Value: food.Nutrition_override})
 		}
 
 		food.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
@@ -202,7 +465,246 @@ func UpdateFood() gin.HandlerFunc {
 			return
 		}
 
+		if err := refreshDerivedFoods(ctx, filter); err != nil {
+			msg := fmt.Sprintf("Allergens and nutrition of the food item could not be derived")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+			return
+		}
+
+		// Price changes through the food update take effect immediately but are kept in the history
+		if food.Price != nil {
+			if _, err := recordPrice(ctx, foodId, *food.Price, food.Updated_at, true, c.GetString("uid")); err != nil {
+				msg := fmt.Sprintf("Food item was updated but its price was not recorded")
+				c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+				return
+			}
+		}
+
+		defer cancel()
+		c.JSON(http.StatusOK, res)
+	}
+}
+
+// Drops the manual nutrition so it is computed from the recipe again
+func DeleteFoodNutritionOverride() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		foodId := c.Param("food_id")
 		defer cancel()
+
+		updatedAt, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		filter := bson.M{"food_id": foodId}
+
+		res, err := foodCollection.UpdateOne(ctx, filter, bson.D{{Key: "$set", Value: bson.D{{Key: "nutrition_override", Value: nil}, {Key: "updated_at", Value: updatedAt}}}})
+
+		if err != nil {
+			msg := fmt.Sprintf("Food item update failed")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+			return
+		}
+
+		if res.MatchedCount == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Food item was not found"})
+			return
+		}
+
+		if err := refreshDerivedFoods(ctx, filter); err != nil {
+			msg := fmt.Sprintf("Allergens and nutrition of the food item could not be derived")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+			return
+		}
+
 		c.JSON(http.StatusOK, res)
 	}
-}
\ No newline at end of file
+}
+
+// Stores an uploaded food image (multipart field "image") and its thumbnails in the
+// storage backend. Keys contain the content hash so the returned URLs are stable
+func UploadFoodImage() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		var food models.Food
+		foodId := c.Param("food_id")
+		defer cancel()
+
+		err := foodCollection.FindOne(ctx, bson.M{"food_id": foodId}).Decode(&food)
+
+		if err != nil {
+			msg := fmt.Sprintf("Food item was not found")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+			return
+		}
+
+		fileHeader, err := c.FormFile("image")
+
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Image file is missing"})
+			return
+		}
+
+		file, err := fileHeader.Open()
+
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Image file could not be read"})
+			return
+		}
+
+		defer file.Close()
+
+		data, err := io.ReadAll(io.LimitReader(file, helper.MAX_IMAGE_SIZE + 1))
+
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Image file could not be read"})
+			return
+		}
+
+		img, contentType, err := helper.DecodeImage(data)
+
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		sum := sha256.Sum256(data)
+		hash := hex.EncodeToString(sum[:8])
+		extension := helper.IMAGE_EXTENSIONS[contentType]
+
+		imageUrl, err := storage.Files.Save(fmt.Sprintf("foods/%s/%s.%s", foodId, hash, extension), data, contentType)
+
+		if err != nil {
+			msg := fmt.Sprintf("Image was not stored")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+			return
+		}
+
+		thumbnails := map[string]string{}
+
+		for _, width := range helper.THUMBNAIL_WIDTHS {
+			thumbnail, err := helper.EncodeImage(helper.Thumbnail(img, width), contentType)
+
+			if err != nil {
+				msg := fmt.Sprintf("Thumbnail was not created")
+				c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+				return
+			}
+
+			thumbnailUrl, err := storage.Files.Save(fmt.Sprintf("foods/%s/%s-%d.%s", foodId, hash, width, extension), thumbnail, contentType)
+
+			if err != nil {
+				msg := fmt.Sprintf("Thumbnail was not stored")
+				c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+				return
+			}
+
+			thumbnails[strconv.Itoa(width)] = thumbnailUrl
+		}
+
+		updatedAt, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		updateObj := bson.D{{Key: "food_image", Value: imageUrl}, {Key: "food_thumbnails", Value: thumbnails}, {Key: "updated_at", Value: updatedAt}}
+
+		_, err = foodCollection.UpdateOne(ctx, bson.M{"food_id": foodId}, bson.D{{Key: "$set", Value: updateObj}})
+
+		if err != nil {
+			msg := fmt.Sprintf("Food item update failed")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+			return
+		}
+
+		// The previous image and its thumbnails are deleted unless a menu version still shows them
+		current, err := versionedFoodImages(ctx, foodId)
+
+		if err != nil {
+			log.Println(err)
+			c.JSON(http.StatusOK, gin.H{"food_image": imageUrl, "food_thumbnails": thumbnails})
+			return
+		}
+
+		current[imageUrl] = true
+
+		for _, thumbnailUrl := range thumbnails {
+			current[thumbnailUrl] = true
+		}
+
+		for _, image := range storedFoodImages(food) {
+			if current[image.url] {
+				continue
+			}
+
+			if err := storage.Files.Delete(image.key); err != nil {
+				log.Println(err)
+			}
+		}
+
+		c.JSON(http.StatusOK, gin.H{"food_image": imageUrl, "food_thumbnails": thumbnails})
+	}
+}
+
+// Image / thumbnail URLs the food has in any menu version (drafts, scheduled, archived)
+func versionedFoodImages(ctx context.Context, foodId string) (map[string]bool, error) {
+	var versions []models.MenuVersion
+
+	opts := options.Find().SetProjection(bson.M{"foods": 1})
+	res, err := menuVersionCollection.Find(ctx, bson.M{"foods.food_id": foodId}, opts)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err = res.All(ctx, &versions); err != nil {
+		return nil, err
+	}
+
+	urls := map[string]bool{}
+
+	for _, version := range versions {
+		for _, food := range version.Foods {
+			if food.Food_id != foodId {
+				continue
+			}
+
+			if food.Food_image != nil {
+				urls[*food.Food_image] = true
+			}
+
+			for _, thumbnailUrl := range food.Food_thumbnails {
+				urls[thumbnailUrl] = true
+			}
+		}
+	}
+
+	return urls, nil
+}
+
+type storedImage struct {
+	url		string
+	key		string
+}
+
+// Image / thumbnail URLs of the food that point to uploads (foods/<food_id>/...), w/ their storage keys;
+// images linked from elsewhere are left alone
+func storedFoodImages(food models.Food) []storedImage {
+	urls := []string{}
+
+	if food.Food_image != nil {
+		urls = append(urls, *food.Food_image)
+	}
+
+	for _, thumbnailUrl := range food.Food_thumbnails {
+		urls = append(urls, thumbnailUrl)
+	}
+
+	prefix := fmt.Sprintf("foods/%s/", food.Food_id)
+	images := []storedImage{}
+
+	for _, imageUrl := range urls {
+		i := strings.Index(imageUrl, "/" + prefix)
+
+		if i == -1 {
+			continue
+		}
+
+		images = append(images, storedImage{url: imageUrl, key: imageUrl[i+1:]})
+	}
+
+	return images
+}
@@ -0,0 +1,615 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lackingworth/Go-Restaurant-Management/database"
+	"github.com/lackingworth/Go-Restaurant-Management/events"
+	helper "github.com/lackingworth/Go-Restaurant-Management/helpers"
+	"github.com/lackingworth/Go-Restaurant-Management/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const GUEST_ORDER_TOPIC = "guest_orders"
+
+// Guest orders wait for staff approval before they reach the order when set to "true"
+var GUEST_ORDER_APPROVAL bool = os.Getenv("GUEST_ORDER_APPROVAL") == "true"
+
+// Page of the guest ordering app the QR codes point to, the table token is appended as ?token=
+var GUEST_ORDER_URL string = os.Getenv("GUEST_ORDER_URL")
+
+type TableQRCode struct {
+	Table_id			string		`json:"table_id"`
+	Table_number		*int		`json:"table_number"`
+	Version				int			`json:"version"`
+	Token				string		`json:"token"`
+	Url					*string		`json:"url"`
+}
+
+type GuestOrderReview struct {
+	Reason				*string		`json:"reason" validate:"omitempty,max=500"`
+}
+
+var errGuestOrderReviewed = errors.New("Guest order was already reviewed")
+
+var guestOrderCollection *mongo.Collection = database.OpenCollection(database.Client, "guestOrder")
+
+var guestOrderListSpec = helper.ListSpec{
+	Filters: map[string]helper.FieldKind{"status": helper.STRING_FIELD, "table_id": helper.STRING_FIELD, "order_id": helper.STRING_FIELD},
+	Sorts: []string{"-created_at", "updated_at"},
+	Date_field: "created_at",
+}
+
+func tableQRCode(table models.Table) (code TableQRCode, err error) {
+	code = TableQRCode{Table_id: table.Table_id, Table_number: table.Table_number, Version: table.Guest_token_version}
+	code.Token, err = helper.GenerateTableToken(table.Table_id, table.Guest_token_version)
+
+	if err == nil && GUEST_ORDER_URL != "" {
+		link := fmt.Sprintf("%s?token=%s", GUEST_ORDER_URL, url.QueryEscape(code.Token))
+		code.Url = &link
+	}
+
+	return
+}
+
+// Open order of the table guests add to; nil once the last order is paid (or the table never had one)
+func guestTableOrder(ctx context.Context, tableId string) (*models.Order, error) {
+	order, invoice, err := latestTableOrder(ctx, tableId)
+
+	if err != nil || order == nil {
+		return nil, err
+	}
+
+	if invoice != nil && invoice.Payment_status != nil && *invoice.Payment_status == "PAID" {
+		return nil, nil
+	}
+
+	return order, nil
+}
+
+// Menus guests see: the ones whose start_date / end_date (when set) include now
+func activeMenuFilter(now time.Time) bson.D {
+	return bson.D{
+		{Key: "$and", Value: bson.A{
+			bson.D{{Key: "$or", Value: bson.A{bson.D{{Key: "start_date", Value: nil}}, bson.D{{Key: "start_date", Value: bson.D{{Key: "$lte", Value: now}}}}}}},
+			bson.D{{Key: "$or", Value: bson.A{bson.D{{Key: "end_date", Value: nil}}, bson.D{{Key: "end_date", Value: bson.D{{Key: "$gte", Value: now}}}}}}},
+		}},
+	}
+}
+
+// Returns the first food of the items (or of their bundle components) that is not on an active menu,
+// "" when guests may order all of them
+func foodNotOnGuestMenu(ctx context.Context, items []models.GuestOrderItem) (string, error) {
+	foodIds := []string{}
+
+	for _, item := range items {
+		if item.Food_id != nil {
+			foodIds = append(foodIds, *item.Food_id)
+		}
+
+		for _, component := range item.Components {
+			foodIds = append(foodIds, component.Food_id)
+		}
+	}
+
+	menuIds, err := menuCollection.Distinct(ctx, "menu_id", activeMenuFilter(time.Now()))
+
+	if err != nil {
+		return "", err
+	}
+
+	if menuIds == nil {
+		menuIds = []interface{}{}
+	}
+
+	onMenu, err := foodCollection.Distinct(ctx, "food_id", bson.M{"food_id": bson.M{"$in": foodIds}, "menu_id": bson.M{"$in": menuIds}})
+
+	if err != nil {
+		return "", err
+	}
+
+	found := map[string]bool{}
+
+	for _, foodId := range onMenu {
+		if id, ok := foodId.(string); ok {
+			found[id] = true
+		}
+	}
+
+	for _, foodId := range foodIds {
+		if !found[foodId] {
+			return foodId, nil
+		}
+	}
+
+	return "", nil
+}
+
+// Turns the guest order into order items of the table's open order (opening one if there is none),
+// the same way staff orders are priced and checked against the allergy profile
+func applyGuestOrder(ctx context.Context, guestOrder models.GuestOrder, reviewedBy *string) (models.GuestOrder, int, error) {
+	var table models.Table
+
+	if err := tableCollection.FindOne(ctx, bson.M{"table_id": guestOrder.Table_id}).Decode(&table); err != nil {
+		return guestOrder, http.StatusInternalServerError, fmt.Errorf("Table was not found")
+	}
+
+	order, err := guestTableOrder(ctx, guestOrder.Table_id)
+
+	if err != nil {
+		return guestOrder, http.StatusInternalServerError, fmt.Errorf("Order of the table could not be loaded")
+	}
+
+	now, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	newOrder := order == nil
+
+	if newOrder {
+		order = &models.Order{Order_Date: now, Order_type: "DINE_IN", Table_id: &table.Table_id, Server_id: sectionServer(ctx, table, now)}
+		order.Created_at = now
+		order.Updated_at = now
+		order.ID = primitive.NewObjectID()
+		order.Order_id = order.ID.Hex()
+	}
+
+	for _, allergen := range guestOrder.Allergy_profile {
+		if !contains(order.Allergy_profile, allergen) {
+			order.Allergy_profile = append(order.Allergy_profile, allergen)
+		}
+	}
+
+	// Guests only order what the guest menu shows them, bundles through their component foods
+	missing, err := foodNotOnGuestMenu(ctx, guestOrder.Items)
+
+	if err != nil {
+		return guestOrder, http.StatusInternalServerError, fmt.Errorf("Menu could not be loaded")
+	}
+
+	if missing != "" {
+		return guestOrder, http.StatusBadRequest, fmt.Errorf("Food %s is not on the menu", missing)
+	}
+
+	orderItemsToBeInserted := []interface{}{}
+	guestOrder.Order_item_ids = []string{}
+
+	for _, item := range guestOrder.Items {
+		orderItem, status, err := prepareOrderItem(ctx, *order, models.OrderItem{Food_id: item.Food_id, Bundle_id: item.Bundle_id, Components: item.Components, Quantity: item.Quantity})
+
+		if err != nil {
+			return guestOrder, status, err
+		}
+
+		orderItemsToBeInserted = append(orderItemsToBeInserted, orderItem)
+		guestOrder.Order_item_ids = append(guestOrder.Order_item_ids, orderItem.Order_item_id)
+	}
+
+	guestOrder.Status = "APPROVED"
+	guestOrder.Order_id = &order.Order_id
+	guestOrder.Reviewed_by = reviewedBy
+	guestOrder.Updated_at = now
+
+	if reviewedBy != nil {
+		guestOrder.Reviewed_at = &now
+	}
+
+	err = database.WithTransaction(ctx, func(sessCtx mongo.SessionContext) error {
+		// Approvals first move the order out of PENDING, so a concurrent approval cannot place it twice
+		if reviewedBy != nil {
+			res, err := guestOrderCollection.UpdateOne(sessCtx, bson.M{"guest_order_id": guestOrder.Guest_order_id, "status": "PENDING"}, bson.D{{Key: "$set", Value: bson.D{{Key: "status", Value: "APPROVED"}, {Key: "reviewed_by", Value: reviewedBy}, {Key: "updated_at", Value: now}}}})
+
+			if err != nil {
+				return err
+			}
+
+			if res.MatchedCount == 0 {
+				return errGuestOrderReviewed
+			}
+		}
+
+		if newOrder {
+			if _, err := orderCollection.InsertOne(sessCtx, order); err != nil {
+				return err
+			}
+		} else {
+			// New items put the order back on the kitchen feed
+			_, err := orderCollection.UpdateOne(sessCtx, bson.M{"order_id": order.Order_id}, bson.D{{Key: "$set", Value: bson.D{{Key: "allergy_profile", Value: order.Allergy_profile}, {Key: "ready_at", Value: nil}, {Key: "updated_at", Value: now}}}})
+
+			if err != nil {
+				return err
+			}
+		}
+
+		if _, err := orderItemCollection.InsertMany(sessCtx, orderItemsToBeInserted); err != nil {
+			return err
+		}
+
+		_, err := guestOrderCollection.ReplaceOne(sessCtx, bson.M{"guest_order_id": guestOrder.Guest_order_id}, guestOrder, options.Replace().SetUpsert(true))
+
+		return err
+	})
+
+	if err == errGuestOrderReviewed {
+		return guestOrder, http.StatusConflict, err
+	}
+
+	if err != nil {
+		// W/o a transaction the approval is already stored, hand the order back for review
+		if reviewedBy != nil {
+			_, revertErr := guestOrderCollection.UpdateOne(ctx, bson.M{"guest_order_id": guestOrder.Guest_order_id, "status": "APPROVED", "order_id": nil}, bson.D{{Key: "$set", Value: bson.D{{Key: "status", Value: "PENDING"}, {Key: "reviewed_by", Value: nil}}}})
+
+			if revertErr != nil {
+				log.Println(revertErr)
+			}
+		}
+
+		return guestOrder, http.StatusInternalServerError, fmt.Errorf("Guest order was not placed")
+	}
+
+	refreshOrderTable(ctx, order.Order_id)
+	events.Default.Publish(GUEST_ORDER_TOPIC, "guest_order_placed", guestOrder)
+
+	return guestOrder, http.StatusOK, nil
+}
+
+// Returns the QR code token of the table (and the link to encode if GUEST_ORDER_URL is set)
+func GetTableQRCode() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		var table models.Table
+		tableId := c.Param("table_id")
+		defer cancel()
+
+		if err := tableCollection.FindOne(ctx, bson.M{"table_id": tableId}).Decode(&table); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error":"Error occured while fetching the table"})
+			return
+		}
+
+		code, err := tableQRCode(table)
+
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error":"Table token could not be signed"})
+			return
+		}
+
+		c.JSON(http.StatusOK, code)
+	}
+}
+
+// Issues a new QR code token for the table; codes printed before stop working
+func RotateTableQRCode() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		var table models.Table
+		tableId := c.Param("table_id")
+		defer cancel()
+
+		updatedAt, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		opt := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+		err := tableCollection.FindOneAndUpdate(
+			ctx,
+			bson.M{"table_id": tableId},
+			bson.D{{Key: "$inc", Value: bson.D{{Key: "guest_token_version", Value: 1}}}, {Key: "$set", Value: bson.D{{Key: "updated_at", Value: updatedAt}}}},
+			opt,
+		).Decode(&table)
+
+		if err != nil {
+			msg := fmt.Sprintf("Table was not found")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+			return
+		}
+
+		code, err := tableQRCode(table)
+
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error":"Table token could not be signed"})
+			return
+		}
+
+		c.JSON(http.StatusOK, code)
+	}
+}
+
+// Table the guest scanned w/ its open order, if any
+func GetGuestTable() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		tableId := c.GetString("table_id")
+		defer cancel()
+
+		order, err := guestTableOrder(ctx, tableId)
+
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error":"Error occured while fetching the table"})
+			return
+		}
+
+		var orderId *string
+
+		if order != nil {
+			orderId = &order.Order_id
+		}
+
+		c.JSON(http.StatusOK, gin.H{"table_id": tableId, "table_number": c.MustGet("table_number"), "order_id": orderId, "approval_required": GUEST_ORDER_APPROVAL})
+	}
+}
+
+// Menus available right now w/ their sections and foods, in the guest's language
+func GetGuestMenu() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		res, err := menuCollection.Find(ctx, activeMenuFilter(time.Now()), options.Find().SetSort(bson.D{{Key: "name", Value: 1}}))
+
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error":"error occured while listing the menu"})
+			return
+		}
+
+		var menus []models.Menu
+
+		if err = res.All(ctx, &menus); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error":"error occured while listing the menu"})
+			return
+		}
+
+		locale := helper.RequestedLocale(c)
+		var served helper.ServedLocales
+		documents := []MenuDocument{}
+
+		for _, menu := range menus {
+			if name, found := helper.Translate(menu.Name_translations, locale, &served); found {
+				menu.Name = name
+			}
+
+			if category, found := helper.Translate(menu.Category_translations, locale, &served); found {
+				menu.Category = category
+			}
+
+			document, err := BuildMenuDocument(ctx, menu, locale, &served)
+
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error":"error occured while fetching the menu sections"})
+				return
+			}
+
+			documents = append(documents, document)
+		}
+
+		c.Header("Content-Language", served.String())
+		c.JSON(http.StatusOK, documents)
+	}
+}
+
+// Places items for the guest's table; they go straight to the table's order unless staff approval is required
+func CreateGuestOrder() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		var guestOrder models.GuestOrder
+		defer cancel()
+
+		if err := c.BindJSON(&guestOrder); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error":err.Error()})
+			return
+		}
+
+		guestOrder.Table_id = c.GetString("table_id")
+		guestOrder.Status = "PENDING"
+		guestOrder.Order_id = nil
+		guestOrder.Order_item_ids = nil
+		guestOrder.Reason = nil
+		guestOrder.Reviewed_by = nil
+		guestOrder.Reviewed_at = nil
+
+		validationErr := validate.Struct(guestOrder)
+
+		if validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error":validationErr.Error()})
+			return
+		}
+
+		guestOrder.Created_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		guestOrder.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		guestOrder.ID = primitive.NewObjectID()
+		guestOrder.Guest_order_id = guestOrder.ID.Hex()
+
+		if !GUEST_ORDER_APPROVAL {
+			placed, status, err := applyGuestOrder(ctx, guestOrder, nil)
+
+			if err != nil {
+				c.JSON(status, gin.H{"error": err.Error()})
+				return
+			}
+
+			c.JSON(http.StatusOK, placed)
+			return
+		}
+
+		_, insertErr := guestOrderCollection.InsertOne(ctx, guestOrder)
+
+		if insertErr != nil {
+			msg := fmt.Sprintf("Guest order was not created")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+			return
+		}
+
+		events.Default.Publish(GUEST_ORDER_TOPIC, "guest_order_pending", guestOrder)
+		c.JSON(http.StatusAccepted, guestOrder)
+	}
+}
+
+// Guest orders of the table's current party: pending ones and those placed on its open order
+func GetGuestTableOrders() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		tableId := c.GetString("table_id")
+		defer cancel()
+
+		order, err := guestTableOrder(ctx, tableId)
+
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error":"Error occured while listing guest orders"})
+			return
+		}
+
+		filter := bson.M{"table_id": tableId, "status": "PENDING"}
+
+		if order != nil {
+			filter = bson.M{"table_id": tableId, "created_at": bson.M{"$gte": order.Created_at}}
+		}
+
+		res, err := guestOrderCollection.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}))
+
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error":"Error occured while listing guest orders"})
+			return
+		}
+
+		guestOrders := []models.GuestOrder{}
+
+		if err = res.All(ctx, &guestOrders); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error":"Error occured while listing guest orders"})
+			return
+		}
+
+		c.JSON(http.StatusOK, guestOrders)
+	}
+}
+
+// Running bill of the table: items of the open order, the amount due and the invoice if one was issued
+func GetGuestBill() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		tableId := c.GetString("table_id")
+		defer cancel()
+
+		order, invoice, err := latestTableOrder(ctx, tableId)
+
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error":"Error occured while fetching the bill"})
+			return
+		}
+
+		if order == nil || (invoice != nil && invoice.Payment_status != nil && *invoice.Payment_status == "PAID") {
+			c.JSON(http.StatusOK, gin.H{"table_id": tableId, "order_id": nil, "payment_due": 0, "order_items": []interface{}{}})
+			return
+		}
+
+		items, err := ItemsByOrder(order.Order_id)
+
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error":"Error occured while fetching the bill"})
+			return
+		}
+
+		due, err := orderBill(ctx, *order)
+
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error":"Error occured while fetching the bill"})
+			return
+		}
+
+		bill := gin.H{"table_id": tableId, "order_id": order.Order_id, "payment_due": due.Payment_due, "delivery_fee": due.Delivery_fee, "order_items": []interface{}{}, "invoice": invoice}
+
+		if len(items) > 0 {
+			bill["total_count"] = items[0]["total_count"]
+			bill["order_items"] = items[0]["order_items"]
+		}
+
+		c.JSON(http.StatusOK, bill)
+	}
+}
+
+func GetGuestOrders() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		helper.RespondWithList(c, ctx, guestOrderCollection, guestOrderListSpec, bson.D{}, "Error occured while listing guest orders", nil)
+	}
+}
+
+// Places a pending guest order on the table's order
+func ApproveGuestOrder() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		var guestOrder models.GuestOrder
+		guestOrderId := c.Param("guest_order_id")
+		defer cancel()
+
+		err := guestOrderCollection.FindOne(ctx, bson.M{"guest_order_id": guestOrderId, "status": "PENDING"}).Decode(&guestOrder)
+
+		if err != nil {
+			msg := fmt.Sprintf("Pending guest order was not found")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+			return
+		}
+
+		reviewedBy := c.GetString("uid")
+		placed, status, err := applyGuestOrder(ctx, guestOrder, &reviewedBy)
+
+		if err != nil {
+			c.JSON(status, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, placed)
+	}
+}
+
+func RejectGuestOrder() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		var review GuestOrderReview
+		guestOrderId := c.Param("guest_order_id")
+		defer cancel()
+
+		if err := c.BindJSON(&review); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error":err.Error()})
+			return
+		}
+
+		validationErr := validate.Struct(review)
+
+		if validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error":validationErr.Error()})
+			return
+		}
+
+		reviewedAt, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		updateObj := bson.D{
+			{Key: "status", Value: "REJECTED"},
+			{Key: "reason", Value: review.Reason},
+			{Key: "reviewed_by", Value: c.GetString("uid")},
+			{Key: "reviewed_at", Value: reviewedAt},
+			{Key: "updated_at", Value: reviewedAt},
+		}
+
+		res, err := guestOrderCollection.UpdateOne(ctx, bson.M{"guest_order_id": guestOrderId, "status": "PENDING"}, bson.D{{Key: "$set", Value: updateObj}})
+
+		if err != nil {
+			msg := fmt.Sprintf("Guest order update failed")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+			return
+		}
+
+		if res.MatchedCount == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Pending guest order was not found"})
+			return
+		}
+
+		events.Default.Publish(GUEST_ORDER_TOPIC, "guest_order_rejected", gin.H{"guest_order_id": guestOrderId, "reason": review.Reason})
+		c.JSON(http.StatusOK, res)
+	}
+}
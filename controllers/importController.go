@@ -0,0 +1,676 @@
+package controllers
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lackingworth/Go-Restaurant-Management/database"
+	helper "github.com/lackingworth/Go-Restaurant-Management/helpers"
+	"github.com/lackingworth/Go-Restaurant-Management/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Columns of the CSV format, one food per row (rows w/o food_name only create or update the menu)
+var IMPORT_CSV_COLUMNS = []string{
+	"menu_name", "menu_category", "menu_start_date", "menu_end_date",
+	"food_name", "description", "price", "food_image", "allergens", "dietary_tags",
+	"calories", "protein", "carbohydrates", "sugar", "fat", "salt",
+}
+
+// Separates multiple values (allergens, dietary tags) within a CSV cell
+const CSV_LIST_SEPARATOR = ";"
+
+// Where each menu and food came from in the imported file, for the error report
+type importRows struct {
+	menus				[]string
+	foods				[][]string
+}
+
+type plannedFood struct {
+	food				models.Food
+	isNew				bool
+	priceChanged		bool
+}
+
+type plannedMenu struct {
+	menu				models.Menu
+	isNew				bool
+	foods				[]plannedFood
+}
+
+func parseNutritionColumns(value func(string) string) (*models.Nutrition, error) {
+	var nutrition models.Nutrition
+	found := false
+	targets := map[string]*float64{
+		"calories": &nutrition.Calories,
+		"protein": &nutrition.Protein,
+		"carbohydrates": &nutrition.Carbohydrates,
+		"sugar": &nutrition.Sugar,
+		"fat": &nutrition.Fat,
+		"salt": &nutrition.Salt,
+	}
+
+	for column, target := range targets {
+		if value(column) == "" {
+			continue
+		}
+
+		parsed, err := strconv.ParseFloat(value(column), 64)
+
+		if err != nil {
+			return nil, fmt.Errorf("%s is not a number", column)
+		}
+
+		*target = parsed
+		found = true
+	}
+
+	if !found {
+		return nil, nil
+	}
+
+	return &nutrition, nil
+}
+
+func splitList(value string) []string {
+	if value == "" {
+		return nil
+	}
+
+	values := []string{}
+
+	for _, part := range strings.Split(value, CSV_LIST_SEPARATOR) {
+		if part = strings.ToUpper(strings.TrimSpace(part)); part != "" {
+			values = append(values, part)
+		}
+	}
+
+	return values
+}
+
+// Groups the CSV rows by menu name. Cells that cannot be parsed are reported as row errors
+func parseImportCSV(r io.Reader) (menus []models.MenuImport, rows importRows, rowErrors []models.ImportError, err error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	// Rows w/ a different number of fields are reported on their own instead of failing the whole file
+	reader.FieldsPerRecord = -1
+
+	records, err := reader.ReadAll()
+
+	if err != nil {
+		return
+	}
+
+	if len(records) == 0 {
+		err = fmt.Errorf("CSV file is empty")
+		return
+	}
+
+	columns := map[string]int{}
+
+	for i, column := range records[0] {
+		columns[strings.ToLower(strings.TrimSpace(column))] = i
+	}
+
+	if _, found := columns["menu_name"]; !found {
+		err = fmt.Errorf("CSV file has no menu_name column")
+		return
+	}
+
+	menuIndex := map[string]int{}
+
+	for i, record := range records[1:] {
+		row := strconv.Itoa(i + 2)
+
+		if len(record) != len(records[0]) {
+			msg := fmt.Sprintf("Row has %d fields, the header has %d", len(record), len(records[0]))
+			rowErrors = append(rowErrors, models.ImportError{Row: row, Error: msg})
+			continue
+		}
+
+		value := func(column string) string {
+			if index, found := columns[column]; found {
+				return strings.TrimSpace(record[index])
+			}
+
+			return ""
+		}
+		menuName := value("menu_name")
+		foodName := value("food_name")
+		rowError := func(msg string) {
+			rowErrors = append(rowErrors, models.ImportError{Row: row, Menu: menuName, Food: foodName, Error: msg})
+		}
+
+		index, found := menuIndex[menuName]
+
+		if !found {
+			menu := models.MenuImport{Name: menuName, Category: value("menu_category")}
+
+			for column, target := range map[string]**time.Time{"menu_start_date": &menu.Start_date, "menu_end_date": &menu.End_date} {
+				if value(column) == "" {
+					continue
+				}
+
+				date, dateErr := helper.ParseDate(value(column), column == "menu_end_date")
+
+				if dateErr != nil {
+					rowError(fmt.Sprintf("%s is not a valid date, use RFC3339 or YYYY-MM-DD", column))
+					continue
+				}
+
+				*target = &date
+			}
+
+			index = len(menus)
+			menuIndex[menuName] = index
+			menus = append(menus, menu)
+			rows.menus = append(rows.menus, row)
+			rows.foods = append(rows.foods, nil)
+		}
+
+		if foodName == "" {
+			continue
+		}
+
+		food := models.FoodImport{Name: &foodName, Allergens: splitList(value("allergens")), Dietary_tags: splitList(value("dietary_tags"))}
+
+		if description := value("description"); description != "" {
+			food.Description = &description
+		}
+
+		if image := value("food_image"); image != "" {
+			food.Food_image = &image
+		}
+
+		if value("price") != "" {
+			price, parseErr := strconv.ParseFloat(value("price"), 64)
+
+			if parseErr != nil {
+				rowError("price is not a number")
+				continue
+			}
+
+			food.Price = &price
+		}
+
+		nutrition, parseErr := parseNutritionColumns(value)
+
+		if parseErr != nil {
+			rowError(parseErr.Error())
+			continue
+		}
+
+		food.Nutrition_override = nutrition
+		menus[index].Foods = append(menus[index].Foods, food)
+		rows.foods[index] = append(rows.foods[index], row)
+	}
+
+	return
+}
+
+// Matches the imported menus and foods to existing ones by name and validates the result
+// w/ the same rules as the single create / update endpoints. Nothing is written here
+func planImport(ctx context.Context, menus []models.MenuImport, rows importRows) (plan []plannedMenu, report models.ImportReport, err error) {
+	now, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	seenMenus := map[string]bool{}
+	report.Errors = []models.ImportError{}
+
+	for i, imported := range menus {
+		var planned plannedMenu
+		rowError := func(row string, food string, msg string) {
+			report.Errors = append(report.Errors, models.ImportError{Row: row, Menu: imported.Name, Food: food, Error: msg})
+		}
+
+		if seenMenus[imported.Name] {
+			rowError(rows.menus[i], "", "Menu is listed more than once")
+			continue
+		}
+
+		seenMenus[imported.Name] = true
+		findErr := menuCollection.FindOne(ctx, bson.M{"name": imported.Name}).Decode(&planned.menu)
+
+		if findErr != nil && findErr != mongo.ErrNoDocuments {
+			return nil, report, findErr
+		}
+
+		planned.isNew = findErr == mongo.ErrNoDocuments
+
+		if planned.isNew {
+			planned.menu.ID = primitive.NewObjectID()
+			planned.menu.Menu_id = planned.menu.ID.Hex()
+			planned.menu.Name = imported.Name
+			planned.menu.Created_at = now
+		}
+
+		if imported.Category != "" {
+			planned.menu.Category = imported.Category
+		}
+
+		if imported.Name_translations != nil {
+			planned.menu.Name_translations = imported.Name_translations
+		}
+
+		if imported.Category_translations != nil {
+			planned.menu.Category_translations = imported.Category_translations
+		}
+
+		if imported.Start_date != nil {
+			planned.menu.Start_Date = imported.Start_date
+		}
+
+		if imported.End_date != nil {
+			planned.menu.End_Date = imported.End_date
+		}
+
+		planned.menu.Updated_at = now
+
+		if validationErr := validate.Struct(planned.menu); validationErr != nil {
+			rowError(rows.menus[i], "", validationErr.Error())
+			continue
+		}
+
+		seenFoods := map[string]bool{}
+
+		for j, importedFood := range imported.Foods {
+			var food plannedFood
+			var livePrice *float64
+			row := rows.menus[i]
+			foodName := ""
+
+			if i < len(rows.foods) && j < len(rows.foods[i]) {
+				row = rows.foods[i][j]
+			} else {
+				row = fmt.Sprintf("%s.foods[%d]", row, j)
+			}
+
+			if importedFood.Name != nil {
+				foodName = *importedFood.Name
+			}
+
+			if seenFoods[foodName] {
+				rowError(row, foodName, "Food is listed more than once in this menu")
+				continue
+			}
+
+			seenFoods[foodName] = true
+
+			if !planned.isNew {
+				findErr := foodCollection.FindOne(ctx, bson.M{"menu_id": planned.menu.Menu_id, "name": foodName}).Decode(&food.food)
+
+				if findErr != nil && findErr != mongo.ErrNoDocuments {
+					return nil, report, findErr
+				}
+
+				food.isNew = findErr == mongo.ErrNoDocuments
+				livePrice = food.food.Price
+			} else {
+				food.isNew = true
+			}
+
+			if food.isNew {
+				food.food.ID = primitive.NewObjectID()
+				food.food.Food_id = food.food.ID.Hex()
+				food.food.Menu_id = &planned.menu.Menu_id
+				food.food.Created_at = now
+			}
+
+			food.food.Name = importedFood.Name
+
+			if importedFood.Name_translations != nil {
+				food.food.Name_translations = importedFood.Name_translations
+			}
+
+			if importedFood.Description != nil {
+				food.food.Description = importedFood.Description
+			}
+
+			if importedFood.Price != nil {
+				var num = toFixed(*importedFood.Price, 2)
+				food.food.Price = &num
+			}
+
+			if importedFood.Food_image != nil {
+				food.food.Food_image = importedFood.Food_image
+			}
+
+			if importedFood.Recipe != nil {
+				food.food.Recipe = importedFood.Recipe
+			}
+
+			if importedFood.Allergens != nil {
+				food.food.Allergens = importedFood.Allergens
+			}
+
+			if importedFood.Dietary_tags != nil {
+				food.food.Dietary_tags = importedFood.Dietary_tags
+			}
+
+			if importedFood.Nutrition_override != nil {
+				food.food.Nutrition_override = importedFood.Nutrition_override
+			}
+
+			food.food.Updated_at = now
+
+			if validationErr := validate.Struct(food.food); validationErr != nil {
+				rowError(row, foodName, validationErr.Error())
+				continue
+			}
+
+			if recipeErr := checkRecipe(ctx, food.food.Recipe); recipeErr != nil {
+				rowError(row, foodName, recipeErr.Error())
+				continue
+			}
+
+			if deriveErr := deriveFood(ctx, &food.food); deriveErr != nil {
+				return nil, report, deriveErr
+			}
+
+			food.priceChanged = livePrice == nil || *livePrice != *food.food.Price
+
+			if food.isNew {
+				report.Foods_created++
+			} else {
+				report.Foods_updated++
+			}
+
+			planned.foods = append(planned.foods, food)
+		}
+
+		if planned.isNew {
+			report.Menus_created++
+		} else {
+			report.Menus_updated++
+		}
+
+		plan = append(plan, planned)
+	}
+
+	return plan, report, nil
+}
+
+// Writes the planned menus and foods in one transaction; price changes are kept in the price history
+func applyImport(ctx context.Context, plan []plannedMenu, importedBy string) error {
+	return database.WithTransaction(ctx, func(sessCtx mongo.SessionContext) error {
+		upsert := true
+
+		for _, planned := range plan {
+			_, err := menuCollection.ReplaceOne(sessCtx, bson.M{"menu_id": planned.menu.Menu_id}, planned.menu, &options.ReplaceOptions{Upsert: &upsert})
+
+			if err != nil {
+				return err
+			}
+
+			for _, food := range planned.foods {
+				_, err := foodCollection.ReplaceOne(sessCtx, bson.M{"food_id": food.food.Food_id}, food.food, &options.ReplaceOptions{Upsert: &upsert})
+
+				if err != nil {
+					return err
+				}
+
+				if food.priceChanged {
+					if _, err := recordPrice(sessCtx, food.food.Food_id, *food.food.Price, food.food.Updated_at, true, importedBy); err != nil {
+						return err
+					}
+				}
+			}
+		}
+
+		return nil
+	})
+}
+
+func importFormat(c *gin.Context) string {
+	if format := strings.ToLower(c.Query("format")); format != "" {
+		return format
+	}
+
+	if strings.Contains(c.ContentType(), "csv") {
+		return "csv"
+	}
+
+	return "json"
+}
+
+// Imports menus and their foods from CSV or JSON (?format= or the Content-Type header).
+// ?dry_run=true only validates; otherwise nothing is written unless every row is valid
+func ImportMenus() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		var menus []models.MenuImport
+		var rows importRows
+		var parseErrors []models.ImportError
+		defer cancel()
+
+		switch importFormat(c) {
+		case "csv":
+			var err error
+			menus, rows, parseErrors, err = parseImportCSV(c.Request.Body)
+
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		case "json":
+			if err := c.BindJSON(&menus); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+
+			for i := range menus {
+				rows.menus = append(rows.menus, fmt.Sprintf("[%d]", i))
+			}
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Format must be csv or json"})
+			return
+		}
+
+		if len(menus) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Nothing to import"})
+			return
+		}
+
+		plan, report, err := planImport(ctx, menus, rows)
+
+		if err != nil {
+			msg := fmt.Sprintf("Import could not be validated")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+			return
+		}
+
+		report.Errors = append(parseErrors, report.Errors...)
+		report.Dry_run = c.Query("dry_run") == "true"
+
+		if report.Dry_run {
+			c.JSON(http.StatusOK, report)
+			return
+		}
+
+		if len(report.Errors) > 0 {
+			c.JSON(http.StatusUnprocessableEntity, report)
+			return
+		}
+
+		if err := applyImport(ctx, plan, c.GetString("uid")); err != nil {
+			msg := fmt.Sprintf("Import failed")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+			return
+		}
+
+		report.Applied = true
+		c.JSON(http.StatusOK, report)
+	}
+}
+
+func exportMenus(ctx context.Context, filter bson.M) ([]models.MenuImport, error) {
+	var menus []models.Menu
+
+	res, err := menuCollection.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "name", Value: 1}}))
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err = res.All(ctx, &menus); err != nil {
+		return nil, err
+	}
+
+	exported := []models.MenuImport{}
+
+	for _, menu := range menus {
+		var foods []models.Food
+
+		res, err := foodCollection.Find(ctx, bson.M{"menu_id": menu.Menu_id}, options.Find().SetSort(bson.D{{Key: "name", Value: 1}}))
+
+		if err != nil {
+			return nil, err
+		}
+
+		if err = res.All(ctx, &foods); err != nil {
+			return nil, err
+		}
+
+		entry := models.MenuImport{
+			Name: menu.Name,
+			Category: menu.Category,
+			Name_translations: menu.Name_translations,
+			Category_translations: menu.Category_translations,
+			Start_date: menu.Start_Date,
+			End_date: menu.End_Date,
+			Foods: []models.FoodImport{},
+		}
+
+		for _, food := range foods {
+			entry.Foods = append(entry.Foods, models.FoodImport{
+				Name: food.Name,
+				Name_translations: food.Name_translations,
+				Description: food.Description,
+				Price: food.Price,
+				Food_image: food.Food_image,
+				Recipe: food.Recipe,
+				Allergens: food.Allergens,
+				Dietary_tags: food.Dietary_tags,
+				Nutrition_override: food.Nutrition_override,
+				Nutrition: food.Nutrition,
+				Contains: food.Contains,
+				Suitable_for: food.Suitable_for,
+			})
+		}
+
+		exported = append(exported, entry)
+	}
+
+	return exported, nil
+}
+
+func writeExportCSV(w io.Writer, menus []models.MenuImport) error {
+	writer := csv.NewWriter(w)
+	formatDate := func(date *time.Time) string {
+		if date == nil {
+			return ""
+		}
+
+		return date.Format(time.RFC3339)
+	}
+	formatNumber := func(n float64) string {
+		return strconv.FormatFloat(n, 'f', -1, 64)
+	}
+
+	if err := writer.Write(IMPORT_CSV_COLUMNS); err != nil {
+		return err
+	}
+
+	for _, menu := range menus {
+		menuColumns := []string{menu.Name, menu.Category, formatDate(menu.Start_date), formatDate(menu.End_date)}
+
+		if len(menu.Foods) == 0 {
+			if err := writer.Write(append(menuColumns, make([]string, len(IMPORT_CSV_COLUMNS)-len(menuColumns))...)); err != nil {
+				return err
+			}
+		}
+
+		for _, food := range menu.Foods {
+			record := append([]string{}, menuColumns...)
+			record = append(record, *food.Name, "", "", "", strings.Join(food.Allergens, CSV_LIST_SEPARATOR), strings.Join(food.Dietary_tags, CSV_LIST_SEPARATOR))
+
+			if food.Description != nil {
+				record[5] = *food.Description
+			}
+
+			if food.Price != nil {
+				record[6] = formatNumber(*food.Price)
+			}
+
+			if food.Food_image != nil {
+				record[7] = *food.Food_image
+			}
+
+			// The effective nutrition (override or derived from the recipe) is exported; CSV has no recipe
+			// columns, so a re-import keeps existing recipes and stores these values as the override
+			nutrition := food.Nutrition
+
+			if nutrition == nil {
+				nutrition = food.Nutrition_override
+			}
+
+			if nutrition != nil {
+				record = append(record, formatNumber(nutrition.Calories), formatNumber(nutrition.Protein), formatNumber(nutrition.Carbohydrates), formatNumber(nutrition.Sugar), formatNumber(nutrition.Fat), formatNumber(nutrition.Salt))
+			} else {
+				record = append(record, "", "", "", "", "", "")
+			}
+
+			if err := writer.Write(record); err != nil {
+				return err
+			}
+		}
+	}
+
+	writer.Flush()
+
+	return writer.Error()
+}
+
+// Exports menus w/ their foods in the import format; ?menu_id= limits the export to one menu
+func ExportMenus() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		filter := bson.M{}
+
+		if menuId := c.Query("menu_id"); menuId != "" {
+			filter["menu_id"] = menuId
+		}
+
+		menus, err := exportMenus(ctx, filter)
+
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error":"Error occured while exporting menus"})
+			return
+		}
+
+		switch importFormat(c) {
+		case "csv":
+			c.Header("Content-Disposition", `attachment; filename="menus.csv"`)
+			c.Header("Content-Type", "text/csv; charset=utf-8")
+			c.Status(http.StatusOK)
+
+			if err := writeExportCSV(c.Writer, menus); err != nil {
+				c.Error(err)
+			}
+		case "json":
+			c.JSON(http.StatusOK, menus)
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Format must be csv or json"})
+		}
+	}
+}
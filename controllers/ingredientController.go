@@ -0,0 +1,189 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lackingworth/Go-Restaurant-Management/database"
+	helper "github.com/lackingworth/Go-Restaurant-Management/helpers"
+	"github.com/lackingworth/Go-Restaurant-Management/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var ingredientCollection *mongo.Collection = database.OpenCollection(database.Client, "ingredient")
+
+// Decreases the stock of an ingredient; stock is allowed to go negative so that
+// unrecorded deliveries show up in the inventory instead of blocking the write
+func deductStock(ctx context.Context, ingredientId string, amount float64) error {
+	updatedAt, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+
+	_, err := ingredientCollection.UpdateOne(
+		ctx,
+		bson.M{"ingredient_id": ingredientId},
+		bson.D{
+			{Key: "$inc", Value: bson.D{{Key: "stock_quantity", Value: -amount}}},
+			{Key: "$set", Value: bson.D{{Key: "updated_at", Value: updatedAt}}},
+		},
+	)
+
+	return err
+}
+
+func checkRecipe(ctx context.Context, recipe []models.RecipeItem) error {
+	for _, item := range recipe {
+		count, err := ingredientCollection.CountDocuments(ctx, bson.M{"ingredient_id": item.Ingredient_id})
+
+		if err != nil {
+			return err
+		}
+
+		if count == 0 {
+			return fmt.Errorf("Ingredient %s was not found", item.Ingredient_id)
+		}
+	}
+
+	return nil
+}
+
+var ingredientListSpec = helper.ListSpec{
+	Filters: map[string]helper.FieldKind{"name": helper.STRING_FIELD, "unit": helper.STRING_FIELD, "allergens": helper.STRING_FIELD, "dietary_tags": helper.STRING_FIELD},
+	Sorts: []string{"name", "stock_quantity", "unit_cost", "created_at", "updated_at"},
+	Date_field: "created_at",
+}
+
+func GetIngredients() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		helper.RespondWithList(c, ctx, ingredientCollection, ingredientListSpec, bson.D{}, "Error occured while listing ingredients", nil)
+	}
+}
+
+func GetIngredient() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		var ingredient models.Ingredient
+		ingredientId := c.Param("ingredient_id")
+		defer cancel()
+
+		err := ingredientCollection.FindOne(ctx, bson.M{"ingredient_id": ingredientId}).Decode(&ingredient)
+
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error":"Error occured while fetching the ingredient"})
+			return
+		}
+
+		c.JSON(http.StatusOK, ingredient)
+	}
+}
+
+func CreateIngredient() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		var ingredient models.Ingredient
+		defer cancel()
+
+		if err := c.BindJSON(&ingredient); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error":err.Error()})
+			return
+		}
+
+		validationErr := validate.Struct(ingredient)
+
+		if validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error":validationErr.Error()})
+			return
+		}
+
+		ingredient.Created_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		ingredient.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		ingredient.ID = primitive.NewObjectID()
+		ingredient.Ingredient_id = ingredient.ID.Hex()
+
+		res, insertErr := ingredientCollection.InsertOne(ctx, ingredient)
+
+		if insertErr != nil {
+			msg := fmt.Sprintf("Ingredient was not created")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+			return
+		}
+
+		c.JSON(http.StatusOK, res)
+	}
+}
+
+func UpdateIngredient() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		var ingredient models.Ingredient
+		var updateObj primitive.D
+		ingredientId := c.Param("ingredient_id")
+		defer cancel()
+
+		if err := c.BindJSON(&ingredient); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error":err.Error()})
+			return
+		}
+
+		if ingredient.Name != nil {
+			updateObj = append(updateObj, bson.E{Key: "name", Value: ingredient.Name})
+		}
+
+		if ingredient.Unit != nil {
+			updateObj = append(updateObj, bson.E{Key: "unit", Value: ingredient.Unit})
+		}
+
+		if ingredient.Stock_quantity != nil {
+			updateObj = append(updateObj, bson.E{Key: "stock_quantity", Value: ingredient.Stock_quantity})
+		}
+
+		if ingredient.Unit_cost != nil {
+			updateObj = append(updateObj, bson.E{Key: "unit_cost", Value: ingredient.Unit_cost})
+		}
+
+		if ingredient.Allergens != nil {
+			updateObj = append(updateObj, bson.E{Key: "allergens", Value: ingredient.Allergens})
+		}
+
+		if ingredient.Dietary_tags != nil {
+			updateObj = append(updateObj, bson.E{Key: "dietary_tags", Value: ingredient.Dietary_tags})
+		}
+
+		if ingredient.Nutrition != nil {
+			updateObj = append(updateObj, bson.E{Key: "nutrition", Value: ingredient.Nutrition})
+		}
+
+		ingredient.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		updateObj = append(updateObj, bson.E{Key: "updated_at", Value: ingredient.Updated_at})
+
+		filter := bson.M{"ingredient_id": ingredientId}
+
+		res, err := ingredientCollection.UpdateOne(
+			ctx,
+			filter,
+			bson.D{{Key: "$set", Value: updateObj}},
+		)
+
+		if err != nil {
+			msg := fmt.Sprintf("Ingredient update failed")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+			return
+		}
+
+		if ingredient.Allergens != nil || ingredient.Dietary_tags != nil || ingredient.Nutrition != nil || ingredient.Unit != nil {
+			if err := refreshDerivedFoods(ctx, bson.M{"recipe.ingredient_id": ingredientId}); err != nil {
+				msg := fmt.Sprintf("Allergens and nutrition of the foods using this ingredient could not be derived")
+				c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+				return
+			}
+		}
+
+		c.JSON(http.StatusOK, res)
+	}
+}
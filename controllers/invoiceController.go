@@ -9,6 +9,7 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/lackingworth/Go-Restaurant-Management/database"
+	helper "github.com/lackingworth/Go-Restaurant-Management/helpers"
 	"github.com/lackingworth/Go-Restaurant-Management/models"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -22,6 +23,7 @@ type InvoiceViewFormat struct {
 	Order_id				string
 	Payment_status			*string
 	Payment_due				interface{}
+	Delivery_fee			*float64
 	Table_number			interface{}
 	Payment_due_date		time.Time
 	Order_details			interface{}
@@ -29,24 +31,64 @@ type InvoiceViewFormat struct {
 
 var invoiceCollection *mongo.Collection = database.OpenCollection(database.Client, "invoice")
 
+var invoiceListSpec = helper.ListSpec{
+	Filters: map[string]helper.FieldKind{"order_id": helper.STRING_FIELD, "payment_status": helper.STRING_FIELD, "payment_method": helper.STRING_FIELD},
+	Sorts: []string{"-created_at", "payment_due_date", "updated_at"},
+	Date_field: "created_at",
+}
+
+type OrderBill struct {
+	Items_total				float64
+	Delivery_fee			*float64
+	Payment_due				float64
+}
+
+// Amount due for the order: its billed (not voided / comped) items plus, for delivery orders, the fee of
+// their zone. Invoices, the guest bill and the table board all use it so they show the same amount
+func orderBill(ctx context.Context, order models.Order) (bill OrderBill, err error) {
+	bill.Items_total, err = orderItemsTotal(ctx, order.Order_id)
+
+	if err != nil {
+		return
+	}
+
+	bill.Delivery_fee = order.Delivery_fee
+	bill.Payment_due = bill.Items_total
+
+	if order.Delivery_fee != nil {
+		bill.Payment_due += *order.Delivery_fee
+	}
+
+	bill.Payment_due = toFixed(bill.Payment_due, 2)
+
+	return
+}
+
+// Lists invoices w/ the payment_due (and delivery_fee) of their orders
 func GetInvoices() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
-
-		res, err := invoiceCollection.Find(context.TODO(), bson.M{})
 		defer cancel()
 
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error":"Error occured while listing invoice items"})
-		}
+		helper.RespondWithList(c, ctx, invoiceCollection, invoiceListSpec, bson.D{}, "Error occured while listing invoice items", func(invoices []bson.M) {
+			for _, invoice := range invoices {
+				var order models.Order
 
-		var allInvoices []bson.M
+				if err := orderCollection.FindOne(ctx, bson.M{"order_id": invoice["order_id"]}).Decode(&order); err != nil {
+					continue
+				}
 
-		if err = res.All(ctx, &allInvoices); err != nil {
-			log.Fatal(err)
-		}
+				bill, err := orderBill(ctx, order)
+
+				if err != nil {
+					log.Println(err)
+					continue
+				}
 
-		c.JSON(http.StatusOK, allInvoices)
+				invoice["payment_due"] = bill.Payment_due
+				invoice["delivery_fee"] = bill.Delivery_fee
+			}
+		})
 	}
 }
 
@@ -81,6 +123,16 @@ func GetInvoice() gin.HandlerFunc {
 		invoiceView.Table_number = allOrderItems[0]["table_number"]
 		invoiceView.Order_details = allOrderItems[0]["order_items"]
 
+		// Delivery orders are billed w/ the fee of their zone
+		var order models.Order
+
+		if orderCollection.FindOne(ctx, bson.M{"order_id": invoice.Order_id}).Decode(&order) == nil {
+			if bill, err := orderBill(ctx, order); err == nil {
+				invoiceView.Payment_due = bill.Payment_due
+				invoiceView.Delivery_fee = bill.Delivery_fee
+			}
+		}
+
 		c.JSON(http.StatusOK, invoiceView)
 	}
 }
@@ -117,7 +169,7 @@ func CreateInvoice() gin.HandlerFunc {
 		invoice.Created_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
 		invoice.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
 		invoice.ID = primitive.NewObjectID()
-		invoice.Order_id = invoice.ID.Hex()
+		invoice.Invoice_id = invoice.ID.Hex()
 
 		validationErr := validate.Struct(invoice)
 
@@ -134,6 +186,8 @@ func CreateInvoice() gin.HandlerFunc {
 			return
 		}
 
+		refreshOrderTable(ctx, invoice.Order_id)
+
 		defer cancel()
 		c.JSON(http.StatusOK, res)
 	}
@@ -189,6 +243,11 @@ func UpdateInvoice() gin.HandlerFunc {
 			return
 		}
 
+		// Paying the invoice leaves the table DIRTY on the floor board
+		if invoiceCollection.FindOne(ctx, filter).Decode(&invoice) == nil {
+			refreshOrderTable(ctx, invoice.Order_id)
+		}
+
 		defer cancel()
 		c.JSON(http.StatusOK, res)
 	}
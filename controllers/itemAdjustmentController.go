@@ -0,0 +1,367 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lackingworth/Go-Restaurant-Management/database"
+	"github.com/lackingworth/Go-Restaurant-Management/events"
+	helper "github.com/lackingworth/Go-Restaurant-Management/helpers"
+	"github.com/lackingworth/Go-Restaurant-Management/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type AdjustmentRequest struct {
+	Reason				string			`json:"reason" validate:"required"`
+	Comment				*string			`json:"comment" validate:"omitempty,max=500"`
+	Manager_id			*string			`json:"manager_id"`
+	Manager_pin			*string			`json:"manager_pin"`
+}
+
+type AdjustmentStaffReport struct {
+	Staff_id			string			`json:"staff_id"`
+	Staff_name			string			`json:"staff_name"`
+	Void_count			int				`json:"void_count"`
+	Void_amount			float64			`json:"void_amount"`
+	Comp_count			int				`json:"comp_count"`
+	Comp_amount			float64			`json:"comp_amount"`
+	Approved_count		int				`json:"approved_count"`
+	Reasons				map[string]int	`json:"reasons"`
+}
+
+type AdjustmentReport struct {
+	Start_date			string						`json:"start_date"`
+	End_date			string						`json:"end_date"`
+	Total_void_amount	float64						`json:"total_void_amount"`
+	Total_comp_amount	float64						`json:"total_comp_amount"`
+	Per_staff			[]AdjustmentStaffReport		`json:"per_staff"`
+}
+
+// Reason codes accepted per adjustment type; OTHER needs a comment
+var adjustmentReasons = map[string][]string{
+	"VOID": {"ENTERED_IN_ERROR", "GUEST_CHANGED_MIND", "OUT_OF_STOCK", "KITCHEN_ERROR", "OTHER"},
+	"COMP": {"QUALITY_ISSUE", "LONG_WAIT", "SERVICE_RECOVERY", "MANAGER_GUEST", "OTHER"},
+}
+
+var errApprovalRequired = errors.New("A manager has to approve this w/ manager_id and manager_pin")
+var errAlreadyAdjusted = errors.New("Order item was already voided or comped")
+var errPinLocked = errors.New("Manager PIN is locked after too many wrong attempts, try again later")
+
+// Wrong PINs a manager's PIN takes before it is locked for PIN_LOCKOUT_MINUTES
+const MAX_PIN_FAILURES = 5
+const PIN_LOCKOUT_MINUTES = 15
+
+var itemAdjustmentCollection *mongo.Collection = database.OpenCollection(database.Client, "itemAdjustment")
+
+var itemAdjustmentListSpec = helper.ListSpec{
+	Filters: map[string]helper.FieldKind{"type": helper.STRING_FIELD, "reason": helper.STRING_FIELD, "staff_id": helper.STRING_FIELD, "approved_by": helper.STRING_FIELD, "order_id": helper.STRING_FIELD},
+	Sorts: []string{"-created_at", "amount"},
+	Date_field: "created_at",
+}
+
+// Managers approve their own voids and comps, other staff need a manager to enter their PIN.
+// Returns the id of the approving manager
+func approveAdjustment(ctx context.Context, staffId string, request AdjustmentRequest) (string, error) {
+	var staff models.User
+	var manager models.User
+
+	if userCollection.FindOne(ctx, bson.M{"user_id": staffId}).Decode(&staff) == nil && isManager(staff) {
+		return staff.User_id, nil
+	}
+
+	if request.Manager_id == nil || request.Manager_pin == nil {
+		return "", errApprovalRequired
+	}
+
+	if err := userCollection.FindOne(ctx, bson.M{"user_id": request.Manager_id}).Decode(&manager); err != nil || !isManager(manager) || manager.Manager_pin == nil {
+		return "", errApprovalRequired
+	}
+
+	// Every attempt is counted before the PIN is checked (and only cleared by a right one),
+	// so parallel guesses cannot get past the limit either
+	now := time.Now()
+	unlocked := bson.M{"user_id": manager.User_id, "$or": bson.A{bson.M{"pin_locked_until": nil}, bson.M{"pin_locked_until": bson.M{"$lte": now}}}}
+	err := userCollection.FindOneAndUpdate(ctx, unlocked, bson.D{{Key: "$inc", Value: bson.D{{Key: "pin_failures", Value: 1}}}}, options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&manager)
+
+	if err == mongo.ErrNoDocuments || manager.Pin_failures > MAX_PIN_FAILURES {
+		lockPin(ctx, manager.User_id)
+		return "", errPinLocked
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	if valid, _ := VerifyPassword(*request.Manager_pin, *manager.Manager_pin); !valid {
+		if manager.Pin_failures == MAX_PIN_FAILURES {
+			lockPin(ctx, manager.User_id)
+			return "", errPinLocked
+		}
+
+		return "", errApprovalRequired
+	}
+
+	userCollection.UpdateOne(ctx, bson.M{"user_id": manager.User_id}, bson.D{{Key: "$set", Value: bson.D{{Key: "pin_failures", Value: 0}}}})
+
+	return manager.User_id, nil
+}
+
+// Locks the manager's PIN for PIN_LOCKOUT_MINUTES (a lock in place is not extended)
+func lockPin(ctx context.Context, managerId string) {
+	lockedUntil := time.Now().Add(PIN_LOCKOUT_MINUTES * time.Minute)
+	filter := bson.M{"user_id": managerId, "$or": bson.A{bson.M{"pin_locked_until": nil}, bson.M{"pin_locked_until": bson.M{"$lte": time.Now()}}}}
+
+	userCollection.UpdateOne(ctx, filter, bson.D{{Key: "$set", Value: bson.D{{Key: "pin_failures", Value: 0}, {Key: "pin_locked_until", Value: lockedUntil}}}})
+}
+
+// Name of the food (or bundle) of the order item as shown on the bill
+func orderItemName(ctx context.Context, orderItem models.OrderItem) string {
+	var food models.Food
+	var bundle models.Bundle
+
+	if orderItem.Bundle_id != nil && bundleCollection.FindOne(ctx, bson.M{"bundle_id": orderItem.Bundle_id}).Decode(&bundle) == nil {
+		return *bundle.Name
+	}
+
+	if orderItem.Food_id != nil && foodCollection.FindOne(ctx, bson.M{"food_id": orderItem.Food_id}).Decode(&food) == nil {
+		return *food.Name
+	}
+
+	return "unknown food"
+}
+
+// Takes the order item off the bill as VOID or COMP; the line stays on the order w/ its price for audit
+func adjustOrderItem(adjustmentType string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		var request AdjustmentRequest
+		var orderItem models.OrderItem
+		orderItemId := c.Param("orderItem_id")
+		defer cancel()
+
+		if err := c.BindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error":err.Error()})
+			return
+		}
+
+		validationErr := validate.Struct(request)
+
+		if validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error":validationErr.Error()})
+			return
+		}
+
+		if !contains(adjustmentReasons[adjustmentType], request.Reason) {
+			msg := fmt.Sprintf("reason must be one of %s", strings.Join(adjustmentReasons[adjustmentType], ", "))
+			c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+			return
+		}
+
+		if request.Reason == "OTHER" && (request.Comment == nil || *request.Comment == "") {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "comment is required for reason OTHER"})
+			return
+		}
+
+		if err := orderItemCollection.FindOne(ctx, bson.M{"order_item_id": orderItemId}).Decode(&orderItem); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Order item was not found"})
+			return
+		}
+
+		if orderItem.Adjustment != nil {
+			c.JSON(http.StatusConflict, gin.H{"error": errAlreadyAdjusted.Error()})
+			return
+		}
+
+		paid, err := invoiceCollection.CountDocuments(ctx, bson.M{"order_id": orderItem.Order_id, "payment_status": "PAID"})
+
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occured while checking the invoices of the order"})
+			return
+		}
+
+		if paid > 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "Items of a paid order cannot be voided or comped"})
+			return
+		}
+
+		staffId := c.GetString("uid")
+		approvedBy, err := approveAdjustment(ctx, staffId, request)
+
+		if err != nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+
+		adjustment := models.ItemAdjustment{
+			Type: adjustmentType,
+			Reason: request.Reason,
+			Comment: request.Comment,
+			Order_item_id: orderItem.Order_item_id,
+			Order_id: orderItem.Order_id,
+			Item_name: orderItemName(ctx, orderItem),
+			Staff_id: staffId,
+			Approved_by: approvedBy,
+		}
+
+		if orderItem.Unit_price != nil {
+			adjustment.Amount = *orderItem.Unit_price
+		}
+
+		adjustment.Created_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		adjustment.ID = primitive.NewObjectID()
+		adjustment.Adjustment_id = adjustment.ID.Hex()
+
+		err = database.WithTransaction(ctx, func(sessCtx mongo.SessionContext) error {
+			updateObj := bson.D{
+				{Key: "adjustment", Value: adjustmentType},
+				{Key: "adjustment_id", Value: adjustment.Adjustment_id},
+				{Key: "updated_at", Value: adjustment.Created_at},
+			}
+
+			// Only the first of concurrent adjustments of the item goes through
+			res, err := orderItemCollection.UpdateOne(sessCtx, bson.M{"order_item_id": orderItemId, "adjustment": nil}, bson.D{{Key: "$set", Value: updateObj}})
+
+			if err != nil {
+				return err
+			}
+
+			if res.MatchedCount == 0 {
+				return errAlreadyAdjusted
+			}
+
+			_, err = itemAdjustmentCollection.InsertOne(sessCtx, adjustment)
+
+			return err
+		})
+
+		if err == errAlreadyAdjusted {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err != nil {
+			msg := fmt.Sprintf("Order item was not %s", strings.ToLower(adjustmentType)+"ed")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+			return
+		}
+
+		// Voided items the kitchen already got are not to be cooked (comps are served all the same)
+		if adjustmentType == "VOID" && orderItem.Course_status != "HELD" {
+			events.Default.Publish(KITCHEN_TOPIC, "item_voided", gin.H{"order_id": orderItem.Order_id, "order_item_id": orderItemId, "item_name": adjustment.Item_name})
+		}
+
+		refreshOrderTable(ctx, orderItem.Order_id)
+		c.JSON(http.StatusOK, adjustment)
+	}
+}
+
+func VoidOrderItem() gin.HandlerFunc {
+	return adjustOrderItem("VOID")
+}
+
+func CompOrderItem() gin.HandlerFunc {
+	return adjustOrderItem("COMP")
+}
+
+func GetItemAdjustments() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		helper.RespondWithList(c, ctx, itemAdjustmentCollection, itemAdjustmentListSpec, bson.D{}, "Error occured while listing voids and comps", nil)
+	}
+}
+
+// Sums voids and comps per staff member who asked for them (and counts the ones each manager approved)
+// for the given period, last 30 days by default
+func GetItemAdjustmentReport() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		start, end, err := reportRange(c)
+
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		res, err := itemAdjustmentCollection.Find(ctx, bson.M{"created_at": bson.M{"$gte": start, "$lt": end}})
+
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error":"Error occured while listing voids and comps"})
+			return
+		}
+
+		var adjustments []models.ItemAdjustment
+
+		if err = res.All(ctx, &adjustments); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error":"Error occured while listing voids and comps"})
+			return
+		}
+
+		report := AdjustmentReport{
+			Start_date: start.Format("2006-01-02"),
+			End_date: end.AddDate(0, 0, -1).Format("2006-01-02"),
+			Per_staff: []AdjustmentStaffReport{},
+		}
+
+		staff := map[string]*AdjustmentStaffReport{}
+		staffReport := func(staffId string) *AdjustmentStaffReport {
+			if _, ok := staff[staffId]; !ok {
+				staff[staffId] = &AdjustmentStaffReport{Staff_id: staffId, Reasons: map[string]int{}}
+			}
+
+			return staff[staffId]
+		}
+
+		for _, adjustment := range adjustments {
+			entry := staffReport(adjustment.Staff_id)
+			entry.Reasons[adjustment.Reason]++
+
+			if adjustment.Type == "VOID" {
+				entry.Void_count++
+				entry.Void_amount += adjustment.Amount
+				report.Total_void_amount += adjustment.Amount
+			} else {
+				entry.Comp_count++
+				entry.Comp_amount += adjustment.Amount
+				report.Total_comp_amount += adjustment.Amount
+			}
+
+			if adjustment.Approved_by != adjustment.Staff_id {
+				staffReport(adjustment.Approved_by).Approved_count++
+			}
+		}
+
+		for staffId, entry := range staff {
+			var user models.User
+
+			if userCollection.FindOne(ctx, bson.M{"user_id": staffId}).Decode(&user) == nil {
+				entry.Staff_name = fmt.Sprintf("%s %s", *user.First_name, *user.Last_name)
+			}
+
+			entry.Void_amount = toFixed(entry.Void_amount, 2)
+			entry.Comp_amount = toFixed(entry.Comp_amount, 2)
+			report.Per_staff = append(report.Per_staff, *entry)
+		}
+
+		sort.Slice(report.Per_staff, func(i, j int) bool {
+			return report.Per_staff[i].Void_amount+report.Per_staff[i].Comp_amount > report.Per_staff[j].Void_amount+report.Per_staff[j].Comp_amount
+		})
+
+		report.Total_void_amount = toFixed(report.Total_void_amount, 2)
+		report.Total_comp_amount = toFixed(report.Total_comp_amount, 2)
+
+		c.JSON(http.StatusOK, report)
+	}
+}
@@ -0,0 +1,392 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lackingworth/Go-Restaurant-Management/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type KitchenTicketItem struct {
+	Order_item_id		string		`json:"order_item_id"`
+	Food_name			string		`json:"food_name"`
+	Quantity			string		`json:"quantity"`
+	Bundle				string		`json:"bundle,omitempty"`
+	Allergy_warnings	[]string	`json:"allergy_warnings"`
+	Course				int			`json:"course"`
+	Notes				[]string	`json:"notes"`
+}
+
+type KitchenTicket struct {
+	Order_id			string					`json:"order_id"`
+	Order_type			string					`json:"order_type"`
+	Table_number		*int					`json:"table_number"`
+	Customer_name		*string					`json:"customer_name,omitempty"`
+	Order_date			time.Time				`json:"order_date"`
+	Promised_at			*time.Time				`json:"promised_at,omitempty"`
+	Allergy_profile		[]string				`json:"allergy_profile"`
+	Notes				[]string				`json:"notes"`
+	Course				*int					`json:"course,omitempty"`
+	Items				[]KitchenTicketItem		`json:"items"`
+	Held_courses		[]int					`json:"held_courses"`
+	Warnings			[]string				`json:"warnings"`
+}
+
+// Open tickets of the kitchen, one queue per order type
+type KitchenFeed struct {
+	Dine_in				[]KitchenTicket			`json:"dine_in"`
+	Takeaway			[]KitchenTicket			`json:"takeaway"`
+	Delivery			[]KitchenTicket			`json:"delivery"`
+}
+
+// Tickets older than this are left off the feed even if they were never marked ready
+const KITCHEN_FEED_HOURS = 12
+
+// Filter on the items of a course; items from before courses are starters
+func courseFilter(course int) interface{} {
+	if course == 1 {
+		return bson.M{"$in": bson.A{1, nil}}
+	}
+
+	return course
+}
+
+// Builds the ticket of the items fired so far (or of one course only); held courses are only listed
+func BuildKitchenTicket(ctx context.Context, orderId string, course *int) (ticket KitchenTicket, err error) {
+	var order models.Order
+	var table models.Table
+
+	err = orderCollection.FindOne(ctx, bson.M{"order_id": orderId}).Decode(&order)
+
+	if err != nil {
+		return
+	}
+
+	ticket.Order_id = order.Order_id
+	ticket.Order_type = order.Order_type
+	ticket.Customer_name = order.Customer_name
+	ticket.Order_date = order.Order_Date
+	ticket.Promised_at = order.Promised_at
+
+	ticket.Course = course
+	ticket.Allergy_profile = order.Allergy_profile
+
+	if ticket.Order_type == "" {
+		ticket.Order_type = "DINE_IN"
+	}
+
+	if order.Table_id != nil && tableCollection.FindOne(ctx, bson.M{"table_id": order.Table_id}).Decode(&table) == nil {
+		ticket.Table_number = table.Table_number
+	}
+
+	held, err := orderItemCollection.Distinct(ctx, "course", bson.M{"order_id": orderId, "course_status": "HELD", "adjustment": bson.M{"$ne": "VOID"}})
+
+	if err != nil {
+		return
+	}
+
+	ticket.Held_courses = []int{}
+
+	for _, heldCourse := range held {
+		switch n := heldCourse.(type) {
+		case int32:
+			ticket.Held_courses = append(ticket.Held_courses, int(n))
+		case int64:
+			ticket.Held_courses = append(ticket.Held_courses, int(n))
+		}
+	}
+
+	sort.Ints(ticket.Held_courses)
+	filter := bson.M{"order_id": orderId, "course_status": bson.M{"$ne": "HELD"}, "adjustment": bson.M{"$ne": "VOID"}}
+
+	if course != nil {
+		filter["course"] = courseFilter(*course)
+	}
+
+	res, err := orderItemCollection.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "course", Value: 1}, {Key: "created_at", Value: 1}}))
+
+	if err != nil {
+		return
+	}
+
+	var orderItems []models.OrderItem
+
+	if err = res.All(ctx, &orderItems); err != nil {
+		return
+	}
+
+	orderNotes, err := entityNotes(ctx, "ORDER", []string{orderId})
+
+	if err != nil {
+		return
+	}
+
+	ticket.Notes = orderNotes[orderId]
+	orderItemIds := []string{}
+
+	for _, orderItem := range orderItems {
+		orderItemIds = append(orderItemIds, orderItem.Order_item_id)
+	}
+
+	itemNotes, err := entityNotes(ctx, "ORDER_ITEM", orderItemIds)
+
+	if err != nil {
+		return
+	}
+
+	for _, orderItem := range orderItems {
+		var food models.Food
+		item := KitchenTicketItem{
+			Order_item_id: orderItem.Order_item_id,
+			Food_name: "unknown food",
+			Allergy_warnings: orderItem.Allergy_warnings,
+			Course: 1,
+			Notes: itemNotes[orderItem.Order_item_id],
+		}
+
+		if orderItem.Course != nil {
+			item.Course = *orderItem.Course
+		}
+
+		if orderItem.Quantity != nil {
+			item.Quantity = *orderItem.Quantity
+		}
+
+		// Bundles are cooked as their components, so each one gets its own line
+		if orderItem.Bundle_id != nil {
+			var bundle models.Bundle
+			bundleName := "bundle"
+
+			if bundleCollection.FindOne(ctx, bson.M{"bundle_id": orderItem.Bundle_id}).Decode(&bundle) == nil {
+				bundleName = *bundle.Name
+			}
+
+			for _, component := range orderItem.Components {
+				componentItem := item
+				componentItem.Food_name = component.Food_name
+				componentItem.Bundle = fmt.Sprintf("%s: %s", bundleName, component.Slot)
+				ticket.Items = append(ticket.Items, componentItem)
+			}
+
+			if len(item.Allergy_warnings) > 0 {
+				ticket.Warnings = append(ticket.Warnings, fmt.Sprintf("ALLERGY: %s contains %s", bundleName, strings.Join(item.Allergy_warnings, ", ")))
+			}
+
+			continue
+		}
+
+		if orderItem.Food_id != nil && foodCollection.FindOne(ctx, bson.M{"food_id": orderItem.Food_id}).Decode(&food) == nil {
+			item.Food_name = *food.Name
+		}
+
+		if len(item.Allergy_warnings) > 0 {
+			ticket.Warnings = append(ticket.Warnings, fmt.Sprintf("ALLERGY: %s contains %s", item.Food_name, strings.Join(item.Allergy_warnings, ", ")))
+		}
+
+		ticket.Items = append(ticket.Items, item)
+	}
+
+	return ticket, nil
+}
+
+// Renders the ticket as plain text for kitchen printers
+func (ticket KitchenTicket) Text() string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "ORDER %s\n", ticket.Order_id)
+
+	if ticket.Order_type != "DINE_IN" {
+		fmt.Fprintf(&b, "*** %s ***\n", ticket.Order_type)
+	}
+
+	if ticket.Table_number != nil {
+		fmt.Fprintf(&b, "TABLE %d\n", *ticket.Table_number)
+	}
+
+	if ticket.Customer_name != nil {
+		fmt.Fprintf(&b, "FOR %s\n", *ticket.Customer_name)
+	}
+
+	fmt.Fprintf(&b, "%s\n", ticket.Order_date.Format("2006-01-02 15:04"))
+
+	if ticket.Promised_at != nil {
+		fmt.Fprintf(&b, "READY BY %s\n", ticket.Promised_at.Local().Format("15:04"))
+	}
+
+	if len(ticket.Allergy_profile) > 0 {
+		fmt.Fprintf(&b, "!! GUEST ALLERGIES: %s !!\n", strings.Join(ticket.Allergy_profile, ", "))
+	}
+
+	for _, note := range ticket.Notes {
+		fmt.Fprintf(&b, "NOTE: %s\n", note)
+	}
+
+	b.WriteString("--------------------------------\n")
+	course := 0
+
+	for _, item := range ticket.Items {
+		if item.Course != course {
+			course = item.Course
+			fmt.Fprintf(&b, "== COURSE %d ==\n", course)
+		}
+
+		fmt.Fprintf(&b, "%-2s %s\n", item.Quantity, item.Food_name)
+
+		if item.Bundle != "" {
+			fmt.Fprintf(&b, "   (%s)\n", item.Bundle)
+		}
+
+		if len(item.Allergy_warnings) > 0 {
+			fmt.Fprintf(&b, "   !! ALLERGY: %s\n", strings.Join(item.Allergy_warnings, ", "))
+		}
+
+		for _, note := range item.Notes {
+			fmt.Fprintf(&b, "   >> %s\n", note)
+		}
+	}
+
+	for _, held := range ticket.Held_courses {
+		fmt.Fprintf(&b, "-- COURSE %d ON HOLD --\n", held)
+	}
+
+	return b.String()
+}
+
+func GetKitchenTicket() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		orderId := c.Param("order_id")
+		defer cancel()
+
+		var course *int
+
+		if raw := c.Query("course"); raw != "" {
+			n, err := strconv.Atoi(raw)
+
+			if err != nil || n < 1 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "course must be a positive number"})
+				return
+			}
+
+			course = &n
+		}
+
+		ticket, err := BuildKitchenTicket(ctx, orderId, course)
+
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error":"Error occured while building the kitchen ticket"})
+			return
+		}
+
+		if c.Query("format") == "text" {
+			c.String(http.StatusOK, ticket.Text())
+			return
+		}
+
+		c.JSON(http.StatusOK, ticket)
+	}
+}
+
+// Lists the tickets the kitchen still has to prepare (orders w/ items not marked ready), dine-in in
+// the order they came in and takeaway / delivery by the time promised to the customer; ?type= for one queue
+func GetKitchenFeed() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		since := time.Now().Add(-KITCHEN_FEED_HOURS * time.Hour)
+		filter := bson.M{"ready_at": nil, "merged_into": nil, "order_date": bson.M{"$gte": since}}
+
+		switch orderType := c.Query("type"); orderType {
+		case "":
+		case "DINE_IN":
+			filter["order_type"] = bson.M{"$in": bson.A{"DINE_IN", nil}}
+		case "TAKEAWAY", "DELIVERY":
+			filter["order_type"] = orderType
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "type must be DINE_IN, TAKEAWAY or DELIVERY"})
+			return
+		}
+
+		res, err := orderCollection.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "order_date", Value: 1}}))
+
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error":"Error occured while listing the kitchen feed"})
+			return
+		}
+
+		var orders []models.Order
+
+		if err = res.All(ctx, &orders); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error":"Error occured while listing the kitchen feed"})
+			return
+		}
+
+		feed := KitchenFeed{Dine_in: []KitchenTicket{}, Takeaway: []KitchenTicket{}, Delivery: []KitchenTicket{}}
+
+		for _, order := range orders {
+			ticket, err := BuildKitchenTicket(ctx, order.Order_id, nil)
+
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error":"Error occured while building the kitchen ticket"})
+				return
+			}
+
+			// Orders w/o fired items have nothing to cook yet
+			if len(ticket.Items) == 0 {
+				continue
+			}
+
+			switch ticket.Order_type {
+			case "TAKEAWAY":
+				feed.Takeaway = append(feed.Takeaway, ticket)
+			case "DELIVERY":
+				feed.Delivery = append(feed.Delivery, ticket)
+			default:
+				feed.Dine_in = append(feed.Dine_in, ticket)
+			}
+		}
+
+		for _, queue := range [][]KitchenTicket{feed.Takeaway, feed.Delivery} {
+			sort.SliceStable(queue, func(i, j int) bool {
+				return queue[i].Promised_at != nil && (queue[j].Promised_at == nil || queue[i].Promised_at.Before(*queue[j].Promised_at))
+			})
+		}
+
+		c.JSON(http.StatusOK, feed)
+	}
+}
+
+// Takes the order off the kitchen feed once all of its items are prepared
+func MarkOrderReady() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		orderId := c.Param("order_id")
+		defer cancel()
+
+		readyAt, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		res, err := orderCollection.UpdateOne(ctx, bson.M{"order_id": orderId}, bson.D{{Key: "$set", Value: bson.D{{Key: "ready_at", Value: readyAt}, {Key: "updated_at", Value: readyAt}}}})
+
+		if err != nil {
+			msg := fmt.Sprintf("Order update failed")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+			return
+		}
+
+		if res.MatchedCount == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Order was not found"})
+			return
+		}
+
+		pushAggregatorStatus(ctx, orderId, "READY")
+		c.JSON(http.StatusOK, gin.H{"order_id": orderId, "ready_at": readyAt})
+	}
+}
@@ -3,12 +3,12 @@ package controllers
 import (
 	"context"
 	"fmt"
-	"log"
 	"net/http"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/lackingworth/Go-Restaurant-Management/database"
+	helper "github.com/lackingworth/Go-Restaurant-Management/helpers"
 	"github.com/lackingworth/Go-Restaurant-Management/models"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -18,23 +18,40 @@ import (
 
 var menuCollection *mongo.Collection = database.OpenCollection(database.Client, "menu")
 
+var menuListSpec = helper.ListSpec{
+	Filters: map[string]helper.FieldKind{"category": helper.STRING_FIELD, "name": helper.STRING_FIELD},
+	Sorts: []string{"name", "start_date", "end_date", "created_at", "updated_at"},
+	Date_field: "created_at",
+	Stages: []bson.D{
+		// MongoDB Aggregation stages for the foods of each menu incl. their calorie labelling
+		{{Key: "$lookup", Value: bson.D{{Key: "from", Value: "food"}, {Key: "localField", Value: "menu_id"}, {Key: "foreignField", Value: "menu_id"}, {Key: "as", Value: "foods"}} /*end*/}},
+		{{Key: "$project", Value: bson.D{{Key: "foods._id", Value: 0}, {Key: "foods.recipe", Value: 0}, {Key: "foods.nutrition_override", Value: 0}} /*end*/}},
+	},
+}
+
 func GetMenus() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
-		res, err := menuCollection.Find(context.TODO(), bson.M{})
 		defer cancel()
 
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error":"error occured while listing menu items"})
-		}
-		
-		var allMenus []bson.M
+		locale := helper.RequestedLocale(c)
+		var served helper.ServedLocales
 
-		if err = res.All(ctx, &allMenus); err != nil {
-			log.Fatal(err)
-		}
+		helper.RespondWithList(c, ctx, menuCollection, menuListSpec, bson.D{}, "error occured while listing menu items", func(allMenus []bson.M) {
+			for _, menu := range allMenus {
+				helper.LocalizeDocument(menu, locale, &served, "name", "category")
 
-		c.JSON(http.StatusOK, allMenus)
+				if foods, ok := menu["foods"].(bson.A); ok {
+					for _, food := range foods {
+						if doc, ok := food.(bson.M); ok {
+							helper.LocalizeDocument(doc, locale, &served, "name")
+						}
+					}
+				}
+			}
+
+			c.Header("Content-Language", served.String())
+		})
 	}
 }
 
@@ -50,7 +67,26 @@ func GetMenu() gin.HandlerFunc {
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error":"error occured while fetching the menu"})
 		}
-		c.JSON(http.StatusOK, menu)
+		locale := helper.RequestedLocale(c)
+		var served helper.ServedLocales
+
+		if name, found := helper.Translate(menu.Name_translations, locale, &served); found {
+			menu.Name = name
+		}
+
+		if category, found := helper.Translate(menu.Category_translations, locale, &served); found {
+			menu.Category = category
+		}
+
+		document, err := BuildMenuDocument(ctx, menu, locale, &served)
+
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error":"error occured while fetching the menu sections"})
+			return
+		}
+
+		c.Header("Content-Language", served.String())
+		c.JSON(http.StatusOK, document)
 	}
 }
 
@@ -129,6 +165,14 @@ func UpdateMenu() gin.HandlerFunc {
 				updateObj = append(updateObj, bson.E{Key: "category", Value: menu.Category})
 			}
 
+			if menu.Name_translations != nil {
+				updateObj = append(updateObj, bson.E{Key: "name_translations", Value: menu.Name_translations})
+			}
+
+			if menu.Category_translations != nil {
+				updateObj = append(updateObj, bson.E{Key: "category_translations", Value: menu.Category_translations})
+			}
+
 			menu.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
 			updateObj = append(updateObj, bson.E{Key: "updated_at", Value: menu.Updated_at})
 
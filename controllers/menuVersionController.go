@@ -0,0 +1,753 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"reflect"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lackingworth/Go-Restaurant-Management/database"
+	"github.com/lackingworth/Go-Restaurant-Management/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type MenuVersionEdit struct {
+	Menu		*models.Menu		`json:"menu"`
+	Foods		[]models.Food		`json:"foods"`
+}
+
+type FieldChange struct {
+	Live		interface{}		`json:"live"`
+	Draft		interface{}		`json:"draft"`
+}
+
+type FoodChange struct {
+	Food_id		string					`json:"food_id"`
+	Name		*string					`json:"name"`
+	Changes		map[string]FieldChange	`json:"changes"`
+}
+
+type MenuDiff struct {
+	Version_id		string					`json:"version_id"`
+	Menu_changes	map[string]FieldChange	`json:"menu_changes"`
+	Foods_added		[]models.Food			`json:"foods_added"`
+	Foods_removed	[]models.Food			`json:"foods_removed"`
+	Foods_changed	[]FoodChange			`json:"foods_changed"`
+}
+
+var menuVersionCollection *mongo.Collection = database.OpenCollection(database.Client, "menuVersion")
+
+// Concurrent snapshots of a menu cannot end up w/ the same version number
+func EnsureMenuVersionIndexes() error {
+	var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	_, err := menuVersionCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "menu_id", Value: 1}, {Key: "version", Value: 1}},
+		Options: options.Index().SetName("menu_version_number").SetUnique(true),
+	})
+
+	return err
+}
+
+func menuFields(menu models.Menu) map[string]interface{} {
+	return map[string]interface{}{
+		"name": menu.Name,
+		"category": menu.Category,
+		"name_translations": menu.Name_translations,
+		"category_translations": menu.Category_translations,
+		"start_date": menu.Start_Date,
+		"end_date": menu.End_Date,
+	}
+}
+
+func foodFields(food models.Food) map[string]interface{} {
+	return map[string]interface{}{
+		"name": food.Name,
+		"name_translations": food.Name_translations,
+		"description": food.Description,
+		"price": food.Price,
+		"food_image": food.Food_image,
+		"category_id": food.Category_id,
+		"position": food.Position,
+		"recipe": food.Recipe,
+		"allergens": food.Allergens,
+		"dietary_tags": food.Dietary_tags,
+		"nutrition_override": food.Nutrition_override,
+	}
+}
+
+func fieldChanges(live map[string]interface{}, draft map[string]interface{}) map[string]FieldChange {
+	changes := map[string]FieldChange{}
+
+	for field, value := range draft {
+		if !reflect.DeepEqual(live[field], value) {
+			changes[field] = FieldChange{Live: live[field], Draft: value}
+		}
+	}
+
+	return changes
+}
+
+// Loads the live menu with its foods
+func liveMenu(ctx context.Context, menuId string) (menu models.Menu, foods []models.Food, err error) {
+	err = menuCollection.FindOne(ctx, bson.M{"menu_id": menuId}).Decode(&menu)
+
+	if err != nil {
+		return
+	}
+
+	res, err := foodCollection.Find(ctx, bson.M{"menu_id": menuId})
+
+	if err != nil {
+		return
+	}
+
+	foods = []models.Food{}
+	err = res.All(ctx, &foods)
+
+	return
+}
+
+func newMenuVersion(ctx context.Context, menuId string, status string, createdBy string) (version models.MenuVersion, err error) {
+	version.Menu, version.Foods, err = liveMenu(ctx, menuId)
+
+	if err != nil {
+		return
+	}
+
+	version.Menu_id = menuId
+	version.Status = status
+	version.Created_by = createdBy
+	version.Created_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	version.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+
+	if status == "PUBLISHED" {
+		version.Published_at = &version.Created_at
+	}
+
+	// Takes the number after the latest version; a concurrent snapshot taking it first is a duplicate, so try the next one
+	for attempt := 0; attempt < 5; attempt++ {
+		var latest models.MenuVersion
+
+		err = menuVersionCollection.FindOne(ctx, bson.M{"menu_id": menuId}, options.FindOne().SetSort(bson.D{{Key: "version", Value: -1}})).Decode(&latest)
+
+		if err != nil && err != mongo.ErrNoDocuments {
+			return
+		}
+
+		version.ID = primitive.NewObjectID()
+		version.Version_id = version.ID.Hex()
+		version.Version = latest.Version + 1
+
+		_, err = menuVersionCollection.InsertOne(ctx, version)
+
+		if !mongo.IsDuplicateKeyError(err) {
+			return
+		}
+	}
+
+	return
+}
+
+func diffMenuVersion(ctx context.Context, version models.MenuVersion) (diff MenuDiff, err error) {
+	menu, foods, err := liveMenu(ctx, version.Menu_id)
+
+	if err != nil {
+		return
+	}
+
+	diff.Version_id = version.Version_id
+	diff.Menu_changes = fieldChanges(menuFields(menu), menuFields(version.Menu))
+	diff.Foods_added = []models.Food{}
+	diff.Foods_removed = []models.Food{}
+	diff.Foods_changed = []FoodChange{}
+
+	live := map[string]models.Food{}
+
+	for _, food := range foods {
+		live[food.Food_id] = food
+	}
+
+	for _, food := range version.Foods {
+		liveFood, found := live[food.Food_id]
+
+		if !found {
+			diff.Foods_added = append(diff.Foods_added, food)
+			continue
+		}
+
+		delete(live, food.Food_id)
+
+		if changes := fieldChanges(foodFields(liveFood), foodFields(food)); len(changes) > 0 {
+			diff.Foods_changed = append(diff.Foods_changed, FoodChange{Food_id: food.Food_id, Name: food.Name, Changes: changes})
+		}
+	}
+
+	for _, food := range foods {
+		if _, removed := live[food.Food_id]; removed {
+			diff.Foods_removed = append(diff.Foods_removed, food)
+		}
+	}
+
+	return
+}
+
+// Lists the foods of the menu or the version changed on the live menu after the
+// version was snapshotted, publishing would revert those changes
+func staleMenuFoods(ctx context.Context, version models.MenuVersion) ([]string, error) {
+	foodIds := []string{}
+
+	for _, food := range version.Foods {
+		foodIds = append(foodIds, food.Food_id)
+	}
+
+	opts := options.Find().SetProjection(bson.M{"food_id": 1})
+	res, err := foodCollection.Find(ctx, bson.M{
+		"$or": []bson.M{{"menu_id": version.Menu_id}, {"food_id": bson.M{"$in": foodIds}}},
+		"updated_at": bson.M{"$gt": version.Created_at},
+	}, opts)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var foods []models.Food
+
+	if err = res.All(ctx, &foods); err != nil {
+		return nil, err
+	}
+
+	stale := []string{}
+
+	for _, food := range foods {
+		stale = append(stale, food.Food_id)
+	}
+
+	return stale, nil
+}
+
+// Makes the version the live menu in one transaction: menu fields and the fields
+// of the foods a version owns are set from the snapshot, foods missing from it are taken off the menu (they are
+// kept for order history) and the previously published version gets archived
+func publishMenuVersion(ctx context.Context, version models.MenuVersion, publishedBy string) error {
+	count, err := menuVersionCollection.CountDocuments(ctx, bson.M{"menu_id": version.Menu_id, "status": "PUBLISHED"})
+
+	if err != nil {
+		return err
+	}
+
+	// Keep the state from before versioning so it can be rolled back to
+	if count == 0 {
+		if _, err = newMenuVersion(ctx, version.Menu_id, "ARCHIVED", publishedBy); err != nil {
+			return err
+		}
+	}
+
+	return database.WithTransaction(ctx, func(sessCtx mongo.SessionContext) error {
+		now, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		menuUpdate := bson.D{{Key: "updated_at", Value: now}}
+
+		for field, value := range menuFields(version.Menu) {
+			menuUpdate = append(menuUpdate, bson.E{Key: field, Value: value})
+		}
+
+		_, err := menuCollection.UpdateOne(sessCtx, bson.M{"menu_id": version.Menu_id}, bson.D{{Key: "$set", Value: menuUpdate}})
+
+		if err != nil {
+			return err
+		}
+
+		foodIds := []string{}
+
+		for _, food := range version.Foods {
+			var liveFood models.Food
+
+			foodIds = append(foodIds, food.Food_id)
+			err := foodCollection.FindOne(sessCtx, bson.M{"food_id": food.Food_id}).Decode(&liveFood)
+
+			if err != nil && err != mongo.ErrNoDocuments {
+				return err
+			}
+
+			if err == mongo.ErrNoDocuments || liveFood.Price == nil || *liveFood.Price != *food.Price {
+				if _, err := recordPrice(sessCtx, food.Food_id, *food.Price, now, true, publishedBy); err != nil {
+					return err
+				}
+			}
+
+			food.Updated_at = now
+
+			if err == mongo.ErrNoDocuments {
+				if _, err := foodCollection.InsertOne(sessCtx, food); err != nil {
+					return err
+				}
+
+				continue
+			}
+
+			// Only the fields a version owns are set, thumbnails follow the image
+			foodUpdate := bson.D{
+				{Key: "menu_id", Value: version.Menu_id},
+				{Key: "contains", Value: food.Contains},
+				{Key: "suitable_for", Value: food.Suitable_for},
+				{Key: "nutrition", Value: food.Nutrition},
+				{Key: "updated_at", Value: now},
+			}
+
+			for field, value := range foodFields(food) {
+				foodUpdate = append(foodUpdate, bson.E{Key: field, Value: value})
+			}
+
+			if !reflect.DeepEqual(liveFood.Food_image, food.Food_image) {
+				foodUpdate = append(foodUpdate, bson.E{Key: "food_thumbnails", Value: food.Food_thumbnails})
+			}
+
+			_, err = foodCollection.UpdateOne(sessCtx, bson.M{"food_id": food.Food_id}, bson.D{{Key: "$set", Value: foodUpdate}})
+
+			if err != nil {
+				return err
+			}
+		}
+
+		_, err = foodCollection.UpdateMany(
+			sessCtx,
+			bson.M{"menu_id": version.Menu_id, "food_id": bson.M{"$nin": foodIds}},
+			bson.D{{Key: "$set", Value: bson.D{{Key: "menu_id", Value: nil}, {Key: "updated_at", Value: now}}}},
+		)
+
+		if err != nil {
+			return err
+		}
+
+		_, err = menuVersionCollection.UpdateMany(
+			sessCtx,
+			bson.M{"menu_id": version.Menu_id, "status": "PUBLISHED"},
+			bson.D{{Key: "$set", Value: bson.D{{Key: "status", Value: "ARCHIVED"}, {Key: "updated_at", Value: now}}}},
+		)
+
+		if err != nil {
+			return err
+		}
+
+		_, err = menuVersionCollection.UpdateOne(
+			sessCtx,
+			bson.M{"version_id": version.Version_id},
+			bson.D{{Key: "$set", Value: bson.D{{Key: "status", Value: "PUBLISHED"}, {Key: "published_at", Value: now}, {Key: "publish_at", Value: nil}, {Key: "updated_at", Value: now}}}},
+		)
+
+		return err
+	})
+}
+
+// Publishes scheduled menu versions that are due
+func PublishScheduledMenus() {
+	var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "publish_at", Value: 1}})
+	res, err := menuVersionCollection.Find(ctx, bson.M{"status": "SCHEDULED", "publish_at": bson.M{"$lte": time.Now()}}, opts)
+
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	var versions []models.MenuVersion
+
+	if err = res.All(ctx, &versions); err != nil {
+		log.Println(err)
+		return
+	}
+
+	for _, version := range versions {
+		stale, err := staleMenuFoods(ctx, version)
+
+		if err != nil {
+			log.Println(err)
+			continue
+		}
+
+		// Back to draft so it is not retried every run, it has to be redone
+		if len(stale) > 0 {
+			log.Printf("menu version %s not published, foods changed since its snapshot: %v", version.Version_id, stale)
+			updatedAt, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+
+			_, err = menuVersionCollection.UpdateOne(
+				ctx,
+				bson.M{"version_id": version.Version_id, "status": "SCHEDULED"},
+				bson.D{{Key: "$set", Value: bson.D{{Key: "status", Value: "DRAFT"}, {Key: "publish_at", Value: nil}, {Key: "updated_at", Value: updatedAt}}}},
+			)
+
+			if err != nil {
+				log.Println(err)
+			}
+
+			continue
+		}
+
+		if err := publishMenuVersion(ctx, version, version.Created_by); err != nil {
+			log.Println(err)
+		}
+	}
+}
+
+func GetMenuVersions() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		menuId := c.Param("menu_id")
+		defer cancel()
+
+		opts := options.Find().SetSort(bson.D{{Key: "version", Value: -1}}).SetProjection(bson.M{"foods": 0})
+		res, err := menuVersionCollection.Find(ctx, bson.M{"menu_id": menuId}, opts)
+
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error":"Error occured while listing menu versions"})
+			return
+		}
+
+		allVersions := []bson.M{}
+
+		if err = res.All(ctx, &allVersions); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error":"Error occured while listing menu versions"})
+			return
+		}
+
+		c.JSON(http.StatusOK, allVersions)
+	}
+}
+
+// Returns the full version, which is the preview of a draft
+func GetMenuVersion() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		var version models.MenuVersion
+		defer cancel()
+
+		err := menuVersionCollection.FindOne(ctx, bson.M{"menu_id": c.Param("menu_id"), "version_id": c.Param("version_id")}).Decode(&version)
+
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error":"Error occured while fetching the menu version"})
+			return
+		}
+
+		c.JSON(http.StatusOK, version)
+	}
+}
+
+func GetMenuVersionDiff() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		var version models.MenuVersion
+		defer cancel()
+
+		err := menuVersionCollection.FindOne(ctx, bson.M{"menu_id": c.Param("menu_id"), "version_id": c.Param("version_id")}).Decode(&version)
+
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error":"Error occured while fetching the menu version"})
+			return
+		}
+
+		diff, err := diffMenuVersion(ctx, version)
+
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error":"Error occured while comparing the menu version"})
+			return
+		}
+
+		c.JSON(http.StatusOK, diff)
+	}
+}
+
+// Starts a draft as a copy of the live menu and its foods
+func CreateMenuVersion() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		menuId := c.Param("menu_id")
+		defer cancel()
+
+		version, err := newMenuVersion(ctx, menuId, "DRAFT", c.GetString("uid"))
+
+		if err != nil {
+			msg := fmt.Sprintf("Menu draft was not created")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+			return
+		}
+
+		c.JSON(http.StatusOK, version)
+	}
+}
+
+// Edits a draft: menu fields are updated when given, foods replace the draft's foods
+// (foods without food_id are new ones, the others must be on the menu or in the draft)
+func UpdateMenuVersion() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		var version models.MenuVersion
+		var edit MenuVersionEdit
+		defer cancel()
+
+		if err := c.BindJSON(&edit); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error":err.Error()})
+			return
+		}
+
+		err := menuVersionCollection.FindOne(ctx, bson.M{"menu_id": c.Param("menu_id"), "version_id": c.Param("version_id")}).Decode(&version)
+
+		if err != nil {
+			msg := fmt.Sprintf("Menu version was not found")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+			return
+		}
+
+		if version.Status != "DRAFT" {
+			c.JSON(http.StatusConflict, gin.H{"error": "Only drafts can be edited"})
+			return
+		}
+
+		if edit.Menu != nil {
+			if edit.Menu.Name != "" {
+				version.Menu.Name = edit.Menu.Name
+			}
+
+			if edit.Menu.Category != "" {
+				version.Menu.Category = edit.Menu.Category
+			}
+
+			if edit.Menu.Name_translations != nil {
+				version.Menu.Name_translations = edit.Menu.Name_translations
+			}
+
+			if edit.Menu.Category_translations != nil {
+				version.Menu.Category_translations = edit.Menu.Category_translations
+			}
+
+			if edit.Menu.Start_Date != nil && edit.Menu.End_Date != nil {
+				version.Menu.Start_Date = edit.Menu.Start_Date
+				version.Menu.End_Date = edit.Menu.End_Date
+			}
+
+			if validationErr := validate.Struct(version.Menu); validationErr != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error":validationErr.Error()})
+				return
+			}
+		}
+
+		if edit.Foods != nil {
+			now, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+			snapshot := map[string]models.Food{}
+			seen := map[string]bool{}
+
+			for _, food := range version.Foods {
+				snapshot[food.Food_id] = food
+			}
+
+			for i := range edit.Foods {
+				food := &edit.Foods[i]
+				food.Menu_id = &version.Menu_id
+
+				if validationErr := validate.Struct(*food); validationErr != nil {
+					c.JSON(http.StatusBadRequest, gin.H{"error":validationErr.Error()})
+					return
+				}
+
+				if err := checkRecipe(ctx, food.Recipe); err != nil {
+					c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+					return
+				}
+
+				if err := deriveFood(ctx, food); err != nil {
+					msg := fmt.Sprintf("Allergens and nutrition of the food item could not be derived")
+					c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+					return
+				}
+
+				// _id always comes from the stored food, never from the client
+				if food.Food_id == "" {
+					food.ID = primitive.NewObjectID()
+					food.Food_id = food.ID.Hex()
+					food.Created_at = now
+				} else {
+					var liveFood models.Food
+
+					if seen[food.Food_id] {
+						c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Food %s is listed more than once", food.Food_id)})
+						return
+					}
+
+					seen[food.Food_id] = true
+					snapshotFood, inSnapshot := snapshot[food.Food_id]
+					err := foodCollection.FindOne(ctx, bson.M{"food_id": food.Food_id}).Decode(&liveFood)
+
+					if err != nil && err != mongo.ErrNoDocuments {
+						msg := fmt.Sprintf("Error occured while checking the food items")
+						c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+						return
+					}
+
+					found := err == nil
+					onMenu := found && liveFood.Menu_id != nil && *liveFood.Menu_id == version.Menu_id
+
+					if found && liveFood.Menu_id != nil && !onMenu {
+						c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Food %s belongs to another menu", food.Food_id)})
+						return
+					}
+
+					switch {
+					case onMenu || (found && inSnapshot):
+						food.ID = liveFood.ID
+						food.Created_at = liveFood.Created_at
+					case inSnapshot && !snapshotFood.ID.IsZero():
+						food.ID = snapshotFood.ID
+						food.Created_at = snapshotFood.Created_at
+					case inSnapshot:
+						food.ID = primitive.NewObjectID()
+						food.Created_at = now
+					default:
+						c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Food %s is not on this menu", food.Food_id)})
+						return
+					}
+				}
+
+				var num = toFixed(*food.Price, 2)
+				food.Price = &num
+				food.Updated_at = now
+			}
+
+			version.Foods = edit.Foods
+		}
+
+		version.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+
+		_, err = menuVersionCollection.ReplaceOne(ctx, bson.M{"version_id": version.Version_id}, version)
+
+		if err != nil {
+			msg := fmt.Sprintf("Menu draft update failed")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+			return
+		}
+
+		c.JSON(http.StatusOK, version)
+	}
+}
+
+// Publishes a draft now, or schedules it when publish_at lies in the future
+func PublishMenuVersion() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		var version models.MenuVersion
+		var schedule struct {
+			Publish_at		*time.Time		`json:"publish_at"`
+		}
+		defer cancel()
+
+		if c.Request.ContentLength > 0 {
+			if err := c.BindJSON(&schedule); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error":err.Error()})
+				return
+			}
+		}
+
+		err := menuVersionCollection.FindOne(ctx, bson.M{"menu_id": c.Param("menu_id"), "version_id": c.Param("version_id")}).Decode(&version)
+
+		if err != nil {
+			msg := fmt.Sprintf("Menu version was not found")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+			return
+		}
+
+		if version.Status != "DRAFT" && version.Status != "SCHEDULED" {
+			c.JSON(http.StatusConflict, gin.H{"error": "Only drafts can be published, use rollback for previous versions"})
+			return
+		}
+
+		if schedule.Publish_at != nil && schedule.Publish_at.After(time.Now()) {
+			updatedAt, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+
+			_, err = menuVersionCollection.UpdateOne(
+				ctx,
+				bson.M{"version_id": version.Version_id},
+				bson.D{{Key: "$set", Value: bson.D{{Key: "status", Value: "SCHEDULED"}, {Key: "publish_at", Value: schedule.Publish_at}, {Key: "updated_at", Value: updatedAt}}}},
+			)
+
+			if err != nil {
+				msg := fmt.Sprintf("Menu version was not scheduled")
+				c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+				return
+			}
+
+			c.JSON(http.StatusOK, gin.H{"version_id": version.Version_id, "status": "SCHEDULED", "publish_at": schedule.Publish_at})
+			return
+		}
+
+		stale, err := staleMenuFoods(ctx, version)
+
+		if err != nil {
+			msg := fmt.Sprintf("Error occured while checking the menu foods")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+			return
+		}
+
+		if len(stale) > 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "Foods of the menu changed since the draft was created, start a new draft", "food_ids": stale})
+			return
+		}
+
+		if err := publishMenuVersion(ctx, version, c.GetString("uid")); err != nil {
+			msg := fmt.Sprintf("Menu version was not published")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"version_id": version.Version_id, "status": "PUBLISHED"})
+	}
+}
+
+// Publishes a previously published version again; without version_id the one
+// published before the current one is used
+func RollbackMenu() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		var version models.MenuVersion
+		var target struct {
+			Version_id		string		`json:"version_id"`
+		}
+		menuId := c.Param("menu_id")
+		defer cancel()
+
+		if c.Request.ContentLength > 0 {
+			if err := c.BindJSON(&target); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error":err.Error()})
+				return
+			}
+		}
+
+		filter := bson.M{"menu_id": menuId, "status": "ARCHIVED"}
+		opts := options.FindOne().SetSort(bson.D{{Key: "published_at", Value: -1}, {Key: "version", Value: -1}})
+
+		if target.Version_id != "" {
+			filter["version_id"] = target.Version_id
+		}
+
+		err := menuVersionCollection.FindOne(ctx, filter, opts).Decode(&version)
+
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "No previous menu version was found"})
+			return
+		}
+
+		if err := publishMenuVersion(ctx, version, c.GetString("uid")); err != nil {
+			msg := fmt.Sprintf("Menu rollback failed")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"version_id": version.Version_id, "version": version.Version, "status": "PUBLISHED"})
+	}
+}
@@ -0,0 +1,231 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lackingworth/Go-Restaurant-Management/database"
+	helper "github.com/lackingworth/Go-Restaurant-Management/helpers"
+	"github.com/lackingworth/Go-Restaurant-Management/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var noteCollection *mongo.Collection = database.OpenCollection(database.Client, "note")
+
+var noteListSpec = helper.ListSpec{
+	Filters: map[string]helper.FieldKind{"entity_type": helper.STRING_FIELD, "entity_id": helper.STRING_FIELD, "created_by": helper.STRING_FIELD},
+	Sorts: []string{"-created_at", "updated_at"},
+	Date_field: "created_at",
+}
+
+// Bills and kitchen tickets look notes up by their entity
+func EnsureNoteIndexes() error {
+	var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	_, err := noteCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "entity_type", Value: 1}, {Key: "entity_id", Value: 1}, {Key: "created_at", Value: 1}},
+		Options: options.Index().SetName("note_entity"),
+	})
+
+	return err
+}
+
+// Collection holding the entities notes of the type are attached to, w/ their id field
+func noteEntity(entityType string) (*mongo.Collection, string) {
+	switch entityType {
+	case "ORDER":
+		return orderCollection, "order_id"
+	case "ORDER_ITEM":
+		return orderItemCollection, "order_item_id"
+	default:
+		return tableCollection, "table_id"
+	}
+}
+
+// Note texts of the entities, oldest first, keyed by entity id
+func entityNotes(ctx context.Context, entityType string, entityIds []string) (map[string][]string, error) {
+	notes := map[string][]string{}
+
+	if len(entityIds) == 0 {
+		return notes, nil
+	}
+
+	res, err := noteCollection.Find(ctx, bson.M{"entity_type": entityType, "entity_id": bson.M{"$in": entityIds}}, options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}))
+
+	if err != nil {
+		return nil, err
+	}
+
+	var found []models.Note
+
+	if err = res.All(ctx, &found); err != nil {
+		return nil, err
+	}
+
+	for _, note := range found {
+		notes[note.Entity_id] = append(notes[note.Entity_id], note.Text)
+	}
+
+	return notes, nil
+}
+
+func GetNotes() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		helper.RespondWithList(c, ctx, noteCollection, noteListSpec, bson.D{}, "Error occured while listing notes", nil)
+	}
+}
+
+func GetNote() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		var note models.Note
+		noteId := c.Param("note_id")
+		defer cancel()
+
+		err := noteCollection.FindOne(ctx, bson.M{"note_id": noteId}).Decode(&note)
+
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error":"Error occured while fetching the note"})
+			return
+		}
+
+		c.JSON(http.StatusOK, note)
+	}
+}
+
+// Attaches a note to an existing order, order item or table
+func CreateNote() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		var note models.Note
+		defer cancel()
+
+		if err := c.BindJSON(&note); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error":err.Error()})
+			return
+		}
+
+		validationErr := validate.Struct(note)
+
+		if validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error":validationErr.Error()})
+			return
+		}
+
+		collection, idField := noteEntity(note.Entity_type)
+		count, err := collection.CountDocuments(ctx, bson.M{idField: note.Entity_id})
+
+		if err != nil {
+			msg := fmt.Sprintf("Error occured while checking the %s", idField)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+			return
+		}
+
+		if count == 0 {
+			msg := fmt.Sprintf("No %s %s was found", idField, note.Entity_id)
+			c.JSON(http.StatusNotFound, gin.H{"error": msg})
+			return
+		}
+
+		note.Created_by = c.GetString("uid")
+		note.Created_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		note.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		note.ID = primitive.NewObjectID()
+		note.Note_id = note.ID.Hex()
+
+		_, insertErr := noteCollection.InsertOne(ctx, note)
+
+		if insertErr != nil {
+			msg := fmt.Sprintf("Note was not created")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+			return
+		}
+
+		c.JSON(http.StatusOK, note)
+	}
+}
+
+// Updates the text / title of the note; it stays attached to the same entity
+func UpdateNote() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		var note models.Note
+		var updateObj primitive.D
+		noteId := c.Param("note_id")
+		defer cancel()
+
+		if err := c.BindJSON(&note); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error":err.Error()})
+			return
+		}
+
+		if note.Text != "" {
+			if err := validate.Var(note.Text, "max=500"); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "text must be at most 500 characters"})
+				return
+			}
+
+			updateObj = append(updateObj, bson.E{Key: "text", Value: note.Text})
+		}
+
+		if note.Title != "" {
+			if err := validate.Var(note.Title, "max=100"); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "title must be at most 100 characters"})
+				return
+			}
+
+			updateObj = append(updateObj, bson.E{Key: "title", Value: note.Title})
+		}
+
+		note.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		updateObj = append(updateObj, bson.E{Key: "updated_at", Value: note.Updated_at})
+
+		res, err := noteCollection.UpdateOne(ctx, bson.M{"note_id": noteId}, bson.D{{Key: "$set", Value: updateObj}})
+
+		if err != nil {
+			msg := fmt.Sprintf("Note update failed")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+			return
+		}
+
+		if res.MatchedCount == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Note was not found"})
+			return
+		}
+
+		c.JSON(http.StatusOK, res)
+	}
+}
+
+func DeleteNote() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		noteId := c.Param("note_id")
+		defer cancel()
+
+		res, err := noteCollection.DeleteOne(ctx, bson.M{"note_id": noteId})
+
+		if err != nil {
+			msg := fmt.Sprintf("Note was not deleted")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+			return
+		}
+
+		if res.DeletedCount == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Note was not found"})
+			return
+		}
+
+		c.JSON(http.StatusOK, res)
+	}
+}
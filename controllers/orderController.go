@@ -2,6 +2,7 @@ package controllers
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
@@ -9,6 +10,7 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/lackingworth/Go-Restaurant-Management/database"
+	helper "github.com/lackingworth/Go-Restaurant-Management/helpers"
 	"github.com/lackingworth/Go-Restaurant-Management/models"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -18,24 +20,18 @@ import (
 
 var orderCollection *mongo.Collection = database.OpenCollection(database.Client, "order")
 
+var orderListSpec = helper.ListSpec{
+	Filters: map[string]helper.FieldKind{"order_type": helper.STRING_FIELD, "table_id": helper.STRING_FIELD, "server_id": helper.STRING_FIELD, "allergy_policy": helper.STRING_FIELD, "customer_phone": helper.STRING_FIELD},
+	Sorts: []string{"-order_date", "promised_at", "created_at", "updated_at"},
+	Date_field: "order_date",
+}
+
 func GetOrders() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
-
-		res, err := orderCollection.Find(context.TODO(), bson.M{})
 		defer cancel()
 
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error":"Error occured while listing order items"})
-		}
-
-		var allOrders []bson.M
-
-		if err = res.All(ctx, &allOrders); err != nil {
-			log.Fatal(err)
-		}
-
-		c.JSON(http.StatusOK, allOrders)
+		helper.RespondWithList(c, ctx, orderCollection, orderListSpec, bson.D{}, "Error occured while listing order items", nil)
 	}
 }
 
@@ -67,6 +63,15 @@ func CreateOrder() gin.HandlerFunc {
 			return
 		}
 
+		// Only orders coming in from delivery platforms have a source
+		order.Source = nil
+		order.External_id = nil
+
+		// Orders w/o a type are dine-in, as all orders were before takeaway and delivery
+		if order.Order_type == "" {
+			order.Order_type = "DINE_IN"
+		}
+
 		validationErr := validate.Struct(order)
 
 		if validationErr != nil {
@@ -74,6 +79,11 @@ func CreateOrder() gin.HandlerFunc {
 			return
 		}
 
+		if status, err := applyDeliveryZone(ctx, &order); err != nil {
+			c.JSON(status, gin.H{"error": err.Error()})
+			return
+		}
+
 		if order.Table_id != nil {
 			err := tableCollection.FindOne(ctx, bson.M{"table_id": order.Table_id}).Decode(&table)
 			defer cancel()
@@ -83,12 +93,19 @@ func CreateOrder() gin.HandlerFunc {
 				c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
 				return
 			}
+
+			// Orders belong to the server on shift in the table's section unless one is given
+			if order.Server_id == nil {
+				order.Server_id = sectionServer(ctx, table, time.Now())
+			}
 		}
 
 		order.Created_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
 		order.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
 		order.ID = primitive.NewObjectID()
 		order.Order_id = order.ID.Hex()
+		order.Merged_into = nil
+		order.Ready_at = nil
 
 		res, insertErr := orderCollection.InsertOne(ctx, order)
 
@@ -98,6 +115,12 @@ func CreateOrder() gin.HandlerFunc {
 			return 
 		}
 
+		if order.Table_id != nil {
+			if err := RefreshTableStatus(ctx, *order.Table_id); err != nil {
+				log.Println(err)
+			}
+		}
+
 		defer cancel()
 		c.JSON(http.StatusOK, res)
 	}
@@ -108,6 +131,8 @@ func UpdateOrder() gin.HandlerFunc {
 		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
 		var table models.Table
 		var order models.Order
+		var current models.Order
+		var existing models.Order
 		var updateObj primitive.D
 		orderId := c.Param("order_id")
 		defer cancel()
@@ -118,6 +143,52 @@ func UpdateOrder() gin.HandlerFunc {
 			return
 		}
 
+		// The type of an order cannot change, so its fields have to fit the type it already has
+		if orderCollection.FindOne(ctx, bson.M{"order_id": orderId}).Decode(&existing) == nil {
+			if existing.Order_type == "" {
+				existing.Order_type = "DINE_IN"
+			}
+
+			if order.Table_id != nil {
+				existing.Table_id = order.Table_id
+			}
+
+			if order.Customer_name != nil {
+				existing.Customer_name = order.Customer_name
+			}
+
+			if order.Customer_phone != nil {
+				existing.Customer_phone = order.Customer_phone
+			}
+
+			if order.Delivery_address != nil {
+				existing.Delivery_address = order.Delivery_address
+			}
+
+			if order.Promised_at != nil {
+				existing.Promised_at = order.Promised_at
+			}
+
+			if order.Delivery_location != nil {
+				existing.Delivery_location = order.Delivery_location
+			}
+
+			if validationErr := validate.Struct(existing); validationErr != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+				return
+			}
+
+			// A new location may be in another zone w/ another fee
+			if order.Delivery_location != nil {
+				if status, err := applyDeliveryZone(ctx, &existing); err != nil {
+					c.JSON(status, gin.H{"error": err.Error()})
+					return
+				}
+
+				updateObj = append(updateObj, bson.E{Key: "delivery_location", Value: existing.Delivery_location}, bson.E{Key: "delivery_zone_id", Value: existing.Delivery_zone_id}, bson.E{Key: "delivery_fee", Value: existing.Delivery_fee})
+			}
+		}
+
 		if order.Table_id != nil {
 			err := tableCollection.FindOne(ctx, bson.M{"table_id": order.Table_id}).Decode(&table)
 			defer cancel()
@@ -127,8 +198,39 @@ func UpdateOrder() gin.HandlerFunc {
 				c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
 				return 
 			}
+
+			current, err = openOrder(ctx, orderId)
+
+			if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+				orderMoveError(c, err)
+				return
+			}
 			
-			updateObj = append(updateObj, bson.E{Key: "table", Value: order.Table_id})
+			updateObj = append(updateObj, bson.E{Key: "table_id", Value: order.Table_id})
+		}
+
+		if order.Customer_name != nil {
+			updateObj = append(updateObj, bson.E{Key: "customer_name", Value: order.Customer_name})
+		}
+
+		if order.Customer_phone != nil {
+			updateObj = append(updateObj, bson.E{Key: "customer_phone", Value: order.Customer_phone})
+		}
+
+		if order.Delivery_address != nil {
+			updateObj = append(updateObj, bson.E{Key: "delivery_address", Value: order.Delivery_address})
+		}
+
+		if order.Promised_at != nil {
+			updateObj = append(updateObj, bson.E{Key: "promised_at", Value: order.Promised_at})
+		}
+
+		if order.Allergy_profile != nil {
+			updateObj = append(updateObj, bson.E{Key: "allergy_profile", Value: order.Allergy_profile})
+		}
+
+		if order.Allergy_policy != nil {
+			updateObj = append(updateObj, bson.E{Key: "allergy_policy", Value: order.Allergy_policy})
 		}
 
 		order.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
@@ -154,20 +256,35 @@ func UpdateOrder() gin.HandlerFunc {
 			return
 		}
 
+		// Moving the order through the update is a transfer like POST /orders/:order_id/transfer
+		if order.Table_id != nil && current.Order_id != "" && (current.Table_id == nil || *current.Table_id != *order.Table_id) {
+			move := models.TableMove{Type: "TRANSFER", Order_id: orderId, From_table_id: current.Table_id, To_table_id: order.Table_id, Moved_by: c.GetString("uid")}
+
+			if err := recordTableMove(ctx, move); err != nil {
+				log.Println(err)
+			}
+
+			refreshMovedTables(ctx, current.Table_id, order.Table_id)
+		}
+
 		defer cancel()
 		c.JSON(http.StatusOK, res)
 	}
 }
 
-func OrderItemOrderCreator(order models.Order) string {
-	var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+// Prepares the order items are placed on (server of the table, timestamps and id); it is
+// inserted together w/ its items, see placeOrder
+func OrderItemOrderCreator(ctx context.Context, order models.Order) models.Order {
+	var table models.Table
+
+	if order.Table_id != nil && order.Server_id == nil && tableCollection.FindOne(ctx, bson.M{"table_id": order.Table_id}).Decode(&table) == nil {
+		order.Server_id = sectionServer(ctx, table, time.Now())
+	}
+
 	order.Created_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
 	order.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
 	order.ID = primitive.NewObjectID()
 	order.Order_id = order.ID.Hex()
 
-	orderCollection.InsertOne(ctx, order)
-	defer cancel()
-
-	return order.Order_id
+	return order
 }
\ No newline at end of file
@@ -2,23 +2,39 @@ package controllers
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/lackingworth/Go-Restaurant-Management/database"
+	helper "github.com/lackingworth/Go-Restaurant-Management/helpers"
 	"github.com/lackingworth/Go-Restaurant-Management/models"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 type OrderItemPack struct {
-	Table_id		*string
-	Order_items		[]models.OrderItem
+	Order_type			string
+	Table_id			*string
+	Customer_name		*string
+	Customer_phone		*string
+	Delivery_address	*string
+	Delivery_location	*models.GeoPoint
+	Promised_at			*time.Time
+	Allergy_profile		[]string
+	Allergy_policy		*string
+	Order_items			[]models.OrderItem
+}
+
+// Order as created w/ all of its items
+type PlacedOrder struct {
+	models.Order
+	Order_items			[]models.OrderItem		`json:"order_items"`
 }
 
 var orderItemCollection *mongo.Collection = database.OpenCollection(database.Client, "orderItem")
@@ -33,6 +49,10 @@ func ItemsByOrder(id string) (OrderItems []primitive.M, err error) {
 	lookupStage := bson.D{{Key: "$lookup", Value: bson.D{{Key: "from", Value: "food"}, {Key: "localField", Value: "food_id"}, {Key: "foreignField", Value: "food_id"}, {Key: "as", Value: "food"}} /*end*/}}
 	unwindStage := bson.D{{Key: "$unwind", Value: bson.D{{Key: "path", Value: "$food"}, {Key: "preserveNullAndEmptyArrays", Value: true}} /*end*/}}
 
+	// MongoDB Aggregation stages for BundleID field
+	lookupBundleStage := bson.D{{Key: "$lookup", Value: bson.D{{Key: "from", Value: "bundle"}, {Key: "localField", Value: "bundle_id"}, {Key: "foreignField", Value: "bundle_id"}, {Key: "as", Value: "bundle"}} /*end*/}}
+	unwindBundleStage := bson.D{{Key: "$unwind", Value: bson.D{{Key: "path", Value: "$bundle"}, {Key: "preserveNullAndEmptyArrays", Value: true}} /*end*/}}
+
 	// MongoDB Aggregation stages for OrderID field
 	lookupOrderStage := bson.D{{Key: "$lookup", Value: bson.D{{Key: "from", Value: "order"}, {Key: "localField", Value: "order_id"}, {Key: "foreignField", Value: "order_id"}, {Key: "as", Value: "order"}} /*end*/}}
 	unwindOrderStage := bson.D{{Key: "$unwind", Value: bson.D{{Key: "path", Value: "$order"}, {Key: "preserveNullAndEmptyArrays", Value: true}} /*end*/}}
@@ -41,8 +61,13 @@ func ItemsByOrder(id string) (OrderItems []primitive.M, err error) {
 	lookupTableStage := bson.D{{Key: "$lookup", Value: bson.D{{Key: "from", Value: "table"}, {Key: "localField", Value: "order.table_id"}, {Key: "foreignField", Value: "table_id"}, {Key: "as", Value: "table"}} /*end*/}}
 	unwindTableStage := bson.D{{Key: "$unwind", Value: bson.D{{Key: "path", Value: "$table"}, {Key: "preserveNullAndEmptyArrays", Value: true}} /*end*/}}
 
-	// MongoDB Aggregation 1st project stage
-	projectStage := bson.D{{Key: "$project", Value: bson.D{{Key: "id", Value: 0}, {Key: "amount", Value: "$food.price"}, {Key: "total_count", Value: 1}, {Key: "food_name", Value: "$food.name"}, {Key: "food_image", Value: "$food.food_image"}, {Key: "table_number", Value: "$table.table_number"}, {Key: "table_id", Value: "$table.table_id"}, {Key: "order_id", Value: "$order.order_id"}, {Key: "price", Value: "$food.price"}, {Key: "quantity", Value: 1}} /*end*/}}
+	// MongoDB Aggregation stage for the notes of the item (oldest first)
+	notesMatch := bson.D{{Key: "$match", Value: bson.D{{Key: "entity_type", Value: "ORDER_ITEM"}, {Key: "$expr", Value: bson.D{{Key: "$eq", Value: bson.A{"$entity_id", "$$order_item_id"}}}}} /*end*/}}
+	lookupNotesStage := bson.D{{Key: "$lookup", Value: bson.D{{Key: "from", Value: "note"}, {Key: "let", Value: bson.D{{Key: "order_item_id", Value: "$order_item_id"}}}, {Key: "pipeline", Value: bson.A{notesMatch, bson.D{{Key: "$sort", Value: bson.D{{Key: "created_at", Value: 1}}}}}}, {Key: "as", Value: "notes"}} /*end*/}}
+
+	// MongoDB Aggregation 1st project stage; voided and comped items stay listed but are not billed
+	billedAmount := bson.D{{Key: "$cond", Value: bson.A{bson.D{{Key: "$eq", Value: bson.A{bson.D{{Key: "$ifNull", Value: bson.A{"$adjustment", nil}}}, nil}}}, "$unit_price", 0}}}
+	projectStage := bson.D{{Key: "$project", Value: bson.D{{Key: "id", Value: 0}, {Key: "amount", Value: billedAmount}, {Key: "total_count", Value: 1}, {Key: "food_name", Value: bson.D{{Key: "$ifNull", Value: bson.A{"$food.name", "$bundle.name"}}}}, {Key: "bundle_id", Value: 1}, {Key: "components", Value: 1}, {Key: "food_image", Value: "$food.food_image"}, {Key: "table_number", Value: "$table.table_number"}, {Key: "table_id", Value: "$table.table_id"}, {Key: "order_id", Value: "$order.order_id"}, {Key: "price", Value: "$unit_price"}, {Key: "quantity", Value: 1}, {Key: "course", Value: bson.D{{Key: "$ifNull", Value: bson.A{"$course", 1}}}}, {Key: "course_status", Value: bson.D{{Key: "$ifNull", Value: bson.A{"$course_status", "FIRED"}}}}, {Key: "notes", Value: "$notes.text"}, {Key: "adjustment", Value: 1}} /*end*/}}
 
 	// MongoDB Aggregation group stage
 	groupStage := bson.D{{Key: "$group", Value: bson.D{{Key: "_id", Value: bson.D{{Key: "order_id", Value: "$order_id"}, {Key: "table_id", Value: "$table_id"}, {Key: "table_number", Value: "$table_number"}}}, {Key: "payment_due", Value: bson.D{{Key: "$sum", Value: "$amount"}}}, {Key: "total_count", Value: bson.D{{Key: "$sum", Value: 1}}}, {Key: "order_items", Value: bson.D{{Key: "$push", Value: "$$ROOT"}}} } /*end*/}}
@@ -50,14 +75,17 @@ func ItemsByOrder(id string) (OrderItems []primitive.M, err error) {
 	// MongoDB Aggregation 2nd project stage
 	projectStage2 := bson.D{{Key: "$project", Value: bson.D{{Key: "id", Value: 0}, {Key: "payment_due", Value: 1}, {Key: "total_count", Value: 1}, {Key: "table_number", Value: "$_id.table_number"}, {Key: "order_items", Value: 1}} /*end*/}}
 
-	res, err := orderCollection.Aggregate(ctx, mongo.Pipeline{
+	res, err := orderItemCollection.Aggregate(ctx, mongo.Pipeline{
 		matchStage,
 		lookupStage,
 		unwindStage,
+		lookupBundleStage,
+		unwindBundleStage,
 		lookupOrderStage,
 		unwindOrderStage,
 		lookupTableStage,
 		unwindTableStage,
+		lookupNotesStage,
 		projectStage,
 		groupStage,
 		projectStage2,
@@ -76,27 +104,142 @@ func ItemsByOrder(id string) (OrderItems []primitive.M, err error) {
 	return OrderItems, err
 }
 
-func GetOrderItems() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+// Returns the allergens of the food that are part of the guest's allergy profile
+func allergyConflicts(ctx context.Context, foodId string, profile []string) (conflicts []string, err error) {
+	var food models.Food
 
-		res, err := orderItemCollection.Find(context.TODO(), bson.M{})
+	if len(profile) == 0 {
+		return
+	}
 
-		defer cancel()
+	err = foodCollection.FindOne(ctx, bson.M{"food_id": foodId}).Decode(&food)
+
+	if err != nil {
+		return
+	}
+
+	for _, allergen := range food.Contains {
+		if contains(profile, allergen) {
+			conflicts = append(conflicts, allergen)
+		}
+	}
+
+	return
+}
+
+// Prices the item at the order date (bundles at the bundle price), validates it and checks it against the
+// allergy profile of the order; the returned status is the one to respond w/ when the item cannot be ordered
+func prepareOrderItem(ctx context.Context, order models.Order, orderItem models.OrderItem) (models.OrderItem, int, error) {
+	var bundle models.Bundle
+	orderItem.Order_id = order.Order_id
+
+	// Bundles are billed at the bundle price, not at the price of their components
+	if orderItem.Bundle_id != nil {
+		err := bundleCollection.FindOne(ctx, bson.M{"bundle_id": orderItem.Bundle_id}).Decode(&bundle)
 
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error":"Error occured while listing ordered items"})
-			return
+			return orderItem, http.StatusInternalServerError, fmt.Errorf("Bundle was not found")
 		}
 
-		var allOrderItems []bson.M
+		orderItem.Unit_price = bundle.Price
+	} else if orderItem.Food_id != nil {
+		var food models.Food
 
-		if err := res.All(ctx, &allOrderItems); err != nil {
-			log.Fatal(err)
-			return
+		err := foodCollection.FindOne(ctx, bson.M{"food_id": orderItem.Food_id}).Decode(&food)
+
+		if err != nil {
+			return orderItem, http.StatusInternalServerError, fmt.Errorf("Food item was not found")
 		}
 
-		c.JSON(http.StatusOK, allOrderItems)
+		// Snapshot of the price in effect now, so invoices never change retroactively
+		price := effectivePrice(ctx, food, order.Order_Date)
+		orderItem.Unit_price = &price
+	}
+
+	validationErr := validate.Struct(orderItem)
+
+	if validationErr != nil {
+		return orderItem, http.StatusBadRequest, validationErr
+	}
+
+	foodIds := []string{}
+
+	if orderItem.Bundle_id != nil {
+		if err := checkBundleComponents(ctx, bundle, orderItem.Components); err != nil {
+			return orderItem, http.StatusBadRequest, err
+		}
+
+		for _, component := range orderItem.Components {
+			foodIds = append(foodIds, component.Food_id)
+		}
+	} else {
+		foodIds = append(foodIds, *orderItem.Food_id)
+	}
+
+	var conflicts []string
+
+	for _, foodId := range foodIds {
+		foodConflicts, err := allergyConflicts(ctx, foodId, order.Allergy_profile)
+
+		if err != nil {
+			return orderItem, http.StatusInternalServerError, fmt.Errorf("Food item was not found")
+		}
+
+		for _, allergen := range foodConflicts {
+			if !contains(conflicts, allergen) {
+				conflicts = append(conflicts, allergen)
+			}
+		}
+	}
+
+	orderItem.Allergy_warnings = conflicts
+
+	if len(conflicts) > 0 && order.Allergy_policy != nil && *order.Allergy_policy == "BLOCK" {
+		return orderItem, http.StatusConflict, fmt.Errorf("Order item conflicts with the allergy profile: %s", strings.Join(conflicts, ", "))
+	}
+
+	// Items are only voided / comped after they are ordered, w/ approval
+	orderItem.Adjustment = nil
+	orderItem.Adjustment_id = nil
+
+	orderItem.ID = primitive.NewObjectID()
+	orderItem.Created_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	orderItem.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	orderItem.Order_item_id = orderItem.ID.Hex()
+
+	var n = toFixed(*orderItem.Unit_price, 2)
+	orderItem.Unit_price = &n
+
+	// Starters go to the kitchen right away, later courses (and items sent w/ course_status HELD) wait to be fired
+	if orderItem.Course == nil {
+		course := 1
+		orderItem.Course = &course
+	}
+
+	orderItem.Fired_at = nil
+
+	if *orderItem.Course == 1 && orderItem.Course_status != "HELD" {
+		orderItem.Course_status = "FIRED"
+		orderItem.Fired_at = &orderItem.Created_at
+	} else {
+		orderItem.Course_status = "HELD"
+	}
+
+	return orderItem, http.StatusOK, nil
+}
+
+var orderItemListSpec = helper.ListSpec{
+	Filters: map[string]helper.FieldKind{"order_id": helper.STRING_FIELD, "food_id": helper.STRING_FIELD, "bundle_id": helper.STRING_FIELD, "quantity": helper.STRING_FIELD},
+	Sorts: []string{"-created_at", "unit_price", "updated_at"},
+	Date_field: "created_at",
+}
+
+func GetOrderItems() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		helper.RespondWithList(c, ctx, orderItemCollection, orderItemListSpec, bson.D{}, "Error occured while listing ordered items", nil)
 	}
 }
 
@@ -134,6 +277,120 @@ func GetOrderItem() gin.HandlerFunc {
 	}
 }
 
+// Opens the order and adds the items to it; staff orders and orders of delivery platforms (Source set) share this path.
+// All items are validated before anything is written, then the order and its items are inserted in one transaction.
+// On http.StatusConflict the allergens the rejected item conflicts w/ are returned as well
+func placeOrder(ctx context.Context, order models.Order, orderItems []models.OrderItem) (PlacedOrder, []string, int, error) {
+	placed := PlacedOrder{Order_items: []models.OrderItem{}}
+	orderItemsToBeInserted := []interface{}{}
+
+	if len(orderItems) == 0 {
+		return placed, nil, http.StatusBadRequest, fmt.Errorf("An order needs at least one item")
+	}
+
+	if order.Order_type == "" {
+		order.Order_type = "DINE_IN"
+	}
+
+	validationErr := validate.Struct(order)
+
+	if validationErr != nil {
+		return placed, nil, http.StatusBadRequest, validationErr
+	}
+
+	// Platforms deliver their orders themselves
+	if order.Source == nil {
+		if status, err := applyDeliveryZone(ctx, &order); err != nil {
+			return placed, nil, status, err
+		}
+	}
+
+	order = OrderItemOrderCreator(ctx, order)
+	itemsTotal := 0.0
+
+	for _, orderItem := range orderItems {
+		orderItem, status, err := prepareOrderItem(ctx, order, orderItem)
+
+		if err != nil {
+			return placed, orderItem.Allergy_warnings, status, err
+		}
+
+		itemsTotal += *orderItem.Unit_price
+		placed.Order_items = append(placed.Order_items, orderItem)
+		orderItemsToBeInserted = append(orderItemsToBeInserted, orderItem)
+	}
+
+	if err := checkMinimumOrder(ctx, order, itemsTotal); err != nil {
+		return placed, nil, http.StatusUnprocessableEntity, err
+	}
+
+	if err := writePlacedOrder(ctx, placedOrders, order, orderItemsToBeInserted); err != nil {
+		return placed, nil, http.StatusInternalServerError, fmt.Errorf("Order was not created")
+	}
+
+	placed.Order = order
+	refreshOrderTable(ctx, order.Order_id)
+
+	return placed, nil, http.StatusOK, nil
+}
+
+// Where placeOrder writes new orders and their items
+type orderStore interface {
+	WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error
+	InsertOrder(ctx context.Context, order models.Order) error
+	InsertOrderItems(ctx context.Context, orderItems []interface{}) error
+	DiscardOrder(ctx context.Context, orderId string)
+}
+
+type mongoOrderStore struct{}
+
+var placedOrders orderStore = mongoOrderStore{}
+
+func (mongoOrderStore) WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	return database.WithTransaction(ctx, func(sessCtx mongo.SessionContext) error {
+		return fn(sessCtx)
+	})
+}
+
+func (mongoOrderStore) InsertOrder(ctx context.Context, order models.Order) error {
+	_, err := orderCollection.InsertOne(ctx, order)
+	return err
+}
+
+func (mongoOrderStore) InsertOrderItems(ctx context.Context, orderItems []interface{}) error {
+	_, err := orderItemCollection.InsertMany(ctx, orderItems)
+	return err
+}
+
+// Removes an order that could not be placed completely along w/ the items inserted for it
+func (mongoOrderStore) DiscardOrder(ctx context.Context, orderId string) {
+	if _, err := orderItemCollection.DeleteMany(ctx, bson.M{"order_id": orderId}); err != nil {
+		log.Println(err)
+	}
+
+	if _, err := orderCollection.DeleteOne(ctx, bson.M{"order_id": orderId}); err != nil {
+		log.Println(err)
+	}
+}
+
+// Inserts the order and its items in one transaction; w/o transactions (standalone servers) whatever
+// was written before a failure is removed again, so a failed order never shows up half placed
+func writePlacedOrder(ctx context.Context, store orderStore, order models.Order, orderItems []interface{}) error {
+	err := store.WithTransaction(ctx, func(ctx context.Context) error {
+		if err := store.InsertOrder(ctx, order); err != nil {
+			return err
+		}
+
+		return store.InsertOrderItems(ctx, orderItems)
+	})
+
+	if err != nil {
+		store.DiscardOrder(ctx, order.Order_id)
+	}
+
+	return err
+}
+
 func CreateOrderItem() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
@@ -143,42 +400,34 @@ func CreateOrderItem() gin.HandlerFunc {
 
 		if err := c.BindJSON(&orderItemPack); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
 		}
 
 		order.Order_Date, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
 
-		orderItemsToBeInserted := []interface{}{}
+		order.Order_type = orderItemPack.Order_type
 		order.Table_id = orderItemPack.Table_id
-		order_id := OrderItemOrderCreator(order)
-
-		for _, orderItem := range orderItemPack.Order_items {
-			orderItem.Order_id = order_id
-
-			validationErr := validate.Struct(orderItem)
-
-			if validationErr != nil {
-				c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
-				return
-			}
-
-			orderItem.ID = primitive.NewObjectID()
-			orderItem.Created_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339)) 
-			orderItem.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
-			orderItem.Order_item_id = orderItem.ID.Hex()
-
-			var n = toFixed(*orderItem.Unit_price, 2)
-			orderItem.Unit_price = &n
-			orderItemsToBeInserted = append(orderItemsToBeInserted, orderItem)
+		order.Customer_name = orderItemPack.Customer_name
+		order.Customer_phone = orderItemPack.Customer_phone
+		order.Delivery_address = orderItemPack.Delivery_address
+		order.Delivery_location = orderItemPack.Delivery_location
+		order.Promised_at = orderItemPack.Promised_at
+		order.Allergy_profile = orderItemPack.Allergy_profile
+		order.Allergy_policy = orderItemPack.Allergy_policy
+
+		placed, conflicts, status, err := placeOrder(ctx, order, orderItemPack.Order_items)
+
+		if status == http.StatusConflict {
+			c.JSON(status, gin.H{"error": err.Error(), "conflicts": conflicts})
+			return
 		}
 
-		res, insertErr := orderItemCollection.InsertMany(ctx, orderItemsToBeInserted)
-
-		if insertErr != nil {
-			log.Fatal(insertErr)
+		if err != nil {
+			c.JSON(status, gin.H{"error": err.Error()})
+			return
 		}
 
-		defer cancel()
-		c.JSON(http.StatusOK, res)
+		c.JSON(http.StatusOK, placed)
 	}
 }
 
@@ -186,36 +435,91 @@ func UpdateOrderItem() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
 		var orderItem models.OrderItem
+		var current models.OrderItem
 		var updateObj primitive.D
-		orderItemId := c.Param("order_item_id")
+		orderItemId := c.Param("orderItem_id")
 		defer cancel()
-		
+
+		if err := c.BindJSON(&orderItem); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := orderItemCollection.FindOne(ctx, bson.M{"order_item_id": orderItemId}).Decode(&current); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Order item was not found"})
+			return
+		}
+
+		// Prices are fixed when ordered, lines are only taken off the bill by /void or /comp
 		if orderItem.Unit_price != nil {
-			updateObj = append(updateObj, bson.E{Key: "unit_price", Value: *&orderItem.Unit_price})
+			c.JSON(http.StatusBadRequest, gin.H{"error": "unit_price cannot be changed, void or comp the item instead"})
+			return
+		}
+
+		// Voided and comped lines are kept as they were for audit
+		if current.Adjustment != nil {
+			c.JSON(http.StatusConflict, gin.H{"error": errAlreadyAdjusted.Error()})
+			return
 		}
 
-		if orderItem.Quantity != nil {
-			updateObj = append(updateObj, bson.E{Key: "quantity", Value: *orderItem.Quantity})
+		// Bundles are priced w/ their components, they are voided and ordered again instead
+		if current.Bundle_id != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Bundle items cannot be changed, void the item and order it again"})
+			return
 		}
 
-		if orderItem.Food_id != nil {
-			updateObj = append(updateObj, bson.E{Key: "food_id", Value: *orderItem.Food_id})
+		order, err := openOrder(ctx, current.Order_id)
+
+		if errors.Is(err, errOrderClosed) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err != nil {
+			msg := fmt.Sprintf("Order was not found")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+			return
+		}
+
+		// The changed item is priced and checked against the allergy profile like a new one
+		if orderItem.Quantity != nil || orderItem.Food_id != nil {
+			merged := current
+
+			if orderItem.Quantity != nil {
+				merged.Quantity = orderItem.Quantity
+			}
+
+			if orderItem.Food_id != nil {
+				merged.Food_id = orderItem.Food_id
+			}
+
+			prepared, status, err := prepareOrderItem(ctx, order, merged)
+
+			if status == http.StatusConflict {
+				c.JSON(status, gin.H{"error": err.Error(), "conflicts": prepared.Allergy_warnings})
+				return
+			}
+
+			if err != nil {
+				c.JSON(status, gin.H{"error": err.Error()})
+				return
+			}
+
+			updateObj = append(updateObj,
+				bson.E{Key: "quantity", Value: prepared.Quantity},
+				bson.E{Key: "food_id", Value: prepared.Food_id},
+				bson.E{Key: "unit_price", Value: prepared.Unit_price},
+				bson.E{Key: "allergy_warnings", Value: prepared.Allergy_warnings},
+			)
 		}
 
 		orderItem.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339)) 
 		updateObj = append(updateObj, bson.E{Key: "updated_at", Value: orderItem.Updated_at})
-		
-		upsert := true
-		filter := bson.M{"order_item_id": orderItemId}
-		opt := options.UpdateOptions {
-			Upsert: &upsert,
-		}
 
 		res, err := orderItemCollection.UpdateOne(
 			ctx,
-			filter,
+			bson.M{"order_item_id": orderItemId, "adjustment": nil},
 			bson.D{{Key: "$set", Value: updateObj}},
-			&opt,
 		)
 
 		if err != nil {
@@ -224,7 +528,6 @@ func UpdateOrderItem() gin.HandlerFunc {
 			return
 		}
 
-		defer cancel()
 		c.JSON(http.StatusOK, res)
 	}
 }
\ No newline at end of file
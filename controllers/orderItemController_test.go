@@ -0,0 +1,149 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/lackingworth/Go-Restaurant-Management/models"
+)
+
+// In-memory orderStore; InsertOrderItems stops at the first duplicate order_item_id like an ordered
+// InsertMany does, and transactions (if enabled) roll back everything written in them
+type memoryOrderStore struct {
+	transactional	bool
+	orders			map[string]models.Order
+	orderItems		map[string]models.OrderItem
+}
+
+func newMemoryOrderStore(transactional bool) *memoryOrderStore {
+	return &memoryOrderStore{transactional: transactional, orders: map[string]models.Order{}, orderItems: map[string]models.OrderItem{}}
+}
+
+func (s *memoryOrderStore) WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	if !s.transactional {
+		return fn(ctx)
+	}
+
+	orders := map[string]models.Order{}
+	orderItems := map[string]models.OrderItem{}
+
+	for id, order := range s.orders {
+		orders[id] = order
+	}
+
+	for id, orderItem := range s.orderItems {
+		orderItems[id] = orderItem
+	}
+
+	err := fn(ctx)
+
+	if err != nil {
+		s.orders = orders
+		s.orderItems = orderItems
+	}
+
+	return err
+}
+
+func (s *memoryOrderStore) InsertOrder(ctx context.Context, order models.Order) error {
+	if _, found := s.orders[order.Order_id]; found {
+		return fmt.Errorf("duplicate order_id %s", order.Order_id)
+	}
+
+	s.orders[order.Order_id] = order
+	return nil
+}
+
+func (s *memoryOrderStore) InsertOrderItems(ctx context.Context, orderItems []interface{}) error {
+	for _, item := range orderItems {
+		orderItem := item.(models.OrderItem)
+
+		if _, found := s.orderItems[orderItem.Order_item_id]; found {
+			return fmt.Errorf("duplicate order_item_id %s", orderItem.Order_item_id)
+		}
+
+		s.orderItems[orderItem.Order_item_id] = orderItem
+	}
+
+	return nil
+}
+
+func (s *memoryOrderStore) DiscardOrder(ctx context.Context, orderId string) {
+	for id, orderItem := range s.orderItems {
+		if orderItem.Order_id == orderId {
+			delete(s.orderItems, id)
+		}
+	}
+
+	delete(s.orders, orderId)
+}
+
+func (s *memoryOrderStore) itemsOf(orderId string) int {
+	count := 0
+
+	for _, orderItem := range s.orderItems {
+		if orderItem.Order_id == orderId {
+			count++
+		}
+	}
+
+	return count
+}
+
+func TestWritePlacedOrder(t *testing.T) {
+	for _, transactional := range []bool{true, false} {
+		t.Run(fmt.Sprintf("transactional=%t", transactional), func(t *testing.T) {
+			store := newMemoryOrderStore(transactional)
+			order := models.Order{Order_id: "order-1"}
+			orderItems := []interface{}{
+				models.OrderItem{Order_item_id: "item-1", Order_id: "order-1"},
+				models.OrderItem{Order_item_id: "item-2", Order_id: "order-1"},
+			}
+
+			if err := writePlacedOrder(context.Background(), store, order, orderItems); err != nil {
+				t.Fatalf("writePlacedOrder: %v", err)
+			}
+
+			if _, found := store.orders["order-1"]; !found {
+				t.Fatalf("order was not stored")
+			}
+
+			if count := store.itemsOf("order-1"); count != 2 {
+				t.Fatalf("stored %d items, want 2", count)
+			}
+		})
+	}
+}
+
+func TestWritePlacedOrderItemFailureLeavesNoOrder(t *testing.T) {
+	for _, transactional := range []bool{true, false} {
+		t.Run(fmt.Sprintf("transactional=%t", transactional), func(t *testing.T) {
+			store := newMemoryOrderStore(transactional)
+			store.orders["order-0"] = models.Order{Order_id: "order-0"}
+			store.orderItems["taken"] = models.OrderItem{Order_item_id: "taken", Order_id: "order-0"}
+
+			order := models.Order{Order_id: "order-1"}
+			orderItems := []interface{}{
+				models.OrderItem{Order_item_id: "item-1", Order_id: "order-1"},
+				models.OrderItem{Order_item_id: "taken", Order_id: "order-1"},
+			}
+
+			if err := writePlacedOrder(context.Background(), store, order, orderItems); err == nil {
+				t.Fatalf("writePlacedOrder succeeded w/ a duplicate order_item_id")
+			}
+
+			if _, found := store.orders["order-1"]; found {
+				t.Errorf("failed order was left behind")
+			}
+
+			if count := store.itemsOf("order-1"); count != 0 {
+				t.Errorf("%d items of the failed order were left behind", count)
+			}
+
+			if _, found := store.orders["order-0"]; !found || store.itemsOf("order-0") != 1 {
+				t.Errorf("existing order was changed")
+			}
+		})
+	}
+}
@@ -0,0 +1,190 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lackingworth/Go-Restaurant-Management/database"
+	"github.com/lackingworth/Go-Restaurant-Management/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var priceCollection *mongo.Collection = database.OpenCollection(database.Client, "price")
+
+func recordPrice(ctx context.Context, foodId string, price float64, effectiveFrom time.Time, applied bool, createdBy string) (models.Price, error) {
+	var entry models.Price
+
+	entry.ID = primitive.NewObjectID()
+	entry.Price_id = entry.ID.Hex()
+	entry.Food_id = foodId
+	entry.Price = &price
+	entry.Effective_from = effectiveFrom
+	entry.Applied = applied
+	entry.Created_by = createdBy
+	entry.Created_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+
+	_, err := priceCollection.InsertOne(ctx, entry)
+
+	return entry, err
+}
+
+// Returns the price of the food in effect at the given time according to its price history,
+// falling back to the current price for foods created before prices were versioned
+func effectivePrice(ctx context.Context, food models.Food, at time.Time) float64 {
+	var entry models.Price
+
+	opts := options.FindOne().SetSort(bson.D{{Key: "effective_from", Value: -1}, {Key: "created_at", Value: -1}})
+	err := priceCollection.FindOne(ctx, bson.M{"food_id": food.Food_id, "effective_from": bson.M{"$lte": at}}, opts).Decode(&entry)
+
+	if err != nil || entry.Price == nil {
+		return *food.Price
+	}
+
+	return *entry.Price
+}
+
+// Copies scheduled prices that became effective onto their foods
+func ApplyScheduledPrices() {
+	var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "effective_from", Value: 1}})
+	res, err := priceCollection.Find(ctx, bson.M{"applied": false, "effective_from": bson.M{"$lte": time.Now()}}, opts)
+
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	var entries []models.Price
+
+	if err = res.All(ctx, &entries); err != nil {
+		log.Println(err)
+		return
+	}
+
+	for _, entry := range entries {
+		updatedAt, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+
+		_, err := foodCollection.UpdateOne(ctx, bson.M{"food_id": entry.Food_id}, bson.D{{Key: "$set", Value: bson.D{{Key: "price", Value: entry.Price}, {Key: "updated_at", Value: updatedAt}}}})
+
+		if err != nil {
+			log.Println(err)
+			return
+		}
+
+		_, err = priceCollection.UpdateOne(ctx, bson.M{"price_id": entry.Price_id}, bson.D{{Key: "$set", Value: bson.D{{Key: "applied", Value: true}}}})
+
+		if err != nil {
+			log.Println(err)
+			return
+		}
+	}
+}
+
+func GetFoodPrices() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		foodId := c.Param("food_id")
+		defer cancel()
+
+		opts := options.Find().SetSort(bson.D{{Key: "effective_from", Value: -1}})
+		res, err := priceCollection.Find(ctx, bson.M{"food_id": foodId}, opts)
+
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error":"Error occured while listing the price history"})
+			return
+		}
+
+		allPrices := []bson.M{}
+
+		if err = res.All(ctx, &allPrices); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error":"Error occured while listing the price history"})
+			return
+		}
+
+		c.JSON(http.StatusOK, allPrices)
+	}
+}
+
+// Schedules a price change; changes without effective_from (or in the past) apply immediately
+func CreateFoodPrice() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		var price models.Price
+		var food models.Food
+		foodId := c.Param("food_id")
+		defer cancel()
+
+		if err := c.BindJSON(&price); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error":err.Error()})
+			return
+		}
+
+		validationErr := validate.Struct(price)
+
+		if validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error":validationErr.Error()})
+			return
+		}
+
+		err := foodCollection.FindOne(ctx, bson.M{"food_id": foodId}).Decode(&food)
+
+		if err != nil {
+			msg := fmt.Sprintf("Food item was not found")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+			return
+		}
+
+		if price.Effective_from.IsZero() || price.Effective_from.Before(time.Now()) {
+			price.Effective_from, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		}
+
+		entry, err := recordPrice(ctx, foodId, toFixed(*price.Price, 2), price.Effective_from, false, c.GetString("uid"))
+
+		if err != nil {
+			msg := fmt.Sprintf("Price change was not created")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+			return
+		}
+
+		if !entry.Effective_from.After(time.Now()) {
+			ApplyScheduledPrices()
+			entry.Applied = true
+		}
+
+		c.JSON(http.StatusOK, entry)
+	}
+}
+
+// Cancels a scheduled price change that is not in effect yet
+func DeleteFoodPrice() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		foodId := c.Param("food_id")
+		priceId := c.Param("price_id")
+		defer cancel()
+
+		res, err := priceCollection.DeleteOne(ctx, bson.M{"food_id": foodId, "price_id": priceId, "applied": false})
+
+		if err != nil {
+			msg := fmt.Sprintf("Price change was not cancelled")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+			return
+		}
+
+		if res.DeletedCount == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "No scheduled price change was found"})
+			return
+		}
+
+		c.JSON(http.StatusOK, res)
+	}
+}
@@ -0,0 +1,206 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	helper "github.com/lackingworth/Go-Restaurant-Management/helpers"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var PRICE_FACET_BOUNDARIES = bson.A{0, 5, 10, 20, 50}
+
+// Creates the text index food search is backed by (name weighs more than description)
+func EnsureSearchIndexes() error {
+	var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	_, err := foodCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "name", Value: "text"}, {Key: "description", Value: "text"}},
+		Options: options.Index().SetName("food_search").SetWeights(bson.D{{Key: "name", Value: 10}, {Key: "description", Value: 2}}),
+	})
+
+	return err
+}
+
+// Searches foods by text (q) with filters (menu_id, category_id, min_price, max_price,
+// allergen_free, dietary, available_now) and sort options (relevance, price_asc,
+// price_desc, name, newest). Facet counts are computed over all matching foods
+func SearchFoods() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		recordPerPage, err := strconv.Atoi(c.Query("recordPerPage"))
+
+		if err != nil || recordPerPage < 1 {
+			recordPerPage = 10
+		}
+
+		page, err := strconv.Atoi(c.Query("page"))
+
+		if err != nil || page < 1 {
+			page = 1
+		}
+
+		query := strings.TrimSpace(c.Query("q"))
+		filter := bson.D{}
+
+		if query != "" {
+			filter = append(filter, bson.E{Key: "$text", Value: bson.D{{Key: "$search", Value: query}}})
+		}
+
+		if menuId := c.Query("menu_id"); menuId != "" {
+			filter = append(filter, bson.E{Key: "menu_id", Value: menuId})
+		}
+
+		if categoryId := c.Query("category_id"); categoryId != "" {
+			filter = append(filter, bson.E{Key: "category_id", Value: categoryId})
+		}
+
+		priceRange := bson.D{}
+
+		if minPrice, err := strconv.ParseFloat(c.Query("min_price"), 64); err == nil {
+			priceRange = append(priceRange, bson.E{Key: "$gte", Value: minPrice})
+		}
+
+		if maxPrice, err := strconv.ParseFloat(c.Query("max_price"), 64); err == nil {
+			priceRange = append(priceRange, bson.E{Key: "$lte", Value: maxPrice})
+		}
+
+		if len(priceRange) > 0 {
+			filter = append(filter, bson.E{Key: "price", Value: priceRange})
+		}
+
+		if allergenFree := c.Query("allergen_free"); allergenFree != "" {
+			filter = append(filter, bson.E{Key: "contains", Value: bson.D{{Key: "$nin", Value: strings.Split(strings.ToUpper(allergenFree), ",")}}})
+		}
+
+		if dietary := c.Query("dietary"); dietary != "" {
+			filter = append(filter, bson.E{Key: "suitable_for", Value: bson.D{{Key: "$all", Value: strings.Split(strings.ToUpper(dietary), ",")}}})
+		}
+
+		sortStage := bson.D{{Key: "name", Value: 1}}
+
+		switch c.Query("sort") {
+		case "price_asc":
+			sortStage = bson.D{{Key: "price", Value: 1}, {Key: "name", Value: 1}}
+		case "price_desc":
+			sortStage = bson.D{{Key: "price", Value: -1}, {Key: "name", Value: 1}}
+		case "newest":
+			sortStage = bson.D{{Key: "created_at", Value: -1}}
+		case "name":
+		default:
+			if query != "" {
+				sortStage = bson.D{{Key: "score", Value: bson.D{{Key: "$meta", Value: "textScore"}}}, {Key: "name", Value: 1}}
+			}
+		}
+
+		pipeline := mongo.Pipeline{bson.D{{Key: "$match", Value: filter}}}
+
+		// MongoDB Aggregation stages for the availability of the food's menu
+		lookupStage := bson.D{{Key: "$lookup", Value: bson.D{{Key: "from", Value: "menu"}, {Key: "localField", Value: "menu_id"}, {Key: "foreignField", Value: "menu_id"}, {Key: "as", Value: "menu"}} /*end*/}}
+		unwindStage := bson.D{{Key: "$unwind", Value: bson.D{{Key: "path", Value: "$menu"}, {Key: "preserveNullAndEmptyArrays", Value: true}} /*end*/}}
+		pipeline = append(pipeline, lookupStage, unwindStage)
+
+		if c.Query("available_now") == "true" {
+			now := time.Now()
+			availableStage := bson.D{{Key: "$match", Value: bson.D{
+				{Key: "menu", Value: bson.D{{Key: "$exists", Value: true}}},
+				{Key: "$and", Value: bson.A{
+					bson.D{{Key: "$or", Value: bson.A{bson.D{{Key: "menu.start_date", Value: nil}}, bson.D{{Key: "menu.start_date", Value: bson.D{{Key: "$lte", Value: now}}}}}}},
+					bson.D{{Key: "$or", Value: bson.A{bson.D{{Key: "menu.end_date", Value: nil}}, bson.D{{Key: "menu.end_date", Value: bson.D{{Key: "$gte", Value: now}}}}}}},
+				}},
+			} /*end*/}}
+			pipeline = append(pipeline, availableStage)
+		}
+
+		// MongoDB Aggregation facet stage: one page of results plus counts per filter value
+		resultsFacet := bson.A{
+			bson.D{{Key: "$sort", Value: sortStage}},
+			bson.D{{Key: "$skip", Value: (page - 1) * recordPerPage}},
+			bson.D{{Key: "$limit", Value: recordPerPage}},
+			bson.D{{Key: "$project", Value: bson.D{{Key: "_id", Value: 0}, {Key: "menu", Value: 0}, {Key: "recipe", Value: 0}}}},
+		}
+
+		if query != "" {
+			resultsFacet = append(bson.A{bson.D{{Key: "$addFields", Value: bson.D{{Key: "score", Value: bson.D{{Key: "$meta", Value: "textScore"}}}}}}}, resultsFacet...)
+		}
+
+		countBy := func(field string) bson.A {
+			return bson.A{
+				bson.D{{Key: "$group", Value: bson.D{{Key: "_id", Value: "$" + field}, {Key: "count", Value: bson.D{{Key: "$sum", Value: 1}}}}}},
+				bson.D{{Key: "$sort", Value: bson.D{{Key: "count", Value: -1}, {Key: "_id", Value: 1}}}},
+			}
+		}
+
+		countByArray := func(field string) bson.A {
+			return append(bson.A{bson.D{{Key: "$unwind", Value: "$" + field}}}, countBy(field)...)
+		}
+
+		facetStage := bson.D{{Key: "$facet", Value: bson.D{
+			{Key: "food_items", Value: resultsFacet},
+			{Key: "total", Value: bson.A{bson.D{{Key: "$count", Value: "count"}}}},
+			{Key: "menus", Value: countBy("menu_id")},
+			{Key: "categories", Value: countBy("category_id")},
+			{Key: "allergens", Value: countByArray("contains")},
+			{Key: "dietary", Value: countByArray("suitable_for")},
+			{Key: "price_ranges", Value: bson.A{bson.D{{Key: "$bucket", Value: bson.D{{Key: "groupBy", Value: "$price"}, {Key: "boundaries", Value: PRICE_FACET_BOUNDARIES}, {Key: "default", Value: "50+"}, {Key: "output", Value: bson.D{{Key: "count", Value: bson.D{{Key: "$sum", Value: 1}}}}}}}}}},
+		} /*end*/}}
+		pipeline = append(pipeline, facetStage)
+
+		res, err := foodCollection.Aggregate(ctx, pipeline)
+
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error":"Error occured while searching food items"})
+			return
+		}
+
+		var results []bson.M
+
+		if err = res.All(ctx, &results); err != nil || len(results) == 0 {
+			c.JSON(http.StatusInternalServerError, gin.H{"error":"Error occured while searching food items"})
+			return
+		}
+
+		result := results[0]
+		totalCount := int32(0)
+
+		if total, ok := result["total"].(bson.A); ok && len(total) > 0 {
+			if count, ok := total[0].(bson.M)["count"].(int32); ok {
+				totalCount = count
+			}
+		}
+
+		locale := helper.RequestedLocale(c)
+		var served helper.ServedLocales
+
+		if foodItems, ok := result["food_items"].(bson.A); ok {
+			for _, foodItem := range foodItems {
+				if doc, ok := foodItem.(bson.M); ok {
+					helper.LocalizeDocument(doc, locale, &served, "name")
+				}
+			}
+		}
+
+		c.Header("Content-Language", served.String())
+		c.JSON(http.StatusOK, gin.H{
+			"total_count": totalCount,
+			"page": page,
+			"food_items": result["food_items"],
+			"facets": gin.H{
+				"menus": result["menus"],
+				"categories": result["categories"],
+				"allergens": result["allergens"],
+				"dietary": result["dietary"],
+				"price_ranges": result["price_ranges"],
+			},
+		})
+	}
+}
@@ -3,12 +3,12 @@ package controllers
 import (
 	"context"
 	"fmt"
-	"log"
 	"net/http"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/lackingworth/Go-Restaurant-Management/database"
+	helper "github.com/lackingworth/Go-Restaurant-Management/helpers"
 	"github.com/lackingworth/Go-Restaurant-Management/models"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -18,24 +18,20 @@ import (
 
 var tableCollection *mongo.Collection = database.OpenCollection(database.Client, "table")
 
+const TABLE_FREE = "FREE"
+
+var tableListSpec = helper.ListSpec{
+	Filters: map[string]helper.FieldKind{"table_number": helper.INT_FIELD, "number_of_guests": helper.INT_FIELD, "status": helper.STRING_FIELD, "area_id": helper.STRING_FIELD, "section_id": helper.STRING_FIELD},
+	Sorts: []string{"table_number", "number_of_guests", "created_at", "updated_at"},
+	Date_field: "created_at",
+}
+
 func GetTables() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
-
-		res, err := orderCollection.Find(context.TODO(), bson.M{})
 		defer cancel()
 
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error":"Error occured while listing table items"})
-		}
-
-		var allTables []bson.M
-
-		if err = res.All(ctx, &allTables); err != nil {
-			log.Fatal(err)
-		}
-
-		c.JSON(http.StatusOK, allTables)
+		helper.RespondWithList(c, ctx, tableCollection, tableListSpec, bson.D{}, "Error occured while listing table items", nil)
 	}
 }
 
@@ -73,10 +69,28 @@ func CreateTable() gin.HandlerFunc {
 			return
 		}
 
+		if table.Area_id != nil {
+			if err := checkTableArea(ctx, *table.Area_id); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
+
+		if table.Section_id != nil {
+			if err := checkTableSection(ctx, table.Area_id, *table.Section_id); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
+
 		table.Created_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
 		table.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
 		table.ID = primitive.NewObjectID()
 		table.Table_id = table.ID.Hex()
+		status := TABLE_FREE
+		table.Status = &status
+		table.Status_override = nil
+		table.Status_since = &table.Created_at
 
 		res, insertionErr := tableCollection.InsertOne(ctx, table)
 
@@ -112,6 +126,50 @@ func UpdateTable() gin.HandlerFunc {
 			updateObj = append(updateObj, bson.E{Key: "table_number", Value: table.Table_number})
 		}
 
+		if table.Area_id != nil {
+			if err := checkTableArea(ctx, *table.Area_id); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+
+			updateObj = append(updateObj, bson.E{Key: "area_id", Value: table.Area_id})
+		}
+
+		// An empty section_id takes the table out of its section
+		if table.Section_id != nil && *table.Section_id == "" {
+			updateObj = append(updateObj, bson.E{Key: "section_id", Value: nil})
+		} else if table.Section_id != nil {
+			areaId := table.Area_id
+
+			if areaId == nil {
+				var current models.Table
+
+				if tableCollection.FindOne(ctx, bson.M{"table_id": tableId}).Decode(&current) == nil {
+					areaId = current.Area_id
+				}
+			}
+
+			if err := checkTableSection(ctx, areaId, *table.Section_id); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+
+			updateObj = append(updateObj, bson.E{Key: "section_id", Value: table.Section_id})
+		}
+
+		if table.Seats != nil {
+			updateObj = append(updateObj, bson.E{Key: "seats", Value: table.Seats})
+		}
+
+		if table.Layout != nil {
+			if err := validate.Struct(table.Layout); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+
+			updateObj = append(updateObj, bson.E{Key: "layout", Value: table.Layout})
+		}
+
 		table.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
 
 		upsert := true
@@ -133,6 +191,21 @@ func UpdateTable() gin.HandlerFunc {
 			return
 		}
 
+		// Moved to another area w/o a section, so it leaves the section of the old area
+		if table.Area_id != nil && table.Section_id == nil {
+			sectionFilter, err := foreignSectionFilter(ctx, tableId, *table.Area_id)
+
+			if err == nil {
+				_, err = tableCollection.UpdateOne(ctx, sectionFilter, bson.D{{Key: "$set", Value: bson.D{{Key: "section_id", Value: nil}}}})
+			}
+
+			if err != nil {
+				msg := fmt.Sprintf("Section of the table could not be cleared")
+				c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+				return
+			}
+		}
+
 		defer cancel()
 		c.JSON(http.StatusOK, res)
 	}
@@ -0,0 +1,496 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lackingworth/Go-Restaurant-Management/database"
+	helper "github.com/lackingworth/Go-Restaurant-Management/helpers"
+	"github.com/lackingworth/Go-Restaurant-Management/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type TableTransfer struct {
+	Table_id		*string			`json:"table_id" validate:"required"`
+	Reason			*string			`json:"reason"`
+}
+
+type TableMerge struct {
+	Order_id		*string			`json:"order_id" validate:"required"`
+	Reason			*string			`json:"reason"`
+}
+
+type TableSplit struct {
+	Order_item_ids	[]string		`json:"order_item_ids" validate:"required,min=1,dive,required"`
+	Table_id		*string			`json:"table_id"`
+	Reason			*string			`json:"reason"`
+}
+
+var tableMoveCollection *mongo.Collection = database.OpenCollection(database.Client, "tableMove")
+
+var tableMoveListSpec = helper.ListSpec{
+	Filters: map[string]helper.FieldKind{"type": helper.STRING_FIELD, "order_id": helper.STRING_FIELD, "target_order_id": helper.STRING_FIELD, "from_table_id": helper.STRING_FIELD, "to_table_id": helper.STRING_FIELD, "moved_by": helper.STRING_FIELD},
+	Sorts: []string{"-created_at"},
+	Date_field: "created_at",
+}
+
+var errOrderClosed = errors.New("Order is already paid or merged into another order")
+var errNotDineIn = errors.New("Only dine-in orders can move between tables")
+var errSplitItems = errors.New("Order items must all belong to the order")
+var errSplitAll = errors.New("A split must leave at least one item on the order")
+
+// Loads an order that can still be moved: not paid and not merged away
+func openOrder(ctx context.Context, orderId string) (order models.Order, err error) {
+	if err = orderCollection.FindOne(ctx, bson.M{"order_id": orderId}).Decode(&order); err != nil {
+		return
+	}
+
+	if order.Merged_into != nil {
+		return order, errOrderClosed
+	}
+
+	paid, err := invoiceCollection.CountDocuments(ctx, bson.M{"order_id": orderId, "payment_status": "PAID"})
+
+	if err == nil && paid > 0 {
+		err = errOrderClosed
+	}
+
+	return
+}
+
+func recordTableMove(ctx context.Context, move models.TableMove) error {
+	move.ID = primitive.NewObjectID()
+	move.Move_id = move.ID.Hex()
+	move.Created_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+
+	_, err := tableMoveCollection.InsertOne(ctx, move)
+
+	return err
+}
+
+// Refreshes the tables touched by a move; a table the party left is DIRTY until it is cleared,
+// unless another open order is still seated there
+func refreshMovedTables(ctx context.Context, leftTableId *string, tableIds ...*string) {
+	for _, tableId := range tableIds {
+		if tableId == nil {
+			continue
+		}
+
+		if err := RefreshTableStatus(ctx, *tableId); err != nil {
+			log.Println(err)
+		}
+	}
+
+	if leftTableId == nil {
+		return
+	}
+
+	var table models.Table
+
+	err := tableCollection.FindOne(ctx, bson.M{"table_id": leftTableId}).Decode(&table)
+
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	table.Status_override = nil
+	status, _, _, err := deriveTableStatus(ctx, table)
+
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	if status != "FREE" && status != "DIRTY" {
+		if err := RefreshTableStatus(ctx, *leftTableId); err != nil {
+			log.Println(err)
+		}
+
+		return
+	}
+
+	now, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	dirty := "DIRTY"
+	_, err = tableCollection.UpdateOne(ctx, bson.M{"table_id": leftTableId}, bson.D{{Key: "$set", Value: bson.D{{Key: "status", Value: dirty}, {Key: "status_override", Value: dirty}, {Key: "status_since", Value: now}}}})
+
+	if err == nil {
+		err = publishTableBoardEntry(ctx, *leftTableId)
+	}
+
+	if err != nil {
+		log.Println(err)
+	}
+}
+
+// Takeaway and delivery orders have no table; orders w/o a type predate them and are dine-in
+func dineIn(order models.Order) bool {
+	return order.Order_type == "" || order.Order_type == "DINE_IN"
+}
+
+func orderMoveError(c *gin.Context, err error) {
+	if errors.Is(err, errOrderClosed) || errors.Is(err, errNotDineIn) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+
+	msg := fmt.Sprintf("Order was not found")
+	c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+}
+
+// Moves an open order to another table
+func TransferOrder() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		var transfer TableTransfer
+		var table models.Table
+		orderId := c.Param("order_id")
+		defer cancel()
+
+		if err := c.BindJSON(&transfer); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error":err.Error()})
+			return
+		}
+
+		validationErr := validate.Struct(transfer)
+
+		if validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error":validationErr.Error()})
+			return
+		}
+
+		order, err := openOrder(ctx, orderId)
+
+		if err == nil && !dineIn(order) {
+			err = errNotDineIn
+		}
+
+		if err != nil {
+			orderMoveError(c, err)
+			return
+		}
+
+		if err := tableCollection.FindOne(ctx, bson.M{"table_id": transfer.Table_id}).Decode(&table); err != nil {
+			msg := fmt.Sprintf("Table was not found")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+			return
+		}
+
+		if order.Table_id != nil && *order.Table_id == *transfer.Table_id {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Order is already at this table"})
+			return
+		}
+
+		err = database.WithTransaction(ctx, func(sessCtx mongo.SessionContext) error {
+			updatedAt, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+			_, err := orderCollection.UpdateOne(sessCtx, bson.M{"order_id": orderId}, bson.D{{Key: "$set", Value: bson.D{{Key: "table_id", Value: transfer.Table_id}, {Key: "updated_at", Value: updatedAt}}}})
+
+			if err != nil {
+				return err
+			}
+
+			return recordTableMove(sessCtx, models.TableMove{
+				Type: "TRANSFER",
+				Order_id: orderId,
+				From_table_id: order.Table_id,
+				To_table_id: transfer.Table_id,
+				Reason: transfer.Reason,
+				Moved_by: c.GetString("uid"),
+			})
+		})
+
+		if err != nil {
+			msg := fmt.Sprintf("Order transfer failed")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+			return
+		}
+
+		refreshMovedTables(ctx, order.Table_id, transfer.Table_id)
+		c.JSON(http.StatusOK, gin.H{"order_id": orderId, "table_id": transfer.Table_id})
+	}
+}
+
+// Merges another open order (usually of another table) into this one so both are billed together;
+// its items move over and the merged order is closed
+func MergeOrders() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		var merge TableMerge
+		orderId := c.Param("order_id")
+		defer cancel()
+
+		if err := c.BindJSON(&merge); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error":err.Error()})
+			return
+		}
+
+		validationErr := validate.Struct(merge)
+
+		if validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error":validationErr.Error()})
+			return
+		}
+
+		if *merge.Order_id == orderId {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Order cannot be merged into itself"})
+			return
+		}
+
+		target, err := openOrder(ctx, orderId)
+
+		if err != nil {
+			orderMoveError(c, err)
+			return
+		}
+
+		source, err := openOrder(ctx, *merge.Order_id)
+
+		if err == nil && (!dineIn(target) || !dineIn(source)) {
+			err = errNotDineIn
+		}
+
+		if err != nil {
+			orderMoveError(c, err)
+			return
+		}
+
+		var movedIds []string
+
+		err = database.WithTransaction(ctx, func(sessCtx mongo.SessionContext) error {
+			var orderItems []models.OrderItem
+			updatedAt, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+			movedIds = []string{}
+
+			res, err := orderItemCollection.Find(sessCtx, bson.M{"order_id": source.Order_id})
+
+			if err != nil {
+				return err
+			}
+
+			if err = res.All(sessCtx, &orderItems); err != nil {
+				return err
+			}
+
+			for _, orderItem := range orderItems {
+				movedIds = append(movedIds, orderItem.Order_item_id)
+			}
+
+			_, err = orderItemCollection.UpdateMany(sessCtx, bson.M{"order_id": source.Order_id}, bson.D{{Key: "$set", Value: bson.D{{Key: "order_id", Value: target.Order_id}, {Key: "updated_at", Value: updatedAt}}}})
+
+			if err != nil {
+				return err
+			}
+
+			// Item notes follow their items, notes of the merged order move to the target
+			_, err = noteCollection.UpdateMany(sessCtx, bson.M{"entity_type": "ORDER", "entity_id": source.Order_id}, bson.D{{Key: "$set", Value: bson.D{{Key: "entity_id", Value: target.Order_id}, {Key: "updated_at", Value: updatedAt}}}})
+
+			if err != nil {
+				return err
+			}
+
+			// Guests of both parties keep their allergies flagged on the merged order
+			allergyProfile := append([]string{}, target.Allergy_profile...)
+
+			for _, allergen := range source.Allergy_profile {
+				if !contains(allergyProfile, allergen) {
+					allergyProfile = append(allergyProfile, allergen)
+				}
+			}
+
+			_, err = orderCollection.UpdateOne(sessCtx, bson.M{"order_id": target.Order_id}, bson.D{{Key: "$set", Value: bson.D{{Key: "allergy_profile", Value: allergyProfile}, {Key: "updated_at", Value: updatedAt}}}})
+
+			if err != nil {
+				return err
+			}
+
+			_, err = orderCollection.UpdateOne(sessCtx, bson.M{"order_id": source.Order_id}, bson.D{{Key: "$set", Value: bson.D{{Key: "merged_into", Value: target.Order_id}, {Key: "updated_at", Value: updatedAt}}}})
+
+			if err != nil {
+				return err
+			}
+
+			// Pending bills of the merged order are void, the target's bill covers its items now
+			_, err = invoiceCollection.DeleteMany(sessCtx, bson.M{"order_id": source.Order_id, "payment_status": bson.M{"$ne": "PAID"}})
+
+			if err != nil {
+				return err
+			}
+
+			return recordTableMove(sessCtx, models.TableMove{
+				Type: "MERGE",
+				Order_id: source.Order_id,
+				Target_order_id: &target.Order_id,
+				From_table_id: source.Table_id,
+				To_table_id: target.Table_id,
+				Order_item_ids: movedIds,
+				Reason: merge.Reason,
+				Moved_by: c.GetString("uid"),
+			})
+		})
+
+		if err != nil {
+			msg := fmt.Sprintf("Order merge failed")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+			return
+		}
+
+		var leftTableId *string
+
+		if source.Table_id != nil && (target.Table_id == nil || *source.Table_id != *target.Table_id) {
+			leftTableId = source.Table_id
+		}
+
+		refreshMovedTables(ctx, leftTableId, target.Table_id)
+		c.JSON(http.StatusOK, gin.H{"order_id": target.Order_id, "merged_order_id": source.Order_id, "order_item_ids": movedIds})
+	}
+}
+
+// Moves some items of an open order onto a new order, at the same table for separate bills
+// or at another table (table_id) when part of the party moves
+func SplitOrder() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		var split TableSplit
+		orderId := c.Param("order_id")
+		defer cancel()
+
+		if err := c.BindJSON(&split); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error":err.Error()})
+			return
+		}
+
+		validationErr := validate.Struct(split)
+
+		if validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error":validationErr.Error()})
+			return
+		}
+
+		order, err := openOrder(ctx, orderId)
+
+		if err != nil {
+			orderMoveError(c, err)
+			return
+		}
+
+		tableId := order.Table_id
+
+		if split.Table_id != nil && !dineIn(order) {
+			orderMoveError(c, errNotDineIn)
+			return
+		}
+
+		if split.Table_id != nil {
+			count, err := tableCollection.CountDocuments(ctx, bson.M{"table_id": split.Table_id})
+
+			if err != nil || count == 0 {
+				msg := fmt.Sprintf("Table was not found")
+				c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+				return
+			}
+
+			tableId = split.Table_id
+		}
+
+		var newOrder models.Order
+
+		err = database.WithTransaction(ctx, func(sessCtx mongo.SessionContext) error {
+			// Checked w/ the move, so items moved away concurrently cannot be split off
+			count, err := orderItemCollection.CountDocuments(sessCtx, bson.M{"order_id": orderId, "order_item_id": bson.M{"$in": split.Order_item_ids}})
+
+			if err != nil {
+				return err
+			}
+
+			if count != int64(len(split.Order_item_ids)) {
+				return errSplitItems
+			}
+
+			total, err := orderItemCollection.CountDocuments(sessCtx, bson.M{"order_id": orderId})
+
+			if err != nil {
+				return err
+			}
+
+			if total == count {
+				return errSplitAll
+			}
+
+			newOrder = models.Order{
+				Order_Date: order.Order_Date,
+				Order_type: order.Order_type,
+				Table_id: tableId,
+				Customer_name: order.Customer_name,
+				Customer_phone: order.Customer_phone,
+				Delivery_address: order.Delivery_address,
+				Promised_at: order.Promised_at,
+				Server_id: order.Server_id,
+				Allergy_profile: order.Allergy_profile,
+				Allergy_policy: order.Allergy_policy,
+			}
+			newOrder.Created_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+			newOrder.Updated_at = newOrder.Created_at
+			newOrder.ID = primitive.NewObjectID()
+			newOrder.Order_id = newOrder.ID.Hex()
+
+			if _, err := orderCollection.InsertOne(sessCtx, newOrder); err != nil {
+				return err
+			}
+
+			res, err := orderItemCollection.UpdateMany(
+				sessCtx,
+				bson.M{"order_id": orderId, "order_item_id": bson.M{"$in": split.Order_item_ids}},
+				bson.D{{Key: "$set", Value: bson.D{{Key: "order_id", Value: newOrder.Order_id}, {Key: "updated_at", Value: newOrder.Updated_at}}}},
+			)
+
+			if err != nil {
+				return err
+			}
+
+			if res.MatchedCount != count {
+				return errSplitItems
+			}
+
+			return recordTableMove(sessCtx, models.TableMove{
+				Type: "SPLIT",
+				Order_id: orderId,
+				Target_order_id: &newOrder.Order_id,
+				From_table_id: order.Table_id,
+				To_table_id: tableId,
+				Order_item_ids: split.Order_item_ids,
+				Reason: split.Reason,
+				Moved_by: c.GetString("uid"),
+			})
+		})
+
+		if errors.Is(err, errSplitItems) || errors.Is(err, errSplitAll) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err != nil {
+			msg := fmt.Sprintf("Order split failed")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+			return
+		}
+
+		refreshMovedTables(ctx, nil, order.Table_id, tableId)
+		c.JSON(http.StatusOK, gin.H{"order_id": orderId, "new_order_id": newOrder.Order_id, "order_item_ids": split.Order_item_ids})
+	}
+}
+
+func GetTableMoves() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		helper.RespondWithList(c, ctx, tableMoveCollection, tableMoveListSpec, bson.D{}, "Error occured while listing table moves", nil)
+	}
+}
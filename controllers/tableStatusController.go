@@ -0,0 +1,380 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lackingworth/Go-Restaurant-Management/events"
+	"github.com/lackingworth/Go-Restaurant-Management/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const TABLE_BOARD_TOPIC = "tables"
+
+type BoardOrder struct {
+	Order_id			string			`json:"order_id"`
+	Order_date			time.Time		`json:"order_date"`
+	Item_count			int64			`json:"item_count"`
+	Amount				float64			`json:"amount"`
+	Invoice_id			string			`json:"invoice_id,omitempty"`
+	Payment_status		string			`json:"payment_status,omitempty"`
+}
+
+type TableBoardEntry struct {
+	Table_id			string			`json:"table_id"`
+	Table_number		*int			`json:"table_number"`
+	Number_of_guests	*int			`json:"number_of_guests"`
+	Status				string			`json:"status"`
+	Overridden			bool			`json:"overridden"`
+	Status_since		*time.Time		`json:"status_since"`
+	Seated_minutes		*int			`json:"seated_minutes"`
+	Current_order		*BoardOrder		`json:"current_order"`
+}
+
+// Latest order of the table (merged orders left the table) w/ its latest invoice (nil if the order is not billed yet)
+func latestTableOrder(ctx context.Context, tableId string) (*models.Order, *models.Invoice, error) {
+	var order models.Order
+	var invoice models.Invoice
+
+	err := orderCollection.FindOne(ctx, bson.M{"table_id": tableId, "merged_into": nil}, options.FindOne().SetSort(bson.D{{Key: "created_at", Value: -1}})).Decode(&order)
+
+	if err == mongo.ErrNoDocuments {
+		return nil, nil, nil
+	}
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = invoiceCollection.FindOne(ctx, bson.M{"order_id": order.Order_id}, options.FindOne().SetSort(bson.D{{Key: "created_at", Value: -1}})).Decode(&invoice)
+
+	if err == mongo.ErrNoDocuments {
+		return &order, nil, nil
+	}
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &order, &invoice, nil
+}
+
+// Derives the state of the table from its latest order and invoice: a paid table stays
+// DIRTY until it is marked FREE (cleared) again
+func deriveTableStatus(ctx context.Context, table models.Table) (string, *models.Order, *models.Invoice, error) {
+	order, invoice, err := latestTableOrder(ctx, table.Table_id)
+
+	if err != nil || order == nil {
+		return "FREE", nil, nil, err
+	}
+
+	if invoice != nil && invoice.Payment_status != nil && *invoice.Payment_status == "PAID" {
+		if table.Cleared_at != nil && !table.Cleared_at.Before(invoice.Updated_at) {
+			return "FREE", nil, nil, nil
+		}
+
+		return "DIRTY", order, invoice, nil
+	}
+
+	if invoice != nil {
+		return "AWAITING_BILL", order, invoice, nil
+	}
+
+	count, err := orderItemCollection.CountDocuments(ctx, bson.M{"order_id": order.Order_id})
+
+	if err != nil {
+		return "", nil, nil, err
+	}
+
+	if count > 0 {
+		return "ORDERED", order, nil, nil
+	}
+
+	return "SEATED", order, nil, nil
+}
+
+func buildBoardEntry(ctx context.Context, table models.Table) (entry TableBoardEntry, err error) {
+	status, order, invoice, err := deriveTableStatus(ctx, table)
+
+	if err != nil {
+		return
+	}
+
+	entry.Table_id = table.Table_id
+	entry.Table_number = table.Table_number
+	entry.Number_of_guests = table.Number_of_guests
+	entry.Status = status
+	entry.Status_since = table.Status_since
+
+	if table.Status_override != nil {
+		entry.Status = *table.Status_override
+		entry.Overridden = true
+	}
+
+	if order == nil {
+		return
+	}
+
+	entry.Current_order = &BoardOrder{Order_id: order.Order_id, Order_date: order.Order_Date}
+
+	if invoice != nil {
+		entry.Current_order.Invoice_id = invoice.Invoice_id
+		entry.Current_order.Payment_status = *invoice.Payment_status
+	}
+
+	entry.Current_order.Item_count, err = orderItemCollection.CountDocuments(ctx, bson.M{"order_id": order.Order_id})
+
+	if err != nil {
+		return
+	}
+
+	bill, err := orderBill(ctx, *order)
+
+	if err != nil {
+		return
+	}
+
+	entry.Current_order.Amount = bill.Payment_due
+
+	if status != "DIRTY" {
+		minutes := int(time.Since(order.Created_at).Minutes())
+		entry.Seated_minutes = &minutes
+	}
+
+	return
+}
+
+func publishTableBoardEntry(ctx context.Context, tableId string) error {
+	var table models.Table
+
+	if err := tableCollection.FindOne(ctx, bson.M{"table_id": tableId}).Decode(&table); err != nil {
+		return err
+	}
+
+	entry, err := buildBoardEntry(ctx, table)
+
+	if err != nil {
+		return err
+	}
+
+	events.Default.Publish(TABLE_BOARD_TOPIC, "table_status", entry)
+
+	return nil
+}
+
+// Recomputes the status of the table after one of its orders or invoices changed; this
+// drops a manual override, since the floor moved on. Subscribers of the board get the new state
+func RefreshTableStatus(ctx context.Context, tableId string) error {
+	var table models.Table
+
+	if err := tableCollection.FindOne(ctx, bson.M{"table_id": tableId}).Decode(&table); err != nil {
+		return err
+	}
+
+	overridden := table.Status_override != nil
+	shown := table.Status
+
+	if overridden {
+		shown = table.Status_override
+	}
+
+	table.Status_override = nil
+	status, _, _, err := deriveTableStatus(ctx, table)
+
+	if err != nil {
+		return err
+	}
+
+	now, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	updateObj := bson.D{{Key: "status", Value: status}, {Key: "status_override", Value: nil}}
+
+	if table.Status == nil || *table.Status != status || overridden {
+		updateObj = append(updateObj, bson.E{Key: "status_since", Value: now})
+	}
+
+	_, err = tableCollection.UpdateOne(ctx, bson.M{"table_id": tableId}, bson.D{{Key: "$set", Value: updateObj}})
+
+	if err != nil {
+		return err
+	}
+
+	// A table freed by its bill being paid goes to the longest waiting party it fits
+	if status == "FREE" && (shown == nil || *shown != status) {
+		table.Status = &status
+		offerTableToWaitlist(table)
+	}
+
+	return publishTableBoardEntry(ctx, tableId)
+}
+
+// Refreshes the table of the order; failures are only logged since the status is derived again on the next change
+func refreshOrderTable(ctx context.Context, orderId string) {
+	var order models.Order
+
+	if err := orderCollection.FindOne(ctx, bson.M{"order_id": orderId}).Decode(&order); err != nil || order.Table_id == nil {
+		return
+	}
+
+	if err := RefreshTableStatus(ctx, *order.Table_id); err != nil {
+		log.Println(err)
+	}
+}
+
+// Lists all tables w/ their status, current order and how long the party has been seated
+func GetTableBoard() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		res, err := tableCollection.Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "table_number", Value: 1}}))
+
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error":"Error occured while listing the floor board"})
+			return
+		}
+
+		var tables []models.Table
+
+		if err = res.All(ctx, &tables); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error":"Error occured while listing the floor board"})
+			return
+		}
+
+		board := []TableBoardEntry{}
+
+		for _, table := range tables {
+			entry, err := buildBoardEntry(ctx, table)
+
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error":"Error occured while listing the floor board"})
+				return
+			}
+
+			if status := c.Query("status"); status != "" && entry.Status != status {
+				continue
+			}
+
+			board = append(board, entry)
+		}
+
+		c.JSON(http.StatusOK, board)
+	}
+}
+
+// Pushes table_status events (one board entry each) as server-sent events whenever a table changes
+func StreamTableBoard() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		updates, unsubscribe := events.Default.Subscribe(TABLE_BOARD_TOPIC)
+		defer unsubscribe()
+
+		heartbeat := time.NewTicker(30 * time.Second)
+		defer heartbeat.Stop()
+
+		c.Stream(func(w io.Writer) bool {
+			select {
+			case event, ok := <-updates:
+				if !ok {
+					return false
+				}
+
+				c.SSEvent(event.Name, event.Data)
+				return true
+			case <-heartbeat.C:
+				c.SSEvent("ping", time.Now().Unix())
+				return true
+			case <-c.Request.Context().Done():
+				return false
+			}
+		})
+	}
+}
+
+// Sets the status of the table by hand (e.g. FREE once a DIRTY table is cleaned, SEATED for a walk-in);
+// the override holds until the next order or invoice change of the table
+func UpdateTableStatus() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		var table models.Table
+		tableId := c.Param("table_id")
+		defer cancel()
+
+		if err := c.BindJSON(&table); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error":err.Error()})
+			return
+		}
+
+		if table.Status_override == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "status_override is required"})
+			return
+		}
+
+		if validationErr := validate.Var(*table.Status_override, "eq=FREE|eq=SEATED|eq=ORDERED|eq=AWAITING_BILL|eq=DIRTY"); validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+			return
+		}
+
+		now, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		updateObj := bson.D{
+			{Key: "status", Value: table.Status_override},
+			{Key: "status_override", Value: table.Status_override},
+			{Key: "status_since", Value: now},
+			{Key: "updated_at", Value: now},
+		}
+
+		if *table.Status_override == "FREE" {
+			updateObj = append(updateObj, bson.E{Key: "cleared_at", Value: now})
+		}
+
+		res, err := tableCollection.UpdateOne(ctx, bson.M{"table_id": tableId}, bson.D{{Key: "$set", Value: updateObj}})
+
+		if err != nil {
+			msg := fmt.Sprintf("Table status update failed")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+			return
+		}
+
+		if res.MatchedCount == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Table was not found"})
+			return
+		}
+
+		if err := publishTableBoardEntry(ctx, tableId); err != nil {
+			log.Println(err)
+		}
+
+		// A cleared table goes to the longest waiting party it fits
+		if *table.Status_override == "FREE" {
+			var freed models.Table
+
+			if err := tableCollection.FindOne(ctx, bson.M{"table_id": tableId}).Decode(&freed); err == nil {
+				offerTableToWaitlist(freed)
+			}
+		}
+
+		c.JSON(http.StatusOK, res)
+	}
+}
+
+// Drops the manual override so the status is derived from orders and invoices again
+func DeleteTableStatus() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		tableId := c.Param("table_id")
+		defer cancel()
+
+		if err := RefreshTableStatus(ctx, tableId); err != nil {
+			msg := fmt.Sprintf("Table status could not be derived")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"table_id": tableId})
+	}
+}
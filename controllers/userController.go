@@ -5,7 +5,8 @@ import (
 	"fmt"
 	"log"
 	"net/http"
-	"strconv"
+	"os"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -15,48 +16,36 @@ import (
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 	"golang.org/x/crypto/bcrypt"
 )
 
-var userCollection *mongo.Collection = database.OpenCollection(database.Client, "user")
-
-func GetUsers() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
-
-		recordPerPage, err := strconv.Atoi(c.Query("recordPerPage"))
-
-		if err != nil || recordPerPage < 1 {
-			recordPerPage = 10
-		}
+type UserRoleChange struct {
+	Role				*string			`json:"role" validate:"omitempty,eq=STAFF|eq=MANAGER"`
+	Manager_pin			*string			`json:"manager_pin" validate:"omitempty,numeric,min=4,max=8"`
+}
 
-		page, pageErr := strconv.Atoi(c.Query("page"))
+var userCollection *mongo.Collection = database.OpenCollection(database.Client, "user")
 
-		if pageErr != nil || page < 1 {
-			page = 1
-		}
+// Staff signing up w/ one of these (comma separated) emails become managers, everyone else starts as STAFF
+var MANAGER_EMAILS []string = strings.Split(os.Getenv("MANAGER_EMAILS"), ",")
 
-		startIndex := (page - 1) * recordPerPage
-		startIndex, err = strconv.Atoi(c.Query("startIndex"))
+// Credentials never leave the db: password and manager PIN hashes and the user's tokens
+var userProjection = bson.D{{Key: "password", Value: 0}, {Key: "token", Value: 0}, {Key: "refresh_token", Value: 0}, {Key: "manager_pin", Value: 0}, {Key: "pin_failures", Value: 0}, {Key: "pin_locked_until", Value: 0}}
 
-		// MongoDB Aggregation stages for users
-		matchStage := bson.D{{Key: "$match", Value: bson.D{{}} /*end*/}}
-		projectStage := bson.D{{Key: "$project", Value: bson.D{{Key: "_id", Value: 0}, {Key: "total_count", Value: 1}, {Key: "user_items", Value: bson.D{{Key: "$slice", Value: []interface{}{"$data", startIndex, recordPerPage} }} }} /*end*/}}
+var userListSpec = helper.ListSpec{
+	Filters: map[string]helper.FieldKind{"email": helper.STRING_FIELD, "phone": helper.STRING_FIELD, "role": helper.STRING_FIELD},
+	Sorts: []string{"-created_at", "first_name", "last_name", "email", "updated_at"},
+	Date_field: "created_at",
+	Stages: []bson.D{{{Key: "$project", Value: userProjection}}},
+}
 
-		res, err := userCollection.Aggregate(ctx, mongo.Pipeline{matchStage, projectStage})
+func GetUsers() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
 		defer cancel()
 
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occured while listing users"})
-		}
-
-		var allUsers []bson.M
-
-		if err = res.All(ctx, &allUsers); err != nil {
-			log.Fatal(err)
-		}
-
-		c.JSON(http.StatusOK, allUsers[0])
+		helper.RespondWithList(c, ctx, userCollection, userListSpec, bson.D{}, "Error occured while listing users", nil)
 	}
 }
 
@@ -66,11 +55,12 @@ func GetUser() gin.HandlerFunc {
 		var user models.User
 		userId := c.Param("user_id")
 
-		err := userCollection.FindOne(ctx, bson.M{"user_id": userId}).Decode(&user)
+		err := userCollection.FindOne(ctx, bson.M{"user_id": userId}, options.FindOne().SetProjection(userProjection)).Decode(&user)
 		defer cancel()
 
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occured while finding user"})	
+			return
 		}
 
 		c.JSON(http.StatusOK, user)
@@ -107,6 +97,16 @@ func SignUp() gin.HandlerFunc {
 		password := HashPassword(*user.Password)
 		user.Password = &password
 
+		// Roles and manager PINs are only handed out by managers
+		role := "STAFF"
+
+		if contains(MANAGER_EMAILS, *user.Email) {
+			role = "MANAGER"
+		}
+
+		user.Role = &role
+		user.Manager_pin = nil
+
 		count, err = userCollection.CountDocuments(ctx, bson.M{"phone": user.Phone})
 		defer cancel()
 
@@ -200,4 +200,64 @@ func VerifyPassword(userPassword string, providedPassword string) (bool, string)
 	}
 
 	return check, msg
+}
+
+// Users w/o a role are staff signed up before roles existed
+func isManager(user models.User) bool {
+	return user.Role != nil && *user.Role == "MANAGER"
+}
+
+// Sets the role of the user (STAFF / MANAGER) and the PIN managers approve voids and comps w/; managers only
+func UpdateUserRole() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		var change UserRoleChange
+		var manager models.User
+		var updateObj primitive.D
+		userId := c.Param("user_id")
+		defer cancel()
+
+		if err := userCollection.FindOne(ctx, bson.M{"user_id": c.GetString("uid")}).Decode(&manager); err != nil || !isManager(manager) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Only managers can change roles"})
+			return
+		}
+
+		if err := c.BindJSON(&change); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if validationErr := validate.Struct(change); validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "role must be STAFF or MANAGER and manager_pin 4 to 8 digits"})
+			return
+		}
+
+		if change.Role != nil {
+			updateObj = append(updateObj, bson.E{Key: "role", Value: change.Role})
+		}
+
+		// A new PIN also lifts a lockout of the old one
+		if change.Manager_pin != nil {
+			pin := HashPassword(*change.Manager_pin)
+			updateObj = append(updateObj, bson.E{Key: "manager_pin", Value: pin}, bson.E{Key: "pin_failures", Value: 0}, bson.E{Key: "pin_locked_until", Value: nil})
+		}
+
+		updatedAt, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		updateObj = append(updateObj, bson.E{Key: "updated_at", Value: updatedAt})
+
+		res, err := userCollection.UpdateOne(ctx, bson.M{"user_id": userId}, bson.D{{Key: "$set", Value: updateObj}})
+
+		if err != nil {
+			msg := fmt.Sprintf("User update failed")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+			return
+		}
+
+		if res.MatchedCount == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User was not found"})
+			return
+		}
+
+		c.JSON(http.StatusOK, res)
+	}
 }
\ No newline at end of file
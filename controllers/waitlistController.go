@@ -0,0 +1,574 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lackingworth/Go-Restaurant-Management/database"
+	"github.com/lackingworth/Go-Restaurant-Management/events"
+	helper "github.com/lackingworth/Go-Restaurant-Management/helpers"
+	"github.com/lackingworth/Go-Restaurant-Management/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const WAITLIST_TOPIC = "waitlist"
+
+// Used when there is no history for a table size yet
+const DEFAULT_TURN_MINUTES = 60
+
+// Time it takes to clear a DIRTY table
+const CLEARING_MINUTES = 5
+
+// Turn times are averaged over this many days of paid orders
+const TURN_HISTORY_DAYS = 30
+
+// Optional endpoint the "table ready" notifications are posted to (e.g. an SMS gateway)
+var WAITLIST_WEBHOOK_URL string = os.Getenv("WAITLIST_WEBHOOK_URL")
+
+type WaitEstimate struct {
+	Party_size			int			`json:"party_size"`
+	Parties_ahead		int			`json:"parties_ahead"`
+	Wait_minutes		*int		`json:"wait_minutes"`
+	Turn_minutes		int			`json:"turn_minutes"`
+}
+
+type WaitlistSeating struct {
+	Table_id			*string		`json:"table_id" validate:"required"`
+	Force				bool		`json:"force"`
+}
+
+var waitlistCollection *mongo.Collection = database.OpenCollection(database.Client, "waitlist")
+
+var waitlistListSpec = helper.ListSpec{
+	Filters: map[string]helper.FieldKind{"status": helper.STRING_FIELD, "party_size": helper.INT_FIELD, "phone": helper.STRING_FIELD},
+	Sorts: []string{"created_at", "party_size", "updated_at"},
+	Date_field: "created_at",
+}
+
+var ACTIVE_WAITLIST_STATUSES = []string{"WAITING", "NOTIFIED"}
+
+// Seats of the table, falling back to the number of guests for tables w/o a layout
+func tableCapacity(table models.Table) int {
+	if table.Seats != nil {
+		return *table.Seats
+	}
+
+	if table.Number_of_guests != nil {
+		return *table.Number_of_guests
+	}
+
+	return 0
+}
+
+// Average minutes from opening an order to paying it, per table capacity
+func turnTimes(ctx context.Context) (map[int]int, error) {
+	since := time.Now().AddDate(0, 0, -TURN_HISTORY_DAYS)
+
+	// MongoDB Aggregation stages for the duration of paid orders and the size of their tables
+	matchStage := bson.D{{Key: "$match", Value: bson.D{{Key: "payment_status", Value: "PAID"}, {Key: "updated_at", Value: bson.D{{Key: "$gte", Value: since}}}} /*end*/}}
+	lookupOrderStage := bson.D{{Key: "$lookup", Value: bson.D{{Key: "from", Value: "order"}, {Key: "localField", Value: "order_id"}, {Key: "foreignField", Value: "order_id"}, {Key: "as", Value: "order"}} /*end*/}}
+	unwindOrderStage := bson.D{{Key: "$unwind", Value: "$order"}}
+	lookupTableStage := bson.D{{Key: "$lookup", Value: bson.D{{Key: "from", Value: "table"}, {Key: "localField", Value: "order.table_id"}, {Key: "foreignField", Value: "table_id"}, {Key: "as", Value: "table"}} /*end*/}}
+	unwindTableStage := bson.D{{Key: "$unwind", Value: "$table"}}
+	groupStage := bson.D{{Key: "$group", Value: bson.D{
+		{Key: "_id", Value: bson.D{{Key: "$ifNull", Value: bson.A{"$table.seats", "$table.number_of_guests"}}}},
+		{Key: "minutes", Value: bson.D{{Key: "$avg", Value: bson.D{{Key: "$divide", Value: bson.A{bson.D{{Key: "$subtract", Value: bson.A{"$updated_at", "$order.created_at"}}}, 60000}}}}}},
+	} /*end*/}}
+
+	res, err := invoiceCollection.Aggregate(ctx, mongo.Pipeline{matchStage, lookupOrderStage, unwindOrderStage, lookupTableStage, unwindTableStage, groupStage})
+
+	if err != nil {
+		return nil, err
+	}
+
+	var groups []struct {
+		Capacity	int			`bson:"_id"`
+		Minutes		float64		`bson:"minutes"`
+	}
+
+	if err = res.All(ctx, &groups); err != nil {
+		return nil, err
+	}
+
+	turns := map[int]int{}
+
+	for _, group := range groups {
+		if group.Minutes > 0 {
+			turns[group.Capacity] = round(group.Minutes)
+		}
+	}
+
+	return turns, nil
+}
+
+func turnMinutes(turns map[int]int, capacity int) int {
+	if minutes, found := turns[capacity]; found {
+		return minutes
+	}
+
+	return DEFAULT_TURN_MINUTES
+}
+
+// Estimates the wait of a party: every table large enough frees up once its party's usual turn
+// time has passed (or right away when free), and the parties ahead that fit take the earliest ones
+func estimateWait(ctx context.Context, partySize int, createdBefore *time.Time) (estimate WaitEstimate, err error) {
+	estimate.Party_size = partySize
+	turns, err := turnTimes(ctx)
+
+	if err != nil {
+		return
+	}
+
+	res, err := tableCollection.Find(ctx, bson.M{})
+
+	if err != nil {
+		return
+	}
+
+	var tables []models.Table
+
+	if err = res.All(ctx, &tables); err != nil {
+		return
+	}
+
+	var available []int
+	var turnTotal int
+
+	for _, table := range tables {
+		capacity := tableCapacity(table)
+
+		if capacity < partySize {
+			continue
+		}
+
+		entry, buildErr := buildBoardEntry(ctx, table)
+
+		if buildErr != nil {
+			return estimate, buildErr
+		}
+
+		turn := turnMinutes(turns, capacity)
+		turnTotal += turn
+
+		switch entry.Status {
+		case "FREE":
+			available = append(available, 0)
+		case "DIRTY":
+			available = append(available, CLEARING_MINUTES)
+		default:
+			seated := 0
+
+			if entry.Seated_minutes != nil {
+				seated = *entry.Seated_minutes
+			}
+
+			available = append(available, max(turn-seated, CLEARING_MINUTES))
+		}
+	}
+
+	// No table is large enough for the party
+	if len(available) == 0 {
+		return
+	}
+
+	estimate.Turn_minutes = turnTotal / len(available)
+
+	filter := bson.M{"status": bson.M{"$in": ACTIVE_WAITLIST_STATUSES}, "party_size": bson.M{"$lte": partySize}}
+
+	if createdBefore != nil {
+		filter["created_at"] = bson.M{"$lt": createdBefore}
+	}
+
+	// Smaller parties ahead may take these tables as well, larger ones cannot
+	ahead, err := waitlistCollection.CountDocuments(ctx, filter)
+
+	if err != nil {
+		return
+	}
+
+	estimate.Parties_ahead = int(ahead)
+
+	for i := 0; i < estimate.Parties_ahead; i++ {
+		sort.Ints(available)
+		available[0] += estimate.Turn_minutes
+	}
+
+	sort.Ints(available)
+	estimate.Wait_minutes = &available[0]
+
+	return
+}
+
+// Tells the party their table is ready: live waitlist screens get a table_ready event and
+// the webhook (if configured) receives it too
+func notifyParty(ctx context.Context, entry models.WaitlistEntry, table *models.Table) error {
+	notifiedAt, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	updateObj := bson.D{{Key: "status", Value: "NOTIFIED"}, {Key: "notified_at", Value: notifiedAt}, {Key: "updated_at", Value: notifiedAt}}
+
+	if table != nil {
+		updateObj = append(updateObj, bson.E{Key: "table_id", Value: table.Table_id})
+	}
+
+	_, err := waitlistCollection.UpdateOne(ctx, bson.M{"waitlist_id": entry.Waitlist_id}, bson.D{{Key: "$set", Value: updateObj}})
+
+	if err != nil {
+		return err
+	}
+
+	entry.Status = "NOTIFIED"
+	entry.Notified_at = &notifiedAt
+	payload := gin.H{"entry": entry}
+
+	if table != nil {
+		entry.Table_id = &table.Table_id
+		payload = gin.H{"entry": entry, "table_id": table.Table_id, "table_number": table.Table_number}
+	}
+
+	events.Default.Publish(WAITLIST_TOPIC, "table_ready", payload)
+
+	if WAITLIST_WEBHOOK_URL != "" {
+		return events.PostWebhook(WAITLIST_WEBHOOK_URL, events.Event{Topic: WAITLIST_TOPIC, Name: "table_ready", Data: payload})
+	}
+
+	return nil
+}
+
+// Offers a table that just became free to the longest waiting party it fits; runs in the background
+// so the table update that freed it does not wait for the webhook
+func offerTableToWaitlist(table models.Table) {
+	go func() {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		var entry models.WaitlistEntry
+		defer cancel()
+
+		filter := bson.M{"status": "WAITING", "party_size": bson.M{"$lte": tableCapacity(table)}}
+		err := waitlistCollection.FindOne(ctx, filter, options.FindOne().SetSort(bson.D{{Key: "created_at", Value: 1}})).Decode(&entry)
+
+		if err != nil {
+			return
+		}
+
+		if err := notifyParty(ctx, entry, &table); err != nil {
+			log.Println(err)
+		}
+	}()
+}
+
+func GetWaitlist() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		match := bson.D{}
+
+		if c.Query("status") == "" {
+			match = append(match, bson.E{Key: "status", Value: bson.D{{Key: "$in", Value: ACTIVE_WAITLIST_STATUSES}}})
+		}
+
+		helper.RespondWithList(c, ctx, waitlistCollection, waitlistListSpec, match, "Error occured while listing the waitlist", nil)
+	}
+}
+
+// Returns the entry w/ its current wait estimate
+func GetWaitlistEntry() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		var entry models.WaitlistEntry
+		waitlistId := c.Param("waitlist_id")
+		defer cancel()
+
+		err := waitlistCollection.FindOne(ctx, bson.M{"waitlist_id": waitlistId}).Decode(&entry)
+
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error":"Error occured while fetching the waitlist entry"})
+			return
+		}
+
+		estimate, err := estimateWait(ctx, *entry.Party_size, &entry.Created_at)
+
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error":"Error occured while estimating the wait"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"entry": entry, "estimate": estimate})
+	}
+}
+
+// Quotes the wait for a party of ?party_size= before it joins the waitlist
+func GetWaitEstimate() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		partySize, err := strconv.Atoi(c.Query("party_size"))
+
+		if err != nil || partySize < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "party_size must be a positive number"})
+			return
+		}
+
+		estimate, err := estimateWait(ctx, partySize, nil)
+
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error":"Error occured while estimating the wait"})
+			return
+		}
+
+		c.JSON(http.StatusOK, estimate)
+	}
+}
+
+func CreateWaitlistEntry() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		var entry models.WaitlistEntry
+		defer cancel()
+
+		if err := c.BindJSON(&entry); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error":err.Error()})
+			return
+		}
+
+		entry.Status = "WAITING"
+		validationErr := validate.Struct(entry)
+
+		if validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error":validationErr.Error()})
+			return
+		}
+
+		estimate, err := estimateWait(ctx, *entry.Party_size, nil)
+
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error":"Error occured while estimating the wait"})
+			return
+		}
+
+		if estimate.Wait_minutes == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "No table is large enough for this party"})
+			return
+		}
+
+		entry.Quoted_wait = *estimate.Wait_minutes
+		entry.Table_id = nil
+		entry.Order_id = nil
+		entry.Created_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		entry.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		entry.ID = primitive.NewObjectID()
+		entry.Waitlist_id = entry.ID.Hex()
+
+		_, insertErr := waitlistCollection.InsertOne(ctx, entry)
+
+		if insertErr != nil {
+			msg := fmt.Sprintf("Waitlist entry was not created")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+			return
+		}
+
+		events.Default.Publish(WAITLIST_TOPIC, "party_added", entry)
+		c.JSON(http.StatusOK, gin.H{"entry": entry, "estimate": estimate})
+	}
+}
+
+// Updates party details or takes the party off the list (status CANCELLED / NO_SHOW)
+func UpdateWaitlistEntry() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		var entry models.WaitlistEntry
+		var updateObj primitive.D
+		waitlistId := c.Param("waitlist_id")
+		defer cancel()
+
+		if err := c.BindJSON(&entry); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error":err.Error()})
+			return
+		}
+
+		if entry.Name != nil {
+			updateObj = append(updateObj, bson.E{Key: "name", Value: entry.Name})
+		}
+
+		if entry.Party_size != nil {
+			if *entry.Party_size < 1 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "party_size must be a positive number"})
+				return
+			}
+
+			updateObj = append(updateObj, bson.E{Key: "party_size", Value: entry.Party_size})
+		}
+
+		if entry.Phone != nil {
+			updateObj = append(updateObj, bson.E{Key: "phone", Value: entry.Phone})
+		}
+
+		if entry.Email != nil {
+			updateObj = append(updateObj, bson.E{Key: "email", Value: entry.Email})
+		}
+
+		if entry.Notes != nil {
+			updateObj = append(updateObj, bson.E{Key: "notes", Value: entry.Notes})
+		}
+
+		if entry.Status != "" {
+			if err := validate.Var(entry.Status, "eq=WAITING|eq=CANCELLED|eq=NO_SHOW"); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "status can only be set to WAITING, CANCELLED or NO_SHOW"})
+				return
+			}
+
+			updateObj = append(updateObj, bson.E{Key: "status", Value: entry.Status})
+		}
+
+		entry.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		updateObj = append(updateObj, bson.E{Key: "updated_at", Value: entry.Updated_at})
+
+		res, err := waitlistCollection.UpdateOne(ctx, bson.M{"waitlist_id": waitlistId}, bson.D{{Key: "$set", Value: updateObj}})
+
+		if err != nil {
+			msg := fmt.Sprintf("Waitlist entry update failed")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+			return
+		}
+
+		events.Default.Publish(WAITLIST_TOPIC, "party_updated", gin.H{"waitlist_id": waitlistId})
+		c.JSON(http.StatusOK, res)
+	}
+}
+
+// Sends the "table ready" notification to the party by hand, optionally for a given ?table_id=
+func NotifyWaitlistEntry() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		var entry models.WaitlistEntry
+		var table *models.Table
+		waitlistId := c.Param("waitlist_id")
+		defer cancel()
+
+		err := waitlistCollection.FindOne(ctx, bson.M{"waitlist_id": waitlistId, "status": bson.M{"$in": ACTIVE_WAITLIST_STATUSES}}).Decode(&entry)
+
+		if err != nil {
+			msg := fmt.Sprintf("Waiting party was not found")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+			return
+		}
+
+		if tableId := c.Query("table_id"); tableId != "" {
+			table = &models.Table{}
+
+			if err := tableCollection.FindOne(ctx, bson.M{"table_id": tableId}).Decode(table); err != nil {
+				msg := fmt.Sprintf("Table was not found")
+				c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+				return
+			}
+		}
+
+		if err := notifyParty(ctx, entry, table); err != nil {
+			msg := fmt.Sprintf("Party was not notified: %s", err.Error())
+			c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"waitlist_id": waitlistId, "status": "NOTIFIED"})
+	}
+}
+
+// Seats the party at a free table and opens its order
+func SeatWaitlistEntry() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		var seating WaitlistSeating
+		var entry models.WaitlistEntry
+		var table models.Table
+		waitlistId := c.Param("waitlist_id")
+		defer cancel()
+
+		if err := c.BindJSON(&seating); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error":err.Error()})
+			return
+		}
+
+		validationErr := validate.Struct(seating)
+
+		if validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error":validationErr.Error()})
+			return
+		}
+
+		err := waitlistCollection.FindOne(ctx, bson.M{"waitlist_id": waitlistId, "status": bson.M{"$in": ACTIVE_WAITLIST_STATUSES}}).Decode(&entry)
+
+		if err != nil {
+			msg := fmt.Sprintf("Waiting party was not found")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+			return
+		}
+
+		if err := tableCollection.FindOne(ctx, bson.M{"table_id": seating.Table_id}).Decode(&table); err != nil {
+			msg := fmt.Sprintf("Table was not found")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+			return
+		}
+
+		board, err := buildBoardEntry(ctx, table)
+
+		if err != nil {
+			msg := fmt.Sprintf("Table status could not be derived")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+			return
+		}
+
+		// force seats the party anyway, e.g. at a table pushed together w/ another one
+		if !seating.Force && board.Status != "FREE" {
+			c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("Table is %s", board.Status)})
+			return
+		}
+
+		if !seating.Force && tableCapacity(table) < *entry.Party_size {
+			c.JSON(http.StatusConflict, gin.H{"error": "Table is too small for this party"})
+			return
+		}
+
+		now, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		order := models.Order{Order_Date: now, Order_type: "DINE_IN", Table_id: &table.Table_id, Server_id: sectionServer(ctx, table, now)}
+		order.Created_at = now
+		order.Updated_at = now
+		order.ID = primitive.NewObjectID()
+		order.Order_id = order.ID.Hex()
+
+		err = database.WithTransaction(ctx, func(sessCtx mongo.SessionContext) error {
+			if _, err := orderCollection.InsertOne(sessCtx, order); err != nil {
+				return err
+			}
+
+			_, err := waitlistCollection.UpdateOne(
+				sessCtx,
+				bson.M{"waitlist_id": waitlistId},
+				bson.D{{Key: "$set", Value: bson.D{{Key: "status", Value: "SEATED"}, {Key: "table_id", Value: table.Table_id}, {Key: "order_id", Value: order.Order_id}, {Key: "seated_at", Value: now}, {Key: "updated_at", Value: now}}}},
+			)
+
+			return err
+		})
+
+		if err != nil {
+			msg := fmt.Sprintf("Party was not seated")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+			return
+		}
+
+		if err := RefreshTableStatus(ctx, table.Table_id); err != nil {
+			log.Println(err)
+		}
+
+		events.Default.Publish(WAITLIST_TOPIC, "party_seated", gin.H{"waitlist_id": waitlistId, "table_id": table.Table_id, "order_id": order.Order_id})
+		c.JSON(http.StatusOK, gin.H{"waitlist_id": waitlistId, "table_id": table.Table_id, "order_id": order.Order_id})
+	}
+}
@@ -0,0 +1,331 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lackingworth/Go-Restaurant-Management/database"
+	helper "github.com/lackingworth/Go-Restaurant-Management/helpers"
+	"github.com/lackingworth/Go-Restaurant-Management/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type WasteDayReport struct {
+	Date				string			`json:"date"`
+	Waste_cost			float64			`json:"waste_cost"`
+	Sales				float64			`json:"sales"`
+}
+
+type WasteItemReport struct {
+	Item_id				string			`json:"item_id"`
+	Item_name			string			`json:"item_name"`
+	Quantity			float64			`json:"quantity"`
+	Waste_cost			float64			`json:"waste_cost"`
+}
+
+type WasteReport struct {
+	Start_date			string				`json:"start_date"`
+	End_date			string				`json:"end_date"`
+	Total_waste_cost	float64				`json:"total_waste_cost"`
+	Total_sales			float64				`json:"total_sales"`
+	Per_day				[]WasteDayReport	`json:"per_day"`
+	Per_item			[]WasteItemReport	`json:"per_item"`
+}
+
+var wasteCollection *mongo.Collection = database.OpenCollection(database.Client, "waste")
+
+// Parses the start_date / end_date query params (YYYY-MM-DD); defaults to the last 30 days.
+// The returned end is exclusive so the whole end day is included
+func reportRange(c *gin.Context) (start time.Time, end time.Time, err error) {
+	end = time.Now().UTC().Truncate(24 * time.Hour).AddDate(0, 0, 1)
+	start = end.AddDate(0, 0, -30)
+
+	if s := c.Query("start_date"); s != "" {
+		if start, err = time.Parse("2006-01-02", s); err != nil {
+			return
+		}
+	}
+
+	if e := c.Query("end_date"); e != "" {
+		if end, err = time.Parse("2006-01-02", e); err != nil {
+			return
+		}
+
+		end = end.AddDate(0, 0, 1)
+	}
+
+	if !end.After(start) {
+		err = fmt.Errorf("end_date must not be before start_date")
+	}
+
+	return
+}
+
+// Sums the unit price of the billed (not voided or comped) items of paid invoices, grouped by invoice day
+func salesPerDay(ctx context.Context, start time.Time, end time.Time) (map[string]float64, error) {
+	matchStage := bson.D{{Key: "$match", Value: bson.D{{Key: "payment_status", Value: "PAID"}, {Key: "created_at", Value: bson.D{{Key: "$gte", Value: start}, {Key: "$lt", Value: end}}}} /*end*/}}
+	lookupStage := bson.D{{Key: "$lookup", Value: bson.D{{Key: "from", Value: "orderItem"}, {Key: "localField", Value: "order_id"}, {Key: "foreignField", Value: "order_id"}, {Key: "as", Value: "order_items"}} /*end*/}}
+	unwindStage := bson.D{{Key: "$unwind", Value: bson.D{{Key: "path", Value: "$order_items"}} /*end*/}}
+	billedStage := bson.D{{Key: "$match", Value: bson.D{{Key: "order_items.adjustment", Value: nil}} /*end*/}}
+	groupStage := bson.D{{Key: "$group", Value: bson.D{{Key: "_id", Value: bson.D{{Key: "$dateToString", Value: bson.D{{Key: "format", Value: "%Y-%m-%d"}, {Key: "date", Value: "$created_at"}}}}}, {Key: "sales", Value: bson.D{{Key: "$sum", Value: "$order_items.unit_price"}}}} /*end*/}}
+
+	res, err := invoiceCollection.Aggregate(ctx, mongo.Pipeline{matchStage, lookupStage, unwindStage, billedStage, groupStage})
+
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []struct {
+		Date	string		`bson:"_id"`
+		Sales	float64		`bson:"sales"`
+	}
+
+	if err = res.All(ctx, &rows); err != nil {
+		return nil, err
+	}
+
+	sales := map[string]float64{}
+
+	for _, row := range rows {
+		sales[row.Date] = row.Sales
+	}
+
+	return sales, nil
+}
+
+var wasteListSpec = helper.ListSpec{
+	Filters: map[string]helper.FieldKind{"ingredient_id": helper.STRING_FIELD, "food_id": helper.STRING_FIELD, "reason": helper.STRING_FIELD, "operator_id": helper.STRING_FIELD},
+	Sorts: []string{"-wasted_at", "cost", "quantity", "created_at"},
+	Date_field: "wasted_at",
+}
+
+func GetWastes() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		helper.RespondWithList(c, ctx, wasteCollection, wasteListSpec, bson.D{}, "Error occured while listing waste entries", nil)
+	}
+}
+
+func GetWaste() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		var waste models.Waste
+		wasteId := c.Param("waste_id")
+		defer cancel()
+
+		err := wasteCollection.FindOne(ctx, bson.M{"waste_id": wasteId}).Decode(&waste)
+
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error":"Error occured while fetching the waste entry"})
+			return
+		}
+
+		c.JSON(http.StatusOK, waste)
+	}
+}
+
+// Logs discarded ingredients or prepared foods. Stock is deducted from the inventory:
+// directly for ingredients, through the recipe for foods. The cost is computed from
+// ingredient unit costs unless provided (foods without a recipe fall back to their price)
+func CreateWaste() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		var waste models.Waste
+		defer cancel()
+
+		if err := c.BindJSON(&waste); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error":err.Error()})
+			return
+		}
+
+		validationErr := validate.Struct(waste)
+
+		if validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error":validationErr.Error()})
+			return
+		}
+
+		deductions := map[string]float64{}
+		cost := 0.0
+
+		if waste.Ingredient_id != nil {
+			var ingredient models.Ingredient
+
+			err := ingredientCollection.FindOne(ctx, bson.M{"ingredient_id": waste.Ingredient_id}).Decode(&ingredient)
+
+			if err != nil {
+				msg := fmt.Sprintf("Ingredient was not found")
+				c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+				return
+			}
+
+			waste.Item_name = *ingredient.Name
+			deductions[ingredient.Ingredient_id] = *waste.Quantity
+			cost = *waste.Quantity * *ingredient.Unit_cost
+		} else {
+			var food models.Food
+
+			err := foodCollection.FindOne(ctx, bson.M{"food_id": waste.Food_id}).Decode(&food)
+
+			if err != nil {
+				msg := fmt.Sprintf("Food item was not found")
+				c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+				return
+			}
+
+			waste.Item_name = *food.Name
+
+			if len(food.Recipe) == 0 {
+				cost = *waste.Quantity * *food.Price
+			}
+
+			for _, item := range food.Recipe {
+				var ingredient models.Ingredient
+
+				err := ingredientCollection.FindOne(ctx, bson.M{"ingredient_id": item.Ingredient_id}).Decode(&ingredient)
+
+				if err != nil {
+					msg := fmt.Sprintf("Recipe ingredient %s was not found", item.Ingredient_id)
+					c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+					return
+				}
+
+				deductions[item.Ingredient_id] += item.Quantity * *waste.Quantity
+				cost += item.Quantity * *waste.Quantity * *ingredient.Unit_cost
+			}
+		}
+
+		if waste.Cost == nil {
+			cost = toFixed(cost, 2)
+			waste.Cost = &cost
+		}
+
+		if waste.Wasted_at.IsZero() {
+			waste.Wasted_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		}
+
+		waste.Operator_id = c.GetString("uid")
+		waste.Created_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		waste.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		waste.ID = primitive.NewObjectID()
+		waste.Waste_id = waste.ID.Hex()
+
+		res, insertErr := wasteCollection.InsertOne(ctx, waste)
+
+		if insertErr != nil {
+			msg := fmt.Sprintf("Waste entry was not created")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+			return
+		}
+
+		for ingredientId, amount := range deductions {
+			if err := deductStock(ctx, ingredientId, amount); err != nil {
+				msg := fmt.Sprintf("Waste entry was created but stock of ingredient %s was not deducted", ingredientId)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+				return
+			}
+		}
+
+		c.JSON(http.StatusOK, res)
+	}
+}
+
+// Reports waste cost per day (next to the sales of paid invoices) and per wasted item
+func GetWasteReport() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		start, end, err := reportRange(c)
+
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		res, err := wasteCollection.Find(ctx, bson.M{"wasted_at": bson.M{"$gte": start, "$lt": end}})
+
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error":"Error occured while listing waste entries"})
+			return
+		}
+
+		var wastes []models.Waste
+
+		if err = res.All(ctx, &wastes); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error":"Error occured while listing waste entries"})
+			return
+		}
+
+		sales, err := salesPerDay(ctx, start, end)
+
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error":"Error occured while summing up sales"})
+			return
+		}
+
+		report := WasteReport{
+			Start_date: start.Format("2006-01-02"),
+			End_date: end.AddDate(0, 0, -1).Format("2006-01-02"),
+		}
+
+		days := map[string]*WasteDayReport{}
+		items := map[string]*WasteItemReport{}
+
+		for day := start; day.Before(end); day = day.AddDate(0, 0, 1) {
+			date := day.Format("2006-01-02")
+			days[date] = &WasteDayReport{Date: date, Sales: toFixed(sales[date], 2)}
+			report.Total_sales += sales[date]
+		}
+
+		for _, waste := range wastes {
+			date := waste.Wasted_at.UTC().Format("2006-01-02")
+			itemId := ""
+
+			if waste.Ingredient_id != nil {
+				itemId = *waste.Ingredient_id
+			} else if waste.Food_id != nil {
+				itemId = *waste.Food_id
+			}
+
+			if days[date] == nil {
+				days[date] = &WasteDayReport{Date: date}
+			}
+
+			if items[itemId] == nil {
+				items[itemId] = &WasteItemReport{Item_id: itemId, Item_name: waste.Item_name}
+			}
+
+			days[date].Waste_cost += *waste.Cost
+			items[itemId].Waste_cost += *waste.Cost
+			items[itemId].Quantity += *waste.Quantity
+			report.Total_waste_cost += *waste.Cost
+		}
+
+		for _, day := range days {
+			day.Waste_cost = toFixed(day.Waste_cost, 2)
+			report.Per_day = append(report.Per_day, *day)
+		}
+
+		for _, item := range items {
+			item.Waste_cost = toFixed(item.Waste_cost, 2)
+			report.Per_item = append(report.Per_item, *item)
+		}
+
+		sort.Slice(report.Per_day, func(i, j int) bool { return report.Per_day[i].Date < report.Per_day[j].Date })
+		sort.Slice(report.Per_item, func(i, j int) bool { return report.Per_item[i].Waste_cost > report.Per_item[j].Waste_cost })
+
+		report.Total_waste_cost = toFixed(report.Total_waste_cost, 2)
+		report.Total_sales = toFixed(report.Total_sales, 2)
+
+		c.JSON(http.StatusOK, report)
+	}
+}
@@ -0,0 +1,45 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var transactionFallback sync.Once
+
+// Runs fn in a multi-document transaction. Standalone servers (e.g. a local
+// development instance) do not support transactions; there fn runs without one
+func WithTransaction(ctx context.Context, fn func(sessCtx mongo.SessionContext) error) error {
+	session, err := Client.StartSession()
+
+	if err != nil {
+		return err
+	}
+
+	defer session.EndSession(ctx)
+
+	_, err = session.WithTransaction(ctx, func(sessCtx mongo.SessionContext) (interface{}, error) {
+		return nil, fn(sessCtx)
+	})
+
+	if isTransactionUnsupported(err) {
+		transactionFallback.Do(func() {
+			log.Println("MongoDB does not support transactions (not a replica set), multi-document writes run without one")
+		})
+
+		return mongo.WithSession(ctx, session, fn)
+	}
+
+	return err
+}
+
+func isTransactionUnsupported(err error) bool {
+	var cmdErr mongo.CommandError
+
+	// IllegalOperation: "Transaction numbers are only allowed on a replica set member or mongos"
+	return errors.As(err, &cmdErr) && cmdErr.Code == 20
+}
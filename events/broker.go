@@ -0,0 +1,61 @@
+package events
+
+import (
+	"sync"
+)
+
+// Event pushed to the subscribers of a topic (e.g. the floor board)
+type Event struct {
+	Topic		string			`json:"topic"`
+	Name		string			`json:"name"`
+	Data		interface{}		`json:"data"`
+}
+
+// Fans events out to the clients listening on a topic. Slow subscribers miss
+// events instead of blocking the publisher
+type Broker struct {
+	mu				sync.Mutex
+	subscribers		map[string]map[chan Event]bool
+}
+
+var Default *Broker = NewBroker()
+
+func NewBroker() *Broker {
+	return &Broker{subscribers: map[string]map[chan Event]bool{}}
+}
+
+// Returns the channel of the new subscription and the function ending it
+func (b *Broker) Subscribe(topic string) (chan Event, func()) {
+	ch := make(chan Event, 16)
+
+	b.mu.Lock()
+
+	if b.subscribers[topic] == nil {
+		b.subscribers[topic] = map[chan Event]bool{}
+	}
+
+	b.subscribers[topic][ch] = true
+	b.mu.Unlock()
+
+	return ch, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+
+		if b.subscribers[topic][ch] {
+			delete(b.subscribers[topic], ch)
+			close(ch)
+		}
+	}
+}
+
+func (b *Broker) Publish(topic string, name string, data interface{}) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for ch := range b.subscribers[topic] {
+		select {
+		case ch <- Event{Topic: topic, Name: name, Data: data}:
+		default:
+		}
+	}
+}
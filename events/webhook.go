@@ -0,0 +1,34 @@
+package events
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+var webhookClient = &http.Client{Timeout: 10 * time.Second}
+
+// Posts the event as JSON to an external endpoint (e.g. an SMS gateway or pager integration)
+func PostWebhook(url string, event Event) error {
+	body, err := json.Marshal(event)
+
+	if err != nil {
+		return err
+	}
+
+	res, err := webhookClient.Post(url, "application/json", bytes.NewReader(body))
+
+	if err != nil {
+		return err
+	}
+
+	defer res.Body.Close()
+
+	if res.StatusCode >= 300 {
+		return fmt.Errorf("webhook %s responded with %s", url, res.Status)
+	}
+
+	return nil
+}
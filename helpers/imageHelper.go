@@ -0,0 +1,101 @@
+package helpers
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+)
+
+const MAX_IMAGE_SIZE = 5 << 20
+const MAX_IMAGE_PIXELS = 40000000
+
+var THUMBNAIL_WIDTHS = []int{128, 256, 512}
+
+var IMAGE_EXTENSIONS = map[string]string{
+	"image/jpeg": "jpg",
+	"image/png": "png",
+}
+
+// Checks size and (sniffed, not client provided) type of an uploaded image and decodes it
+func DecodeImage(data []byte) (img image.Image, contentType string, err error) {
+	if len(data) == 0 || len(data) > MAX_IMAGE_SIZE {
+		return nil, "", fmt.Errorf("Image must not be empty or larger than %d MB", MAX_IMAGE_SIZE >> 20)
+	}
+
+	contentType = http.DetectContentType(data)
+
+	if _, ok := IMAGE_EXTENSIONS[contentType]; !ok {
+		return nil, "", fmt.Errorf("Image type %s is not supported, use JPEG or PNG", contentType)
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+
+	if err != nil || config.Width * config.Height > MAX_IMAGE_PIXELS {
+		return nil, "", fmt.Errorf("Image could not be decoded or is too large")
+	}
+
+	img, _, err = image.Decode(bytes.NewReader(data))
+
+	if err != nil {
+		return nil, "", fmt.Errorf("Image could not be decoded")
+	}
+
+	return img, contentType, nil
+}
+
+// Scales the image down to the given width keeping its aspect ratio by
+// averaging the source pixels covered by every target pixel
+func Thumbnail(src image.Image, width int) image.Image {
+	bounds := src.Bounds()
+
+	if bounds.Dx() <= width {
+		return src
+	}
+
+	height := bounds.Dy() * width / bounds.Dx()
+
+	if height < 1 {
+		height = 1
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+
+	for y := 0; y < height; y++ {
+		y0 := bounds.Min.Y + y * bounds.Dy() / height
+		y1 := bounds.Min.Y + (y + 1) * bounds.Dy() / height
+
+		for x := 0; x < width; x++ {
+			x0 := bounds.Min.X + x * bounds.Dx() / width
+			x1 := bounds.Min.X + (x + 1) * bounds.Dx() / width
+			var r, g, b, a, n uint64
+
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					pr, pg, pb, pa := src.At(sx, sy).RGBA()
+					r, g, b, a, n = r + uint64(pr), g + uint64(pg), b + uint64(pb), a + uint64(pa), n + 1
+				}
+			}
+
+			dst.Set(x, y, color.RGBA64{uint16(r / n), uint16(g / n), uint16(b / n), uint16(a / n)})
+		}
+	}
+
+	return dst
+}
+
+func EncodeImage(img image.Image, contentType string) ([]byte, error) {
+	var buf bytes.Buffer
+	var err error
+
+	if contentType == "image/png" {
+		err = png.Encode(&buf, img)
+	} else {
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: 85})
+	}
+
+	return buf.Bytes(), err
+}
@@ -0,0 +1,366 @@
+package helpers
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	DEFAULT_LIMIT	int = 10
+	MAX_LIMIT		int = 100
+)
+
+type FieldKind int
+
+const (
+	STRING_FIELD FieldKind = iota
+	INT_FIELD
+	FLOAT_FIELD
+	BOOL_FIELD
+)
+
+// Describes what a list endpoint lets clients filter and sort by
+type ListSpec struct {
+	Filters		map[string]FieldKind	// query params matched against the field of the same name, comma separated values match any
+	Sorts		[]string				// sortable fields, the first one (prefixed with - for descending) is the default
+	Date_field	string					// field the from/to query params are applied to
+	Stages		[]bson.D				// aggregation stages run on each page, e.g. lookups and projections
+}
+
+type ListQuery struct {
+	Filter		bson.D
+	Sort_field	string
+	Descending	bool
+	Limit		int
+	Skip		int
+	Cursor		*listCursor
+}
+
+type ListResult struct {
+	Total_count		int64		`json:"total_count"`
+	Count			int			`json:"count"`
+	Items			[]bson.M	`json:"items"`
+	Next_cursor		string		`json:"next_cursor"`
+	Next			string		`json:"next"`
+}
+
+type listCursor struct {
+	Value	interface{}			`bson:"v"`
+	ID		primitive.ObjectID	`bson:"id"`
+}
+
+// Reads limit (or recordPerPage), cursor (or page), sort, from/to and the field filters
+// allowed by the spec from the query string
+func ParseListQuery(c *gin.Context, spec ListSpec) (query ListQuery, err error) {
+	query.Filter = bson.D{}
+	query.Limit = DEFAULT_LIMIT
+
+	limit := c.Query("limit")
+
+	if limit == "" {
+		limit = c.Query("recordPerPage")
+	}
+
+	if parsed, convErr := strconv.Atoi(limit); convErr == nil && parsed > 0 {
+		query.Limit = min(parsed, MAX_LIMIT)
+	}
+
+	sortKey := c.Query("sort")
+
+	if sortKey == "" && len(spec.Sorts) > 0 {
+		sortKey = spec.Sorts[0]
+	}
+
+	if sortKey == "" {
+		sortKey = "_id"
+	}
+
+	query.Descending = strings.HasPrefix(sortKey, "-")
+	query.Sort_field = strings.TrimPrefix(sortKey, "-")
+
+	if query.Sort_field != "_id" && !containsField(spec.Sorts, query.Sort_field) {
+		err = errors.New("Cannot sort by " + query.Sort_field)
+		return
+	}
+
+	for param, kind := range spec.Filters {
+		raw := c.Query(param)
+
+		if raw == "" {
+			continue
+		}
+
+		var values bson.A
+
+		for _, part := range strings.Split(raw, ",") {
+			value, parseErr := parseFieldValue(strings.TrimSpace(part), kind)
+
+			if parseErr != nil {
+				err = errors.New("Invalid value for " + param + ": " + part)
+				return
+			}
+
+			values = append(values, value)
+		}
+
+		if len(values) == 1 {
+			query.Filter = append(query.Filter, bson.E{Key: param, Value: values[0]})
+		} else {
+			query.Filter = append(query.Filter, bson.E{Key: param, Value: bson.D{{Key: "$in", Value: values}}})
+		}
+	}
+
+	if spec.Date_field != "" {
+		dateRange := bson.D{}
+
+		if from := c.Query("from"); from != "" {
+			fromDate, parseErr := ParseDate(from, false)
+
+			if parseErr != nil {
+				err = errors.New("Invalid from date, use RFC3339 or YYYY-MM-DD")
+				return
+			}
+
+			dateRange = append(dateRange, bson.E{Key: "$gte", Value: fromDate})
+		}
+
+		if to := c.Query("to"); to != "" {
+			toDate, parseErr := ParseDate(to, true)
+
+			if parseErr != nil {
+				err = errors.New("Invalid to date, use RFC3339 or YYYY-MM-DD")
+				return
+			}
+
+			dateRange = append(dateRange, bson.E{Key: "$lte", Value: toDate})
+		}
+
+		if len(dateRange) > 0 {
+			query.Filter = append(query.Filter, bson.E{Key: spec.Date_field, Value: dateRange})
+		}
+	}
+
+	if cursor := c.Query("cursor"); cursor != "" {
+		query.Cursor, err = decodeCursor(cursor)
+
+		if err != nil {
+			err = errors.New("Invalid cursor")
+		}
+
+		return
+	}
+
+	// Page numbers are still accepted for clients that paginated before cursors existed
+	if page, convErr := strconv.Atoi(c.Query("page")); convErr == nil && page > 1 {
+		query.Skip = (page - 1) * query.Limit
+	}
+
+	return
+}
+
+// Runs the query against the collection; match narrows the documents further (endpoint specific filters)
+func RunListQuery(ctx context.Context, collection *mongo.Collection, spec ListSpec, query ListQuery, match bson.D) (result ListResult, err error) {
+	filter := append(bson.D{}, query.Filter...)
+	filter = append(filter, match...)
+
+	result.Total_count, err = collection.CountDocuments(ctx, filter)
+
+	if err != nil {
+		return
+	}
+
+	pageFilter := filter
+
+	if query.Cursor != nil {
+		pageFilter = append(append(bson.D{}, filter...), bson.E{Key: "$and", Value: bson.A{cursorFilter(query)}})
+	}
+
+	direction := 1
+
+	if query.Descending {
+		direction = -1
+	}
+
+	sortStage := bson.D{{Key: query.Sort_field, Value: direction}}
+
+	if query.Sort_field != "_id" {
+		sortStage = append(sortStage, bson.E{Key: "_id", Value: direction})
+	}
+
+	pipeline := mongo.Pipeline{
+		bson.D{{Key: "$match", Value: pageFilter}},
+		bson.D{{Key: "$sort", Value: sortStage}},
+	}
+
+	if query.Skip > 0 {
+		pipeline = append(pipeline, bson.D{{Key: "$skip", Value: query.Skip}})
+	}
+
+	// One extra document tells whether there is a next page
+	pipeline = append(pipeline, bson.D{{Key: "$limit", Value: query.Limit + 1}})
+	pipeline = append(pipeline, spec.Stages...)
+
+	res, err := collection.Aggregate(ctx, pipeline)
+
+	if err != nil {
+		return
+	}
+
+	result.Items = []bson.M{}
+
+	if err = res.All(ctx, &result.Items); err != nil {
+		return
+	}
+
+	if len(result.Items) > query.Limit {
+		result.Items = result.Items[:query.Limit]
+		last := result.Items[query.Limit-1]
+		id, _ := last["_id"].(primitive.ObjectID)
+		result.Next_cursor, err = encodeCursor(listCursor{Value: last[query.Sort_field], ID: id})
+	}
+
+	result.Count = len(result.Items)
+
+	return
+}
+
+// Handles a list request end to end: parses the query, runs it and responds with the envelope.
+// The items can be adjusted (e.g. localized) by the caller through transform before they are sent
+func RespondWithList(c *gin.Context, ctx context.Context, collection *mongo.Collection, spec ListSpec, match bson.D, errMsg string, transform func([]bson.M)) {
+	query, err := ParseListQuery(c, spec)
+
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	result, err := RunListQuery(ctx, collection, spec, query, match)
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": errMsg})
+		return
+	}
+
+	if transform != nil {
+		transform(result.Items)
+	}
+
+	if result.Next_cursor != "" {
+		next := *c.Request.URL
+		params := next.Query()
+		params.Set("cursor", result.Next_cursor)
+		params.Del("page")
+		next.RawQuery = params.Encode()
+		result.Next = next.RequestURI()
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// Continues after the last document of the previous page; documents without the sort field
+// come first in ascending order and last in descending order, like MongoDB sorts them
+func cursorFilter(query ListQuery) bson.D {
+	field := query.Sort_field
+	after := "$gt"
+
+	if query.Descending {
+		after = "$lt"
+	}
+
+	if field == "_id" {
+		return bson.D{{Key: "_id", Value: bson.D{{Key: after, Value: query.Cursor.ID}}}}
+	}
+
+	sameValue := bson.D{{Key: field, Value: query.Cursor.Value}, {Key: "_id", Value: bson.D{{Key: after, Value: query.Cursor.ID}}}}
+
+	if query.Cursor.Value == nil {
+		if query.Descending {
+			return sameValue
+		}
+
+		return bson.D{{Key: "$or", Value: bson.A{sameValue, bson.D{{Key: field, Value: bson.D{{Key: "$ne", Value: nil}}}}}}}
+	}
+
+	alternatives := bson.A{bson.D{{Key: field, Value: bson.D{{Key: after, Value: query.Cursor.Value}}}}, sameValue}
+
+	if query.Descending {
+		alternatives = append(alternatives, bson.D{{Key: field, Value: nil}})
+	}
+
+	return bson.D{{Key: "$or", Value: alternatives}}
+}
+
+// Cursors are the BSON encoded sort value and id of the last document, so dates and numbers keep their type
+func encodeCursor(cursor listCursor) (string, error) {
+	raw, err := bson.Marshal(cursor)
+
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+func decodeCursor(encoded string) (*listCursor, error) {
+	var cursor listCursor
+
+	raw, err := base64.RawURLEncoding.DecodeString(encoded)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err = bson.Unmarshal(raw, &cursor); err != nil {
+		return nil, err
+	}
+
+	return &cursor, nil
+}
+
+func parseFieldValue(raw string, kind FieldKind) (interface{}, error) {
+	switch kind {
+	case INT_FIELD:
+		return strconv.Atoi(raw)
+	case FLOAT_FIELD:
+		return strconv.ParseFloat(raw, 64)
+	case BOOL_FIELD:
+		return strconv.ParseBool(raw)
+	}
+
+	return raw, nil
+}
+
+// Accepts RFC3339 timestamps or plain dates; a plain end date covers the whole day
+func ParseDate(raw string, endOfDay bool) (time.Time, error) {
+	if date, err := time.Parse(time.RFC3339, raw); err == nil {
+		return date, nil
+	}
+
+	date, err := time.Parse("2006-01-02", raw)
+
+	if err == nil && endOfDay {
+		date = date.Add(24*time.Hour - time.Second)
+	}
+
+	return date, err
+}
+
+func containsField(fields []string, field string) bool {
+	for _, candidate := range fields {
+		if strings.TrimPrefix(candidate, "-") == field {
+			return true
+		}
+	}
+
+	return false
+}
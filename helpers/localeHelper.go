@@ -0,0 +1,137 @@
+package helpers
+
+import (
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var DEFAULT_LOCALE string = defaultLocale()
+
+func defaultLocale() string {
+	if locale := os.Getenv("DEFAULT_LOCALE"); locale != "" {
+		return strings.ToLower(locale)
+	}
+
+	return "en"
+}
+
+// Picks the locale of the request: the lang query param wins over the
+// Accept-Language header (highest q value), otherwise the default locale
+func RequestedLocale(c *gin.Context) string {
+	if lang := c.Query("lang"); lang != "" {
+		return strings.ToLower(lang)
+	}
+
+	locale := DEFAULT_LOCALE
+	best := 0.0
+
+	for _, part := range strings.Split(c.GetHeader("Accept-Language"), ",") {
+		fields := strings.Split(strings.TrimSpace(part), ";")
+		tag := strings.ToLower(strings.TrimSpace(fields[0]))
+		q := 1.0
+
+		if tag == "" || tag == "*" {
+			continue
+		}
+
+		for _, param := range fields[1:] {
+			if value, found := strings.CutPrefix(strings.TrimSpace(param), "q="); found {
+				if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+					q = parsed
+				}
+			}
+		}
+
+		if q > best {
+			locale = tag
+			best = q
+		}
+	}
+
+	return locale
+}
+
+// Locales a response was actually served in, for its Content-Language header
+type ServedLocales []string
+
+func (s *ServedLocales) Add(locale string) {
+	for _, served := range *s {
+		if served == locale {
+			return
+		}
+	}
+
+	*s = append(*s, locale)
+}
+
+// Comma separated served locales; the default locale if nothing was translated
+func (s ServedLocales) String() string {
+	if len(s) == 0 {
+		return DEFAULT_LOCALE
+	}
+
+	return strings.Join(s, ", ")
+}
+
+// Looks the locale up in the translations, falling back to its base
+// language (de-at -> de) and then to the default locale. The locale served
+// (the default one if the original text is kept) is added to served, if given
+func Translate(translations map[string]string, locale string, served *ServedLocales) (string, bool) {
+	candidates := []string{locale}
+
+	if base, _, found := strings.Cut(locale, "-"); found {
+		candidates = append(candidates, base)
+	}
+
+	candidates = append(candidates, DEFAULT_LOCALE)
+
+	for _, candidate := range candidates {
+		for key, value := range translations {
+			if strings.ToLower(key) == candidate && value != "" {
+				if served != nil {
+					served.Add(candidate)
+				}
+
+				return value, true
+			}
+		}
+	}
+
+	if served != nil {
+		served.Add(DEFAULT_LOCALE)
+	}
+
+	return "", false
+}
+
+// Replaces the given fields of a raw document with their translation
+// stored under <field>_translations, keeping the original when missing
+func LocalizeDocument(doc primitive.M, locale string, served *ServedLocales, fields ...string) {
+	for _, field := range fields {
+		raw, ok := doc[field + "_translations"].(primitive.M)
+
+		if !ok {
+			if served != nil {
+				served.Add(DEFAULT_LOCALE)
+			}
+
+			continue
+		}
+
+		translations := map[string]string{}
+
+		for key, value := range raw {
+			if text, ok := value.(string); ok {
+				translations[key] = text
+			}
+		}
+
+		if text, found := Translate(translations, locale, served); found {
+			doc[field] = text
+		}
+	}
+}
@@ -2,6 +2,9 @@ package helpers
 
 import (
 	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"log"
 	"os"
@@ -27,6 +30,23 @@ var userCollection *mongo.Collection = database.OpenCollection(database.Client,
 
 var SECRET_KEY string = os.Getenv("SECRET_KEY")
 
+// Table QR codes are signed w/ a key of their own so they can never pass as staff tokens;
+// w/o GUEST_TOKEN_SECRET it is derived from SECRET_KEY
+var GUEST_TOKEN_SECRET string = guestTokenSecret()
+
+const GUEST_TOKEN_AUDIENCE = "guest"
+
+func guestTokenSecret() string {
+	if secret := os.Getenv("GUEST_TOKEN_SECRET"); secret != "" {
+		return secret
+	}
+
+	mac := hmac.New(sha256.New, []byte(SECRET_KEY))
+	mac.Write([]byte("guest-token"))
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
 func GenerateAllTokens(email string, firstName string, lastName string, uid string) (signedToken string, signedRefreshToken string, err error) {
 	claims := &SignedDetails{
 		Email: email,
@@ -89,22 +109,72 @@ func UpdateAllTokens(signedToken string, signedRefreshToken string, uid string)
 
 func ValidateToken(signedToken string) (claims *SignedDetails, msg string) {
 	token, err := jwt.ParseWithClaims(signedToken, &SignedDetails{}, func(token *jwt.Token)(interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("Unexpected signing method %v", token.Header["alg"])
+		}
+
 		return []byte(SECRET_KEY), nil
 	})
 
+	if err != nil {
+		msg = err.Error()
+		return
+	}
+
 	claims, ok := token.Claims.(*SignedDetails)
 
-	if !ok {
+	if !ok || !token.Valid || claims.Uid == "" {
 		msg = fmt.Sprintf("Token is invalid")
-		msg = err.Error()
 		return 
 	}
 
 	if claims.ExpiresAt < time.Now().Local().Unix() {
 		msg = fmt.Sprintf("Token is expired")
+		return
+	}
+
+	return claims, msg
+}
+// Claims of the QR code token of a table; bumping the table's guest_token_version revokes all earlier codes
+type TableClaims struct {
+	Table_id				string
+	Version					int
+	jwt.StandardClaims
+}
+
+func GenerateTableToken(tableId string, version int) (signedToken string, err error) {
+	claims := &TableClaims{
+		Table_id: tableId,
+		Version: version,
+		StandardClaims: jwt.StandardClaims{
+			Audience: GUEST_TOKEN_AUDIENCE,
+			IssuedAt: time.Now().Local().Unix(), // No expiry, the code stays printed on the table until it is rotated
+		},
+	}
+
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(GUEST_TOKEN_SECRET))
+}
+
+func ValidateTableToken(signedToken string) (claims *TableClaims, msg string) {
+	token, err := jwt.ParseWithClaims(signedToken, &TableClaims{}, func(token *jwt.Token)(interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("Unexpected signing method %v", token.Header["alg"])
+		}
+
+		return []byte(GUEST_TOKEN_SECRET), nil
+	})
+
+	if err != nil {
 		msg = err.Error()
 		return
 	}
 
+	claims, ok := token.Claims.(*TableClaims)
+
+	if !ok || !token.Valid || claims.Table_id == "" || !claims.VerifyAudience(GUEST_TOKEN_AUDIENCE, true) {
+		msg = fmt.Sprintf("Table token is invalid")
+		return
+	}
+
 	return claims, msg
-}
\ No newline at end of file
+}
@@ -1,13 +1,18 @@
 package main
 
 import (
+	"log"
 	"os"
+	"strings"
+	"time"
 
 	"go.mongodb.org/mongo-driver/mongo"
 	"github.com/gin-gonic/gin"
+	controller "github.com/lackingworth/Go-Restaurant-Management/controllers"
 	"github.com/lackingworth/Go-Restaurant-Management/database"
 	"github.com/lackingworth/Go-Restaurant-Management/middleware"
 	"github.com/lackingworth/Go-Restaurant-Management/routes"
+	"github.com/lackingworth/Go-Restaurant-Management/storage"
 )
 
 var foodCollection *mongo.Collection = database.OpenCollection(database.Client, "food")
@@ -19,17 +24,69 @@ func main() {
 		port = "8000"
 	}
 
+	// /foods-search relies on the text index
+	if err := controller.EnsureSearchIndexes(); err != nil {
+		log.Fatal(err)
+	}
+
+	// Deduplication of platform orders relies on this index
+	if err := controller.EnsureAggregatorIndexes(); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := controller.EnsureNoteIndexes(); err != nil {
+		log.Fatal(err)
+	}
+
+	// Menu version numbers rely on this index
+	if err := controller.EnsureMenuVersionIndexes(); err != nil {
+		log.Fatal(err)
+	}
+
+	// Idempotency-Key claims rely on the unique index
+	if err := middleware.EnsureIdempotencyIndexes(); err != nil {
+		log.Fatal(err)
+	}
+
+	// Scheduled price changes and menu versions are applied once they become effective
+	go func() {
+		for range time.Tick(time.Minute) {
+			controller.ApplyScheduledPrices()
+			controller.PublishScheduledMenus()
+		}
+	}()
+
 	router := gin.New()
 	router.Use(gin.Logger())
+
+	// Uploads are only served from here when they live under a path of this app, not another host
+	if files, ok := storage.Files.(*storage.LocalStorage); ok && strings.HasPrefix(files.BaseURL, "/") && !strings.Contains(files.BaseURL, ":") {
+		router.Static(files.BaseURL, files.Dir)
+	}
+
 	routes.UserRoutes(router)
+	routes.GuestRoutes(router)
+	routes.AggregatorWebhookRoutes(router)
 	router.Use(middleware.Authentication())
+	router.Use(middleware.Idempotency())
 
 	routes.FoodRoutes(router)
 	routes.MenuRoutes(router)
+	routes.CategoryRoutes(router)
 	routes.TableRoutes(router)
+	routes.FloorRoutes(router)
+	routes.WaitlistRoutes(router)
+	routes.GuestOrderRoutes(router)
 	routes.OrderRoutes(router)
+	routes.DeliveryRoutes(router)
+	routes.AggregatorRoutes(router)
 	routes.OrderItemRoutes(router)
+	routes.NoteRoutes(router)
 	routes.InvoiceRoutes(router)
+	routes.IngredientRoutes(router)
+	routes.WasteRoutes(router)
+	routes.BundleRoutes(router)
+	routes.KitchenRoutes(router)
 
 	router.Run(":" + port)
 }
\ No newline at end of file
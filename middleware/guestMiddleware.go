@@ -0,0 +1,58 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lackingworth/Go-Restaurant-Management/database"
+	helper "github.com/lackingworth/Go-Restaurant-Management/helpers"
+	"github.com/lackingworth/Go-Restaurant-Management/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var tableCollection *mongo.Collection = database.OpenCollection(database.Client, "table")
+
+// Authenticates guests by the QR code token of their table (guest_token header or ?token=) instead of the staff JWT
+func GuestAuthentication() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		var table models.Table
+		defer cancel()
+
+		guestToken := c.Request.Header.Get("guest_token")
+
+		if guestToken == "" {
+			guestToken = c.Query("token")
+		}
+
+		if guestToken == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": fmt.Sprintf("No table token provided")})
+			c.Abort()
+			return
+		}
+
+		claims, err := helper.ValidateTableToken(guestToken)
+
+		if err != "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err})
+			c.Abort()
+			return
+		}
+
+		// Codes of rotated tokens (or deleted tables) are no longer accepted
+		if tableCollection.FindOne(ctx, bson.M{"table_id": claims.Table_id}).Decode(&table) != nil || table.Guest_token_version != claims.Version {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": fmt.Sprintf("Table token was revoked")})
+			c.Abort()
+			return
+		}
+
+		c.Set("table_id", table.Table_id)
+		c.Set("table_number", table.Table_number)
+
+		c.Next()
+	}
+}
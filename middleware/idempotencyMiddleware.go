@@ -0,0 +1,222 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lackingworth/Go-Restaurant-Management/database"
+	"github.com/lackingworth/Go-Restaurant-Management/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const IDEMPOTENCY_HEADER = "Idempotency-Key"
+
+// How long the first response to a key is replayed, IDEMPOTENCY_TTL_HOURS (24 by default)
+var IDEMPOTENCY_TTL time.Duration = idempotencyTTL()
+
+// How long a request may hold its key while IN_PROGRESS; a key left behind by a crashed request
+// can be claimed again once it passes
+const IDEMPOTENCY_LEASE = 5 * time.Minute
+
+var idempotencyCollection *mongo.Collection = database.OpenCollection(database.Client, "idempotencyKey")
+
+func idempotencyTTL() time.Duration {
+	hours, err := strconv.Atoi(os.Getenv("IDEMPOTENCY_TTL_HOURS"))
+
+	if err != nil || hours < 1 {
+		hours = 24
+	}
+
+	return time.Duration(hours) * time.Hour
+}
+
+// Keeps a copy of the response body so it can be stored for replays
+type responseRecorder struct {
+	gin.ResponseWriter
+	body	bytes.Buffer
+}
+
+func (w *responseRecorder) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *responseRecorder) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// Keys are unique per caller; expired keys are removed by MongoDB (and ignored until then). Each record
+// carries its own expires_at, so changing IDEMPOTENCY_TTL_HOURS does not touch the index
+func EnsureIdempotencyIndexes() error {
+	var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	// Replaced by idempotency_expiry, its expireAfterSeconds followed IDEMPOTENCY_TTL_HOURS
+	_, err := idempotencyCollection.Indexes().DropOne(ctx, "idempotency_ttl")
+	var cmdErr mongo.CommandError
+
+	if err != nil && !(errors.As(err, &cmdErr) && (cmdErr.Name == "IndexNotFound" || cmdErr.Name == "NamespaceNotFound")) {
+		return err
+	}
+
+	_, err = idempotencyCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "key", Value: 1}, {Key: "scope", Value: 1}}, Options: options.Index().SetName("idempotency_key").SetUnique(true)},
+		{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetName("idempotency_expiry").SetExpireAfterSeconds(0)},
+	})
+
+	return err
+}
+
+// Claims the key for the request; returns the stored record instead if the key was used before
+func claimIdempotencyKey(ctx context.Context, record models.IdempotencyKey) (*models.IdempotencyKey, error) {
+	for attempt := 0; attempt < 2; attempt++ {
+		var existing models.IdempotencyKey
+
+		_, err := idempotencyCollection.InsertOne(ctx, record)
+
+		if err == nil {
+			return nil, nil
+		}
+
+		if !mongo.IsDuplicateKeyError(err) {
+			return nil, err
+		}
+
+		err = idempotencyCollection.FindOne(ctx, bson.M{"key": record.Key, "scope": record.Scope}).Decode(&existing)
+
+		if err == mongo.ErrNoDocuments {
+			continue
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		expired := !time.Now().Before(existing.Expires_at)
+		abandoned := existing.Status == "IN_PROGRESS" && time.Now().After(existing.Lease_until)
+
+		if !expired && !abandoned {
+			return &existing, nil
+		}
+
+		// Expired (but not removed by MongoDB yet) or its request never finished; only the
+		// record as read is removed, so a concurrent claim of the key is left alone
+		if _, err := idempotencyCollection.DeleteOne(ctx, bson.M{"_id": existing.ID, "status": existing.Status}); err != nil {
+			return nil, err
+		}
+	}
+
+	return nil, fmt.Errorf("Idempotency-Key could not be claimed")
+}
+
+// Makes POST / PATCH requests w/ an Idempotency-Key header safe to retry: the first response is stored and
+// replayed (w/ the Idempotent-Replayed header) for retries of the same request by the same caller within
+// IDEMPOTENCY_TTL. Reusing a key for a different request is rejected. Requests w/o the header are not affected
+func Idempotency() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.Request.Header.Get(IDEMPOTENCY_HEADER)
+
+		if key == "" || (c.Request.Method != http.MethodPost && c.Request.Method != http.MethodPatch) {
+			c.Next()
+			return
+		}
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		if len(key) > 255 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Idempotency-Key must be at most 255 characters"})
+			c.Abort()
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			c.Abort()
+			return
+		}
+
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		hash := sha256.New()
+		fmt.Fprintf(hash, "%s %s\n", c.Request.Method, c.Request.URL.RequestURI())
+		hash.Write(body)
+
+		// Staff are told apart by their login, guests by their table
+		scope := c.GetString("uid")
+
+		if scope == "" {
+			scope = "table:" + c.GetString("table_id")
+		}
+
+		record := models.IdempotencyKey{
+			Key: key,
+			Scope: scope,
+			Request_hash: hex.EncodeToString(hash.Sum(nil)),
+			Status: "IN_PROGRESS",
+		}
+
+		record.Created_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		record.Lease_until = record.Created_at.Add(IDEMPOTENCY_LEASE)
+		record.Expires_at = record.Created_at.Add(IDEMPOTENCY_TTL)
+		record.ID = primitive.NewObjectID()
+
+		existing, err := claimIdempotencyKey(ctx, record)
+
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error occured while checking the Idempotency-Key"})
+			c.Abort()
+			return
+		}
+
+		if existing != nil {
+			switch {
+			case existing.Request_hash != record.Request_hash:
+				c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Idempotency-Key was already used for a different request"})
+			case existing.Status == "IN_PROGRESS":
+				c.JSON(http.StatusConflict, gin.H{"error": "A request w/ this Idempotency-Key is still being processed"})
+			default:
+				c.Header("Idempotent-Replayed", "true")
+				c.Data(existing.Response_status, existing.Content_type, existing.Response_body)
+			}
+
+			c.Abort()
+			return
+		}
+
+		recorder := &responseRecorder{ResponseWriter: c.Writer}
+		c.Writer = recorder
+
+		c.Next()
+
+		// Server errors are stored as well: some handlers fail after they already wrote, so running
+		// the request again could repeat those writes
+		updateObj := bson.D{
+			{Key: "status", Value: "DONE"},
+			{Key: "response_status", Value: recorder.Status()},
+			{Key: "response_body", Value: recorder.body.Bytes()},
+			{Key: "content_type", Value: recorder.Header().Get("Content-Type")},
+		}
+
+		if _, err := idempotencyCollection.UpdateOne(ctx, bson.M{"_id": record.ID}, bson.D{{Key: "$set", Value: updateObj}}); err != nil {
+			log.Println(err)
+		}
+	}
+}
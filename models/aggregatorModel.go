@@ -0,0 +1,39 @@
+package models
+
+import (
+	"time"
+	
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Maps a menu item of a delivery platform to our food (or bundle w/ its components) in a given size
+type AggregatorMapping struct {
+	ID					primitive.ObjectID		`bson:"_id"`
+	Platform			*string					`json:"platform" validate:"required"`
+	External_item_id	*string					`json:"external_item_id" validate:"required"`
+	Food_id				*string					`json:"food_id" validate:"required_without=Bundle_id,excluded_with=Bundle_id"`
+	Bundle_id			*string					`json:"bundle_id"`
+	Components			[]BundleComponent		`json:"components" validate:"required_with=Bundle_id,omitempty,dive"`
+	Quantity			*string					`json:"quantity" validate:"omitempty,eq=S|eq=M|eq=L"`
+	Created_at			time.Time				`json:"created_at"`
+	Updated_at			time.Time				`json:"updated_at"`
+	Mapping_id			string					`json:"mapping_id"`
+}
+
+// Order received from a delivery platform w/ the raw payload, the order it became and the last status pushed back;
+// RECEIVED while the order is being placed, status_code is what the webhook was answered w/
+type AggregatorOrder struct {
+	ID					primitive.ObjectID		`bson:"_id"`
+	Platform			string					`json:"platform"`
+	External_id			string					`json:"external_id"`
+	Status				string					`json:"status" validate:"eq=RECEIVED|eq=ACCEPTED|eq=REJECTED"`
+	Order_id			*string					`json:"order_id"`
+	Error				*string					`json:"error"`
+	Status_code			int						`json:"status_code"`
+	Payload				string					`json:"payload"`
+	Pushed_status		*string					`json:"pushed_status"`
+	Push_error			*string					`json:"push_error"`
+	Created_at			time.Time				`json:"created_at"`
+	Updated_at			time.Time				`json:"updated_at"`
+	Aggregator_order_id	string					`json:"aggregator_order_id"`
+}
@@ -0,0 +1,19 @@
+package models
+
+import (
+	"time"
+	
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Dining area of the floor plan (e.g. patio, bar, main room); tables are laid out on its canvas
+type Area struct {
+	ID					primitive.ObjectID		`bson:"_id"`
+	Name				*string					`json:"name" validate:"required,min=2,max=100"`
+	Width				*float64				`json:"width" validate:"omitempty,gt=0"`
+	Height				*float64				`json:"height" validate:"omitempty,gt=0"`
+	Position			*int					`json:"position"`
+	Created_at			time.Time				`json:"created_at"`
+	Updated_at			time.Time				`json:"updated_at"`
+	Area_id				string					`json:"area_id"`
+}
@@ -0,0 +1,30 @@
+package models
+
+import (
+	"time"
+	
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type Bundle struct {
+	ID					primitive.ObjectID		`bson:"_id"`
+	Name				*string					`json:"name" validate:"required,min=2,max=100"`
+	Price				*float64				`json:"price" validate:"required,gt=0"`
+	Slots				[]BundleSlot			`json:"slots" validate:"required,min=1,dive"`
+	Created_at			time.Time				`json:"created_at"`
+	Updated_at			time.Time				`json:"updated_at"`
+	Bundle_id			string					`json:"bundle_id"`
+}
+
+// A choice slot of a bundle (e.g. "Starter") filled with one food of the menu category
+type BundleSlot struct {
+	Name				string					`json:"name" validate:"required"`
+	Category			string					`json:"category" validate:"required"`
+}
+
+// The food chosen for a slot when a bundle is ordered
+type BundleComponent struct {
+	Slot				string					`json:"slot" validate:"required"`
+	Food_id				string					`json:"food_id" validate:"required"`
+	Food_name			string					`json:"food_name"`
+}
@@ -0,0 +1,20 @@
+package models
+
+import (
+	"time"
+	
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// A section of a menu, or a subsection when Parent_id is set
+type Category struct {
+	ID					primitive.ObjectID		`bson:"_id"`
+	Name				*string					`json:"name" validate:"required,min=2,max=100"`
+	Name_translations	map[string]string		`json:"name_translations" validate:"omitempty,dive,keys,bcp47_language_tag,endkeys,required"`
+	Menu_id				*string					`json:"menu_id" validate:"required"`
+	Parent_id			*string					`json:"parent_id"`
+	Position			*int					`json:"position"`
+	Created_at			time.Time				`json:"created_at"`
+	Updated_at			time.Time				`json:"updated_at"`
+	Category_id			string					`json:"category_id"`
+}
@@ -0,0 +1,28 @@
+package models
+
+import (
+	"time"
+	
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type GeoPoint struct {
+	Lat					float64					`json:"lat" validate:"gte=-90,lte=90"`
+	Lng					float64					`json:"lng" validate:"gte=-180,lte=180"`
+}
+
+// Area delivered to: a radius around the restaurant (or another center) or a polygon, w/ its own fee and minimum order value
+type DeliveryZone struct {
+	ID					primitive.ObjectID		`bson:"_id"`
+	Name				*string					`json:"name" validate:"required,min=2,max=100"`
+	Shape				string					`json:"shape" validate:"eq=RADIUS|eq=POLYGON"`
+	Center				*GeoPoint				`json:"center"`
+	Radius_km			*float64				`json:"radius_km" validate:"required_if=Shape RADIUS,omitempty,gt=0"`
+	Polygon				[]GeoPoint				`json:"polygon" validate:"required_if=Shape POLYGON,omitempty,min=3,dive"`
+	Fee					*float64				`json:"fee" validate:"required,gte=0"`
+	Minimum_order		*float64				`json:"minimum_order" validate:"omitempty,gte=0"`
+	Active				*bool					`json:"active"`
+	Created_at			time.Time				`json:"created_at"`
+	Updated_at			time.Time				`json:"updated_at"`
+	Zone_id				string					`json:"zone_id"`
+}
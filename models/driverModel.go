@@ -0,0 +1,39 @@
+package models
+
+import (
+	"time"
+	
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Delivery driver, optionally linked to the staff user they log in with
+type Driver struct {
+	ID					primitive.ObjectID		`bson:"_id"`
+	First_name			*string					`json:"first_name" validate:"required,min=2,max=100"`
+	Last_name			*string					`json:"last_name" validate:"required,min=2,max=100"`
+	Phone				*string					`json:"phone" validate:"required"`
+	Vehicle				*string					`json:"vehicle" validate:"omitempty,eq=BIKE|eq=SCOOTER|eq=CAR"`
+	User_id				*string					`json:"user_id"`
+	Status				string					`json:"status" validate:"eq=AVAILABLE|eq=ON_DELIVERY|eq=OFF_DUTY"`
+	Created_at			time.Time				`json:"created_at"`
+	Updated_at			time.Time				`json:"updated_at"`
+	Driver_id			string					`json:"driver_id"`
+}
+
+// Delivery order handed to a driver; every status change is timestamped
+type Delivery struct {
+	ID					primitive.ObjectID		`bson:"_id"`
+	Order_id			string					`json:"order_id"`
+	Driver_id			*string					`json:"driver_id" validate:"required"`
+	Zone_id				*string					`json:"zone_id"`
+	Fee					*float64				`json:"fee"`
+	Status				string					`json:"status" validate:"eq=ASSIGNED|eq=PICKED_UP|eq=DELIVERED|eq=CANCELLED"`
+	Assigned_at			time.Time				`json:"assigned_at"`
+	Picked_up_at		*time.Time				`json:"picked_up_at"`
+	Delivered_at		*time.Time				`json:"delivered_at"`
+	Cancelled_at		*time.Time				`json:"cancelled_at"`
+	Reason				*string					`json:"reason" validate:"omitempty,max=500"`
+	Created_at			time.Time				`json:"created_at"`
+	Updated_at			time.Time				`json:"updated_at"`
+	Delivery_id			string					`json:"delivery_id"`
+}
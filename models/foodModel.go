@@ -9,10 +9,27 @@ import (
 type Food struct {
 	ID				primitive.ObjectID		`bson:"_id"` 
 	Name 			*string 				`json:"name" validate:"required,min=2,max=100"`
+	Name_translations	map[string]string	`json:"name_translations" validate:"omitempty,dive,keys,bcp47_language_tag,endkeys,required"`
+	Description		*string					`json:"description" validate:"omitempty,max=1000"`
 	Price 			*float64				`json:"price" validate:"required"`
 	Food_image		*string					`json:"food_image" validate:"required"`
+	Food_thumbnails	map[string]string		`json:"food_thumbnails"`
 	Created_at		time.Time				`json:"created_at"`
 	Updated_at		time.Time				`json:"updated_at"`
 	Food_id			string					`json:"food_id"`
 	Menu_id			*string					`json:"menu_id" validate:"required"`
+	Category_id		*string					`json:"category_id"`
+	Position		*int					`json:"position"`
+	Recipe			[]RecipeItem			`json:"recipe" validate:"omitempty,dive"`
+	Allergens		[]string				`json:"allergens" validate:"omitempty,dive,eq=CELERY|eq=GLUTEN|eq=CRUSTACEANS|eq=EGGS|eq=FISH|eq=LUPIN|eq=MILK|eq=MOLLUSCS|eq=MUSTARD|eq=NUTS|eq=PEANUTS|eq=SESAME|eq=SOYA|eq=SULPHITES"`
+	Dietary_tags	[]string				`json:"dietary_tags" validate:"omitempty,dive,eq=VEGAN|eq=HALAL|eq=GLUTEN_FREE"`
+	Contains		[]string				`json:"contains"`
+	Suitable_for	[]string				`json:"suitable_for"`
+	Nutrition_override	*Nutrition			`json:"nutrition_override"`
+	Nutrition		*Nutrition				`json:"nutrition"`
+}
+
+type RecipeItem struct {
+	Ingredient_id		string					`json:"ingredient_id" validate:"required"`
+	Quantity			float64					`json:"quantity" validate:"required,gt=0"`
 }	
\ No newline at end of file
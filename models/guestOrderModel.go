@@ -0,0 +1,32 @@
+package models
+
+import (
+	"time"
+	
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Items a guest ordered through the QR code of their table; PENDING until staff approve it when approval is required
+type GuestOrder struct {
+	ID					primitive.ObjectID		`bson:"_id"`
+	Table_id			string					`json:"table_id"`
+	Items				[]GuestOrderItem		`json:"items" validate:"required,min=1,dive"`
+	Allergy_profile		[]string				`json:"allergy_profile" validate:"omitempty,dive,eq=CELERY|eq=GLUTEN|eq=CRUSTACEANS|eq=EGGS|eq=FISH|eq=LUPIN|eq=MILK|eq=MOLLUSCS|eq=MUSTARD|eq=NUTS|eq=PEANUTS|eq=SESAME|eq=SOYA|eq=SULPHITES"`
+	Status				string					`json:"status" validate:"eq=PENDING|eq=APPROVED|eq=REJECTED"`
+	Order_id			*string					`json:"order_id"`
+	Order_item_ids		[]string				`json:"order_item_ids"`
+	Reason				*string					`json:"reason" validate:"omitempty,max=500"`
+	Reviewed_by			*string					`json:"reviewed_by"`
+	Reviewed_at			*time.Time				`json:"reviewed_at"`
+	Created_at			time.Time				`json:"created_at"`
+	Updated_at			time.Time				`json:"updated_at"`
+	Guest_order_id		string					`json:"guest_order_id"`
+}
+
+// Guests pick what to order, prices are always taken from the menu
+type GuestOrderItem struct {
+	Food_id				*string					`json:"food_id" validate:"required_without=Bundle_id,excluded_with=Bundle_id"`
+	Bundle_id			*string					`json:"bundle_id"`
+	Components			[]BundleComponent		`json:"components" validate:"required_with=Bundle_id,omitempty,dive"`
+	Quantity			*string					`json:"quantity" validate:"required,eq=S|eq=M|eq=L"`
+}
@@ -0,0 +1,23 @@
+package models
+
+import (
+	"time"
+	
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// First response to a request w/ an Idempotency-Key, replayed for retries of the same request
+// by the same caller (Scope: staff user or guest table)
+type IdempotencyKey struct {
+	ID					primitive.ObjectID		`bson:"_id"`
+	Key					string					`json:"key"`
+	Scope				string					`json:"scope"`
+	Request_hash		string					`json:"request_hash"`
+	Status				string					`json:"status" validate:"eq=IN_PROGRESS|eq=DONE"`
+	Response_status		int						`json:"response_status"`
+	Response_body		[]byte					`json:"response_body"`
+	Content_type		string					`json:"content_type"`
+	Lease_until			time.Time				`json:"lease_until"`
+	Created_at			time.Time				`json:"created_at"`
+	Expires_at			time.Time				`json:"expires_at"`
+}
\ No newline at end of file
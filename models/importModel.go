@@ -0,0 +1,48 @@
+package models
+
+import (
+	"time"
+)
+
+// Menu of a bulk import or export; menus and their foods are matched to existing ones by name
+type MenuImport struct {
+	Name					string				`json:"name"`
+	Category				string				`json:"category"`
+	Name_translations		map[string]string	`json:"name_translations,omitempty"`
+	Category_translations	map[string]string	`json:"category_translations,omitempty"`
+	Start_date				*time.Time			`json:"start_date,omitempty"`
+	End_date				*time.Time			`json:"end_date,omitempty"`
+	Foods					[]FoodImport		`json:"foods"`
+}
+
+type FoodImport struct {
+	Name				*string				`json:"name"`
+	Name_translations	map[string]string	`json:"name_translations,omitempty"`
+	Description			*string				`json:"description,omitempty"`
+	Price				*float64			`json:"price"`
+	Food_image			*string				`json:"food_image"`
+	Recipe				[]RecipeItem		`json:"recipe,omitempty"`
+	Allergens			[]string			`json:"allergens,omitempty"`
+	Dietary_tags		[]string			`json:"dietary_tags,omitempty"`
+	Nutrition_override	*Nutrition			`json:"nutrition_override,omitempty"`
+	Nutrition			*Nutrition			`json:"nutrition,omitempty"`	// exported only, derived on import
+	Contains			[]string			`json:"contains,omitempty"`		// exported only, derived on import
+	Suitable_for		[]string			`json:"suitable_for,omitempty"`	// exported only, derived on import
+}
+
+type ImportError struct {
+	Row					string				`json:"row"`
+	Menu				string				`json:"menu"`
+	Food				string				`json:"food,omitempty"`
+	Error				string				`json:"error"`
+}
+
+type ImportReport struct {
+	Dry_run				bool				`json:"dry_run"`
+	Applied				bool				`json:"applied"`
+	Menus_created		int					`json:"menus_created"`
+	Menus_updated		int					`json:"menus_updated"`
+	Foods_created		int					`json:"foods_created"`
+	Foods_updated		int					`json:"foods_updated"`
+	Errors				[]ImportError		`json:"errors"`
+}
@@ -0,0 +1,21 @@
+package models
+
+import (
+	"time"
+	
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type Ingredient struct {
+	ID					primitive.ObjectID		`bson:"_id"`
+	Name				*string					`json:"name" validate:"required,min=2,max=100"`
+	Unit				*string					`json:"unit" validate:"required,eq=G|eq=KG|eq=ML|eq=L|eq=PCS"`
+	Stock_quantity		*float64				`json:"stock_quantity" validate:"required,gte=0"`
+	Unit_cost			*float64				`json:"unit_cost" validate:"required,gte=0"`
+	Allergens			[]string				`json:"allergens" validate:"omitempty,dive,eq=CELERY|eq=GLUTEN|eq=CRUSTACEANS|eq=EGGS|eq=FISH|eq=LUPIN|eq=MILK|eq=MOLLUSCS|eq=MUSTARD|eq=NUTS|eq=PEANUTS|eq=SESAME|eq=SOYA|eq=SULPHITES"`
+	Dietary_tags		[]string				`json:"dietary_tags" validate:"omitempty,dive,eq=VEGAN|eq=HALAL|eq=GLUTEN_FREE"`
+	Nutrition			*Nutrition				`json:"nutrition"`
+	Created_at			time.Time				`json:"created_at"`
+	Updated_at			time.Time				`json:"updated_at"`
+	Ingredient_id		string					`json:"ingredient_id"`
+}
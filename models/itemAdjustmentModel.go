@@ -0,0 +1,24 @@
+package models
+
+import (
+	"time"
+	
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// VOID (taken off the order, e.g. entered by mistake) or COMP (served on the house) of an order item;
+// the line stays on the order for audit but is no longer billed
+type ItemAdjustment struct {
+	ID					primitive.ObjectID		`bson:"_id"`
+	Type				string					`json:"type" validate:"eq=VOID|eq=COMP"`
+	Reason				string					`json:"reason" validate:"required"`
+	Comment				*string					`json:"comment" validate:"omitempty,max=500"`
+	Order_item_id		string					`json:"order_item_id"`
+	Order_id			string					`json:"order_id"`
+	Item_name			string					`json:"item_name"`
+	Amount				float64					`json:"amount"`
+	Staff_id			string					`json:"staff_id"`
+	Approved_by			string					`json:"approved_by"`
+	Created_at			time.Time				`json:"created_at"`
+	Adjustment_id		string					`json:"adjustment_id"`
+}
\ No newline at end of file
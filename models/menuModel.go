@@ -10,6 +10,8 @@ type Menu struct {
 	ID					primitive.ObjectID		`bson:"_id"` 
 	Name 				string 					`json:"name" validate:"required"`
 	Category 			string					`json:"category" validate:"required"`
+	Name_translations	map[string]string		`json:"name_translations" validate:"omitempty,dive,keys,bcp47_language_tag,endkeys,required"`
+	Category_translations	map[string]string	`json:"category_translations" validate:"omitempty,dive,keys,bcp47_language_tag,endkeys,required"`
 	Start_Date			*time.Time				`json:"start_date"`
 	End_Date			*time.Time				`json:"end_date"`
 	Created_at			time.Time				`json:"created_at"`
@@ -0,0 +1,23 @@
+package models
+
+import (
+	"time"
+	
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Snapshot of a menu and its foods; drafts are edited here and published onto the live menu
+type MenuVersion struct {
+	ID					primitive.ObjectID		`bson:"_id"`
+	Menu_id				string					`json:"menu_id"`
+	Version				int						`json:"version"`
+	Status				string					`json:"status" validate:"eq=DRAFT|eq=SCHEDULED|eq=PUBLISHED|eq=ARCHIVED"`
+	Menu				Menu					`json:"menu"`
+	Foods				[]Food					`json:"foods"`
+	Publish_at			*time.Time				`json:"publish_at"`
+	Published_at		*time.Time				`json:"published_at"`
+	Created_by			string					`json:"created_by"`
+	Created_at			time.Time				`json:"created_at"`
+	Updated_at			time.Time				`json:"updated_at"`
+	Version_id			string					`json:"version_id"`
+}
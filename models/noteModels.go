@@ -6,10 +6,15 @@ import (
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+// Note / special instruction attached to an ORDER (e.g. "birthday"), an ORDER_ITEM (e.g. "no onions")
+// or a TABLE (e.g. "high chair"), identified by Entity_id
 type Note struct {
 	ID					primitive.ObjectID		`bson:"_id"` 
-	Text 				string					`json:"text"`
-	Title				string					`json:"title"`
+	Text 				string					`json:"text" validate:"required,max=500"`
+	Title				string					`json:"title" validate:"max=100"`
+	Entity_type			string					`json:"entity_type" validate:"required,eq=ORDER|eq=ORDER_ITEM|eq=TABLE"`
+	Entity_id			string					`json:"entity_id" validate:"required"`
+	Created_by			string					`json:"created_by"`
 	Created_at			time.Time				`json:"created_at"`
 	Updated_at			time.Time				`json:"updated_at"`
 	Note_id				string					`json:"note_id"`
@@ -0,0 +1,11 @@
+package models
+
+// Nutrition values; per 100 g / ml (per piece for PCS) on ingredients, per portion on foods
+type Nutrition struct {
+	Calories			float64					`json:"calories" validate:"gte=0"`
+	Protein				float64					`json:"protein" validate:"gte=0"`
+	Carbohydrates		float64					`json:"carbohydrates" validate:"gte=0"`
+	Sugar				float64					`json:"sugar" validate:"gte=0"`
+	Fat					float64					`json:"fat" validate:"gte=0"`
+	Salt				float64					`json:"salt" validate:"gte=0"`
+}
@@ -12,7 +12,15 @@ type OrderItem struct {
 	Unit_price			*float64				`json:"unit_price" validate:"required"`
 	Created_at			time.Time				`json:"created_at"`
 	Updated_at			time.Time				`json:"updated_at"`
-	Food_id				*string					`json:"food_id" validate:"required"`
+	Food_id				*string					`json:"food_id" validate:"required_without=Bundle_id,excluded_with=Bundle_id"`
+	Bundle_id			*string					`json:"bundle_id"`
+	Components			[]BundleComponent		`json:"components" validate:"required_with=Bundle_id,omitempty,dive"`
 	Order_item_id		string					`json:"order_item_id"`
 	Order_id			string					`json:"order_id" validate:"required"`
+	Allergy_warnings	[]string				`json:"allergy_warnings"`
+	Course				*int					`json:"course" validate:"omitempty,gte=1,lte=9"`
+	Course_status		string					`json:"course_status" validate:"omitempty,eq=HELD|eq=FIRED"`
+	Fired_at			*time.Time				`json:"fired_at"`
+	Adjustment			*string					`json:"adjustment"`
+	Adjustment_id		*string					`json:"adjustment_id"`
 }
\ No newline at end of file
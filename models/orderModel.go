@@ -6,11 +6,27 @@ import (
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+// Dine-in orders belong to a table, takeaway and delivery orders to a customer and the time they were promised
 type Order struct {
 	ID					primitive.ObjectID		`bson:"_id"` 
 	Order_Date 			time.Time				`json:"order_date" validate:"required"`
 	Created_at			time.Time				`json:"created_at"`
 	Updated_at			time.Time				`json:"updated_at"`
 	Order_id			string					`json:"order_id"`
-	Table_id			*string					`json:"table_id" validate:"required"`
+	Order_type			string					`json:"order_type" validate:"eq=DINE_IN|eq=TAKEAWAY|eq=DELIVERY"`
+	Table_id			*string					`json:"table_id" validate:"required_if=Order_type DINE_IN,excluded_unless=Order_type DINE_IN"`
+	Customer_name		*string					`json:"customer_name" validate:"required_unless=Order_type DINE_IN,omitempty,min=2,max=100"`
+	Customer_phone		*string					`json:"customer_phone" validate:"required_unless=Order_type DINE_IN,omitempty,max=30"`
+	Delivery_address	*string					`json:"delivery_address" validate:"required_if=Order_type DELIVERY,excluded_unless=Order_type DELIVERY,omitempty,max=300"`
+	Delivery_location	*GeoPoint				`json:"delivery_location" validate:"excluded_unless=Order_type DELIVERY,omitempty"`
+	Delivery_zone_id	*string					`json:"delivery_zone_id"`
+	Delivery_fee		*float64				`json:"delivery_fee"`
+	Promised_at			*time.Time				`json:"promised_at" validate:"required_unless=Order_type DINE_IN"`
+	Ready_at			*time.Time				`json:"ready_at"`
+	Server_id			*string					`json:"server_id"`
+	Source				*string					`json:"source"`
+	External_id			*string					`json:"external_id"`
+	Merged_into			*string					`json:"merged_into"`
+	Allergy_profile		[]string				`json:"allergy_profile" validate:"omitempty,dive,eq=CELERY|eq=GLUTEN|eq=CRUSTACEANS|eq=EGGS|eq=FISH|eq=LUPIN|eq=MILK|eq=MOLLUSCS|eq=MUSTARD|eq=NUTS|eq=PEANUTS|eq=SESAME|eq=SOYA|eq=SULPHITES"`
+	Allergy_policy		*string					`json:"allergy_policy" validate:"omitempty,eq=FLAG|eq=BLOCK"`
 }
\ No newline at end of file
@@ -0,0 +1,18 @@
+package models
+
+import (
+	"time"
+	
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type Price struct {
+	ID					primitive.ObjectID		`bson:"_id"`
+	Food_id				string					`json:"food_id"`
+	Price				*float64				`json:"price" validate:"required,gt=0"`
+	Effective_from		time.Time				`json:"effective_from"`
+	Applied				bool					`json:"applied"`
+	Created_by			string					`json:"created_by"`
+	Created_at			time.Time				`json:"created_at"`
+	Price_id			string					`json:"price_id"`
+}
@@ -0,0 +1,30 @@
+package models
+
+import (
+	"time"
+	
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Group of tables within an area that one server looks after during a shift
+type Section struct {
+	ID					primitive.ObjectID		`bson:"_id"`
+	Name				*string					`json:"name" validate:"required,min=2,max=100"`
+	Area_id				*string					`json:"area_id" validate:"required"`
+	Color				*string					`json:"color" validate:"omitempty,hexcolor"`
+	Created_at			time.Time				`json:"created_at"`
+	Updated_at			time.Time				`json:"updated_at"`
+	Section_id			string					`json:"section_id"`
+}
+
+// Server (user) owning a section for the duration of a shift
+type SectionAssignment struct {
+	ID					primitive.ObjectID		`bson:"_id"`
+	Section_id			*string					`json:"section_id" validate:"required"`
+	Server_id			*string					`json:"server_id" validate:"required"`
+	Shift_start			*time.Time				`json:"shift_start" validate:"required"`
+	Shift_end			*time.Time				`json:"shift_end" validate:"required,gtfield=Shift_start"`
+	Created_at			time.Time				`json:"created_at"`
+	Updated_at			time.Time				`json:"updated_at"`
+	Assignment_id		string					`json:"assignment_id"`
+}
@@ -10,7 +10,26 @@ type Table struct {
 	ID					primitive.ObjectID		`bson:"_id"` 
 	Number_of_guests 	*int					`json:"number_of_guests" validate:"required"`
 	Table_number		*int 					`json:"table_number" validate:"required"`
+	Area_id				*string					`json:"area_id"`
+	Section_id			*string					`json:"section_id"`
+	Seats				*int					`json:"seats" validate:"omitempty,gt=0"`
+	Layout				*TableLayout			`json:"layout"`
+	Status				*string					`json:"status"`
+	Status_override		*string					`json:"status_override" validate:"omitempty,eq=FREE|eq=SEATED|eq=ORDERED|eq=AWAITING_BILL|eq=DIRTY"`
+	Status_since		*time.Time				`json:"status_since"`
+	Cleared_at			*time.Time				`json:"cleared_at"`
+	Guest_token_version	int						`json:"guest_token_version"`
 	Created_at			time.Time				`json:"created_at"`
 	Updated_at			time.Time				`json:"updated_at"`
 	Table_id			string					`json:"table_id"`
-}
\ No newline at end of file
+}
+
+// Placement of the table on its area's canvas
+type TableLayout struct {
+	X					float64					`json:"x"`
+	Y					float64					`json:"y"`
+	Width				float64					`json:"width" validate:"gte=0"`
+	Height				float64					`json:"height" validate:"gte=0"`
+	Rotation			float64					`json:"rotation"`
+	Shape				string					`json:"shape" validate:"eq=ROUND|eq=SQUARE|eq=RECTANGLE"`
+}
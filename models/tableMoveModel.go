@@ -0,0 +1,23 @@
+package models
+
+import (
+	"time"
+	
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Audit entry of an order moved between tables: TRANSFER (order to another table), MERGE (items of
+// Order_id moved onto Target_order_id) or SPLIT (items of Order_id moved onto the new Target_order_id)
+type TableMove struct {
+	ID					primitive.ObjectID		`bson:"_id"`
+	Type				string					`json:"type" validate:"eq=TRANSFER|eq=MERGE|eq=SPLIT"`
+	Order_id			string					`json:"order_id"`
+	Target_order_id		*string					`json:"target_order_id"`
+	From_table_id		*string					`json:"from_table_id"`
+	To_table_id			*string					`json:"to_table_id"`
+	Order_item_ids		[]string				`json:"order_item_ids"`
+	Reason				*string					`json:"reason"`
+	Moved_by			string					`json:"moved_by"`
+	Created_at			time.Time				`json:"created_at"`
+	Move_id				string					`json:"move_id"`
+}
@@ -14,6 +14,10 @@ type User struct {
 	Email				*string					`json:"email" validate:"email,required"`
 	Avatar				*string					`json:"avatar"`
 	Phone				*string					`json:"phone" validate:"required"`
+	Role				*string					`json:"role"`
+	Manager_pin			*string					`json:"-"`
+	Pin_failures		int						`json:"-"`
+	Pin_locked_until	*time.Time				`json:"-"`
 	Token				*string					`json:"token"`
 	Refresh_Token		*string					`json:"refresh_token"`
 	Created_at			time.Time				`json:"created_at"`
@@ -0,0 +1,26 @@
+package models
+
+import (
+	"time"
+	
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Walk-in party waiting for a table
+type WaitlistEntry struct {
+	ID					primitive.ObjectID		`bson:"_id"`
+	Name				*string					`json:"name" validate:"required,min=2,max=100"`
+	Party_size			*int					`json:"party_size" validate:"required,gt=0"`
+	Phone				*string					`json:"phone"`
+	Email				*string					`json:"email" validate:"omitempty,email"`
+	Notes				*string					`json:"notes" validate:"omitempty,max=500"`
+	Status				string					`json:"status" validate:"eq=WAITING|eq=NOTIFIED|eq=SEATED|eq=CANCELLED|eq=NO_SHOW"`
+	Quoted_wait			int						`json:"quoted_wait"`
+	Table_id			*string					`json:"table_id"`
+	Order_id			*string					`json:"order_id"`
+	Notified_at			*time.Time				`json:"notified_at"`
+	Seated_at			*time.Time				`json:"seated_at"`
+	Created_at			time.Time				`json:"created_at"`
+	Updated_at			time.Time				`json:"updated_at"`
+	Waitlist_id			string					`json:"waitlist_id"`
+}
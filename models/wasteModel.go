@@ -0,0 +1,22 @@
+package models
+
+import (
+	"time"
+	
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type Waste struct {
+	ID					primitive.ObjectID		`bson:"_id"`
+	Ingredient_id		*string					`json:"ingredient_id" validate:"required_without=Food_id,excluded_with=Food_id"`
+	Food_id				*string					`json:"food_id" validate:"required_without=Ingredient_id,excluded_with=Ingredient_id"`
+	Item_name			string					`json:"item_name"`
+	Quantity			*float64				`json:"quantity" validate:"required,gt=0"`
+	Reason				*string					`json:"reason" validate:"required,eq=SPOILED|eq=EXPIRED|eq=DROPPED|eq=OVERPRODUCED|eq=RETURNED|eq=OTHER"`
+	Cost				*float64				`json:"cost" validate:"omitempty,gte=0"`
+	Operator_id			string					`json:"operator_id"`
+	Wasted_at			time.Time				`json:"wasted_at"`
+	Created_at			time.Time				`json:"created_at"`
+	Updated_at			time.Time				`json:"updated_at"`
+	Waste_id			string					`json:"waste_id"`
+}
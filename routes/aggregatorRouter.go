@@ -0,0 +1,19 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	controller "github.com/lackingworth/Go-Restaurant-Management/controllers"
+)
+
+// Inbound webhooks of the delivery platforms, authenticated by their adapters instead of the staff JWT
+func AggregatorWebhookRoutes(incomingRoutes *gin.Engine) {
+	incomingRoutes.POST("/aggregators/:platform/orders", controller.ReceiveAggregatorOrder())
+}
+
+func AggregatorRoutes(incomingRoutes *gin.Engine) {
+	incomingRoutes.GET("/aggregator-orders", controller.GetAggregatorOrders())
+	incomingRoutes.POST("/aggregator-orders/:aggregator_order_id/status", controller.UpdateAggregatorOrderStatus())
+	incomingRoutes.GET("/aggregator-mappings", controller.GetAggregatorMappings())
+	incomingRoutes.POST("/aggregator-mappings", controller.CreateAggregatorMapping())
+	incomingRoutes.DELETE("/aggregator-mappings/:mapping_id", controller.DeleteAggregatorMapping())
+}
@@ -0,0 +1,13 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	controller "github.com/lackingworth/Go-Restaurant-Management/controllers"
+)
+
+func BundleRoutes(incomingRoutes *gin.Engine) {
+	incomingRoutes.GET("/bundles", controller.GetBundles())
+	incomingRoutes.GET("/bundles/:bundle_id", controller.GetBundle())
+	incomingRoutes.POST("/bundles", controller.CreateBundle())
+	incomingRoutes.PATCH("/bundles/:bundle_id", controller.UpdateBundle())
+}
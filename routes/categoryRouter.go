@@ -0,0 +1,14 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	controller "github.com/lackingworth/Go-Restaurant-Management/controllers"
+)
+
+func CategoryRoutes(incomingRoutes *gin.Engine) {
+	incomingRoutes.GET("/categories", controller.GetCategories())
+	incomingRoutes.GET("/categories/:category_id", controller.GetCategory())
+	incomingRoutes.POST("/categories", controller.CreateCategory())
+	incomingRoutes.PATCH("/categories/:category_id", controller.UpdateCategory())
+	incomingRoutes.PATCH("/menus/:menu_id/order", controller.UpdateMenuOrder())
+}
@@ -0,0 +1,19 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	controller "github.com/lackingworth/Go-Restaurant-Management/controllers"
+)
+
+func DeliveryRoutes(incomingRoutes *gin.Engine) {
+	incomingRoutes.GET("/delivery-zones", controller.GetDeliveryZones())
+	incomingRoutes.POST("/delivery-zones", controller.CreateDeliveryZone())
+	incomingRoutes.PATCH("/delivery-zones/:zone_id", controller.UpdateDeliveryZone())
+	incomingRoutes.GET("/delivery-quote", controller.GetDeliveryQuote())
+	incomingRoutes.GET("/drivers", controller.GetDrivers())
+	incomingRoutes.POST("/drivers", controller.CreateDriver())
+	incomingRoutes.PATCH("/drivers/:driver_id", controller.UpdateDriver())
+	incomingRoutes.GET("/deliveries", controller.GetDeliveries())
+	incomingRoutes.POST("/orders/:order_id/delivery", controller.AssignDelivery())
+	incomingRoutes.PATCH("/deliveries/:delivery_id/status", controller.UpdateDeliveryStatus())
+}
@@ -0,0 +1,20 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	controller "github.com/lackingworth/Go-Restaurant-Management/controllers"
+)
+
+func FloorRoutes(incomingRoutes *gin.Engine) {
+	incomingRoutes.GET("/areas", controller.GetAreas())
+	incomingRoutes.GET("/areas/:area_id", controller.GetArea())
+	incomingRoutes.POST("/areas", controller.CreateArea())
+	incomingRoutes.PATCH("/areas/:area_id", controller.UpdateArea())
+	incomingRoutes.PATCH("/areas/:area_id/layout", controller.UpdateAreaLayout())
+	incomingRoutes.GET("/sections", controller.GetSections())
+	incomingRoutes.POST("/sections", controller.CreateSection())
+	incomingRoutes.PATCH("/sections/:section_id", controller.UpdateSection())
+	incomingRoutes.GET("/section-assignments", controller.GetSectionAssignments())
+	incomingRoutes.POST("/section-assignments", controller.CreateSectionAssignment())
+	incomingRoutes.DELETE("/section-assignments/:assignment_id", controller.DeleteSectionAssignment())
+}
@@ -8,6 +8,12 @@ import (
 func FoodRoutes(incomingRoutes *gin.Engine) {
 	incomingRoutes.GET("/foods", controller.GetFoods())
 	incomingRoutes.GET("/foods/:food_id", controller.GetFood())
+	incomingRoutes.GET("/foods-search", controller.SearchFoods())
 	incomingRoutes.POST("/foods", controller.CreateFood())
 	incomingRoutes.PATCH("/foods/:food_id", controller.UpdateFood())
+	incomingRoutes.DELETE("/foods/:food_id/nutrition-override", controller.DeleteFoodNutritionOverride())
+	incomingRoutes.POST("/foods/:food_id/image", controller.UploadFoodImage())
+	incomingRoutes.GET("/foods/:food_id/prices", controller.GetFoodPrices())
+	incomingRoutes.POST("/foods/:food_id/prices", controller.CreateFoodPrice())
+	incomingRoutes.DELETE("/foods/:food_id/prices/:price_id", controller.DeleteFoodPrice())
 }
\ No newline at end of file
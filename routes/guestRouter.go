@@ -0,0 +1,28 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	controller "github.com/lackingworth/Go-Restaurant-Management/controllers"
+	"github.com/lackingworth/Go-Restaurant-Management/middleware"
+)
+
+// Guest API authenticated by the QR code token of the table, registered before the staff authentication
+func GuestRoutes(incomingRoutes *gin.Engine) {
+	guestRoutes := incomingRoutes.Group("/guest")
+	guestRoutes.Use(middleware.GuestAuthentication())
+	guestRoutes.Use(middleware.Idempotency())
+
+	guestRoutes.GET("/table", controller.GetGuestTable())
+	guestRoutes.GET("/menu", controller.GetGuestMenu())
+	guestRoutes.GET("/orders", controller.GetGuestTableOrders())
+	guestRoutes.POST("/orders", controller.CreateGuestOrder())
+	guestRoutes.GET("/bill", controller.GetGuestBill())
+}
+
+func GuestOrderRoutes(incomingRoutes *gin.Engine) {
+	incomingRoutes.GET("/tables/:table_id/qr-code", controller.GetTableQRCode())
+	incomingRoutes.POST("/tables/:table_id/qr-code", controller.RotateTableQRCode())
+	incomingRoutes.GET("/guest-orders", controller.GetGuestOrders())
+	incomingRoutes.POST("/guest-orders/:guest_order_id/approve", controller.ApproveGuestOrder())
+	incomingRoutes.POST("/guest-orders/:guest_order_id/reject", controller.RejectGuestOrder())
+}
@@ -0,0 +1,13 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	controller "github.com/lackingworth/Go-Restaurant-Management/controllers"
+)
+
+func IngredientRoutes(incomingRoutes *gin.Engine) {
+	incomingRoutes.GET("/ingredients", controller.GetIngredients())
+	incomingRoutes.GET("/ingredients/:ingredient_id", controller.GetIngredient())
+	incomingRoutes.POST("/ingredients", controller.CreateIngredient())
+	incomingRoutes.PATCH("/ingredients/:ingredient_id", controller.UpdateIngredient())
+}
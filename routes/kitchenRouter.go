@@ -0,0 +1,12 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	controller "github.com/lackingworth/Go-Restaurant-Management/controllers"
+)
+
+func KitchenRoutes(incomingRoutes *gin.Engine) {
+	incomingRoutes.GET("/kitchen/tickets/:order_id", controller.GetKitchenTicket())
+	incomingRoutes.GET("/kitchen/feed", controller.GetKitchenFeed())
+	incomingRoutes.POST("/kitchen/orders/:order_id/ready", controller.MarkOrderReady())
+}
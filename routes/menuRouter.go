@@ -10,4 +10,13 @@ func MenuRoutes(incomingRoutes *gin.Engine) {
 	incomingRoutes.GET("/menus/:menu_id", controller.GetMenu())
 	incomingRoutes.POST("/menus", controller.CreateMenu())
 	incomingRoutes.PATCH("/menus/:menu_id", controller.UpdateMenu())
+	incomingRoutes.POST("/menus-import", controller.ImportMenus())
+	incomingRoutes.GET("/menus-export", controller.ExportMenus())
+	incomingRoutes.GET("/menus/:menu_id/versions", controller.GetMenuVersions())
+	incomingRoutes.GET("/menus/:menu_id/versions/:version_id", controller.GetMenuVersion())
+	incomingRoutes.GET("/menus/:menu_id/versions/:version_id/diff", controller.GetMenuVersionDiff())
+	incomingRoutes.POST("/menus/:menu_id/versions", controller.CreateMenuVersion())
+	incomingRoutes.PATCH("/menus/:menu_id/versions/:version_id", controller.UpdateMenuVersion())
+	incomingRoutes.POST("/menus/:menu_id/versions/:version_id/publish", controller.PublishMenuVersion())
+	incomingRoutes.POST("/menus/:menu_id/rollback", controller.RollbackMenu())
 }
\ No newline at end of file
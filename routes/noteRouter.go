@@ -0,0 +1,14 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	controller "github.com/lackingworth/Go-Restaurant-Management/controllers"
+)
+
+func NoteRoutes(incomingRoutes *gin.Engine) {
+	incomingRoutes.GET("/notes", controller.GetNotes())
+	incomingRoutes.GET("/notes/:note_id", controller.GetNote())
+	incomingRoutes.POST("/notes", controller.CreateNote())
+	incomingRoutes.PATCH("/notes/:note_id", controller.UpdateNote())
+	incomingRoutes.DELETE("/notes/:note_id", controller.DeleteNote())
+}
\ No newline at end of file
@@ -11,4 +11,8 @@ func OrderItemRoutes(incomingRoutes *gin.Engine) {
 	incomingRoutes.GET("/orderItems-order/:order_id", controller.GetOrderItemsByOrder())
 	incomingRoutes.POST("/orderItems", controller.CreateOrderItem())
 	incomingRoutes.PATCH("/orderItems/:orderItem_id", controller.UpdateOrderItem())
+	incomingRoutes.POST("/orderItems/:orderItem_id/void", controller.VoidOrderItem())
+	incomingRoutes.POST("/orderItems/:orderItem_id/comp", controller.CompOrderItem())
+	incomingRoutes.GET("/item-adjustments", controller.GetItemAdjustments())
+	incomingRoutes.GET("/item-adjustments-report", controller.GetItemAdjustmentReport())
 }
\ No newline at end of file
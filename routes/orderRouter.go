@@ -10,4 +10,11 @@ func OrderRoutes(incomingRoutes *gin.Engine) {
 	incomingRoutes.GET("/orders/:order_id", controller.GetOrder())
 	incomingRoutes.POST("/orders", controller.CreateOrder())
 	incomingRoutes.PATCH("/orders/:order_id", controller.UpdateOrder())
+	incomingRoutes.POST("/orders/:order_id/transfer", controller.TransferOrder())
+	incomingRoutes.POST("/orders/:order_id/merge", controller.MergeOrders())
+	incomingRoutes.POST("/orders/:order_id/split", controller.SplitOrder())
+	incomingRoutes.GET("/orders/:order_id/courses", controller.GetOrderCourses())
+	incomingRoutes.POST("/orders/:order_id/courses/:course/fire", controller.FireCourse())
+	incomingRoutes.POST("/orders/:order_id/courses/:course/hold", controller.HoldCourse())
+	incomingRoutes.GET("/table-moves", controller.GetTableMoves())
 }
\ No newline at end of file
@@ -10,4 +10,8 @@ func TableRoutes(incomingRoutes *gin.Engine) {
 	incomingRoutes.GET("/tables/:table_id", controller.GetTable())
 	incomingRoutes.POST("/tables", controller.CreateTable())
 	incomingRoutes.PATCH("/tables/:table_id", controller.UpdateTable())
+	incomingRoutes.PATCH("/tables/:table_id/status", controller.UpdateTableStatus())
+	incomingRoutes.DELETE("/tables/:table_id/status", controller.DeleteTableStatus())
+	incomingRoutes.GET("/tables-board", controller.GetTableBoard())
+	incomingRoutes.GET("/tables-board/stream", controller.StreamTableBoard())
 }
\ No newline at end of file
@@ -3,11 +3,13 @@ package routes
 import (
 	"github.com/gin-gonic/gin"
 	controller "github.com/lackingworth/Go-Restaurant-Management/controllers"
+	"github.com/lackingworth/Go-Restaurant-Management/middleware"
 )
 
 func UserRoutes(incomingRoutes *gin.Engine) {
-	incomingRoutes.GET("/users", controller.GetUsers())
-	incomingRoutes.GET("/users/:user_id", controller.GetUser())
+	incomingRoutes.GET("/users", middleware.Authentication(), controller.GetUsers())
+	incomingRoutes.GET("/users/:user_id", middleware.Authentication(), controller.GetUser())
 	incomingRoutes.POST("/users/signup", controller.SignUp())
 	incomingRoutes.POST("/users/login", controller.Login())
+	incomingRoutes.PATCH("/users/:user_id/role", middleware.Authentication(), controller.UpdateUserRole())
 }
\ No newline at end of file
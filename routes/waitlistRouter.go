@@ -0,0 +1,16 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	controller "github.com/lackingworth/Go-Restaurant-Management/controllers"
+)
+
+func WaitlistRoutes(incomingRoutes *gin.Engine) {
+	incomingRoutes.GET("/waitlist", controller.GetWaitlist())
+	incomingRoutes.GET("/waitlist/:waitlist_id", controller.GetWaitlistEntry())
+	incomingRoutes.GET("/waitlist-estimate", controller.GetWaitEstimate())
+	incomingRoutes.POST("/waitlist", controller.CreateWaitlistEntry())
+	incomingRoutes.PATCH("/waitlist/:waitlist_id", controller.UpdateWaitlistEntry())
+	incomingRoutes.POST("/waitlist/:waitlist_id/notify", controller.NotifyWaitlistEntry())
+	incomingRoutes.POST("/waitlist/:waitlist_id/seat", controller.SeatWaitlistEntry())
+}
@@ -0,0 +1,13 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	controller "github.com/lackingworth/Go-Restaurant-Management/controllers"
+)
+
+func WasteRoutes(incomingRoutes *gin.Engine) {
+	incomingRoutes.GET("/wastes", controller.GetWastes())
+	incomingRoutes.GET("/wastes/:waste_id", controller.GetWaste())
+	incomingRoutes.GET("/wastes-report", controller.GetWasteReport())
+	incomingRoutes.POST("/wastes", controller.CreateWaste())
+}
@@ -0,0 +1,58 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Stores files on the local filesystem below Dir; they are expected
+// to be served as static files under BaseURL (see main.go)
+type LocalStorage struct {
+	Dir			string
+	BaseURL		string
+}
+
+func (s *LocalStorage) path(key string) (string, error) {
+	clean := path.Clean("/" + key)
+
+	if clean == "/" || strings.Contains(key, "..") {
+		return "", fmt.Errorf("invalid storage key %q", key)
+	}
+
+	return filepath.Join(s.Dir, filepath.FromSlash(clean)), nil
+}
+
+func (s *LocalStorage) Save(key string, data []byte, contentType string) (string, error) {
+	target, err := s.path(key)
+
+	if err != nil {
+		return "", err
+	}
+
+	if err = os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return "", err
+	}
+
+	if err = os.WriteFile(target, data, 0644); err != nil {
+		return "", err
+	}
+
+	return strings.TrimSuffix(s.BaseURL, "/") + path.Clean("/" + key), nil
+}
+
+func (s *LocalStorage) Delete(key string) error {
+	target, err := s.path(key)
+
+	if err != nil {
+		return err
+	}
+
+	if err = os.Remove(target); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,32 @@
+package storage
+
+import (
+	"os"
+)
+
+// Backend stores uploaded files and hands out the URLs they are served from.
+// Keys are slash separated paths (e.g. foods/<food_id>/<name>.jpg)
+type Backend interface {
+	Save(key string, data []byte, contentType string) (url string, err error)
+	Delete(key string) error
+}
+
+var Files Backend = Instance()
+
+// Builds the default local filesystem backend from STORAGE_DIR and STORAGE_BASE_URL;
+// other backends can be plugged in by assigning Files at startup
+func Instance() Backend {
+	dir := os.Getenv("STORAGE_DIR")
+
+	if dir == "" {
+		dir = "uploads"
+	}
+
+	baseURL := os.Getenv("STORAGE_BASE_URL")
+
+	if baseURL == "" {
+		baseURL = "/uploads"
+	}
+
+	return &LocalStorage{Dir: dir, BaseURL: baseURL}
+}